@@ -1,7 +1,11 @@
 package app
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 
@@ -18,15 +22,35 @@ func Run() {
 		base = loaded
 	}
 	cfg := config.ParseFlags(base)
+	if cfg.Export != "" {
+		if err := exportScan(cfg); err != nil {
+			fmt.Fprintln(os.Stderr, "SweepFS export error:", err)
+			os.Exit(1)
+		}
+		return
+	}
 	initialState := state.NewState(cfg)
-	if err := initialState.LoadListing(cfg.Path); err != nil {
+
+	var scanner services.Scanner = services.NewFSScanner()
+	if cfg.Import != "" {
+		imported, importErr := services.NewImportScanner(cfg.Import, cfg.SizeMode)
+		if importErr != nil {
+			fmt.Fprintln(os.Stderr, "SweepFS import error:", importErr)
+			os.Exit(1)
+		}
+		scanner = imported
+		initialState.ImportedFrom = cfg.Import
+		initialState.SetTree(imported.Snapshot())
+		initialState.Path = initialState.Tree.RootID
+	} else if err := initialState.LoadListing(cfg.Path); err != nil {
 		fmt.Println("SweepFS listing warning:", err)
 	}
-
-	scanner := services.NewFSScanner()
 	actions := services.NewFSActions()
 
 	model := ui.NewModel(initialState, scanner, actions)
+	if cfg.StartOnMounts {
+		model = model.WithMountOverview()
+	}
 	if err != nil {
 		model = model.WithStatus("Config warning: using defaults")
 	}
@@ -37,8 +61,71 @@ func Run() {
 		return
 	}
 	if provider, ok := finalModel.(ui.ConfigProvider); ok {
-		if err := config.SaveConfig(provider.ConfigSnapshot()); err != nil {
+		snapshot := provider.ConfigSnapshot()
+		if cfg.Import != "" {
+			snapshot.Path = cfg.Path
+		}
+		if err := config.SaveConfig(snapshot); err != nil {
 			fmt.Println("SweepFS config save error:", err)
 		}
 	}
 }
+
+// exportScan scans cfg.Path without starting the UI and writes the tree as
+// an ncdu export.
+func exportScan(cfg config.Config) error {
+	scanner := services.NewFSScanner()
+	done := make(chan struct{})
+	defer close(done)
+	go drainProgress(scanner, done)
+
+	_, err := scanner.Scan(context.Background(), services.ScanRequest{
+		RootPath:       cfg.Path,
+		ShowHidden:     cfg.ShowHidden,
+		SizeMode:       cfg.SizeMode,
+		OneFileSystem:  cfg.OneFileSystem,
+		FollowSymlinks: cfg.FollowSymlinks,
+		Exclude:        cfg.Exclusions,
+		MaxDepth:       cfg.MaxDepth,
+		Concurrency:    cfg.Concurrency,
+		SniffTypes:     cfg.SniffTypes,
+	})
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if cfg.Export != "-" {
+		file, err := os.Create(cfg.Export)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	if err := services.ExportNcdu(out, scanner.Snapshot()); err != nil {
+		return err
+	}
+	if file, ok := out.(*os.File); ok && file != os.Stdout {
+		return file.Close()
+	}
+	return nil
+}
+
+func drainProgress(scanner *services.FSScanner, done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		channel := scanner.Progress()
+		if channel == nil {
+			time.Sleep(50 * time.Millisecond)
+			continue
+		}
+		for range channel {
+		}
+		return
+	}
+}
@@ -3,21 +3,44 @@ package config
 import "sweepfs/internal/domain"
 
 type Config struct {
-	Path            string            `json:"path"`
-	ShowHidden      bool              `json:"showHidden"`
-	SafeMode        bool              `json:"safeMode"`
-	SortMode        domain.SortMode   `json:"sortMode"`
-	Theme           string            `json:"theme"`
-	KeyBindings     map[string]string `json:"keyBindings"`
-	LastDestination string            `json:"lastDestination"`
+	Path            string               `json:"path"`
+	ShowHidden      bool                 `json:"showHidden"`
+	SafeMode        bool                 `json:"safeMode"`
+	SortMode        domain.SortMode      `json:"sortMode"`
+	SizeMode        domain.SizeMode      `json:"sizeMode"`
+	OneFileSystem   bool                 `json:"oneFileSystem"`
+	FollowSymlinks  bool                 `json:"followSymlinks"`
+	Exclusions      []string             `json:"exclusions"`
+	CleanupRules    []domain.CleanupRule `json:"cleanupRules"`
+	MaxDepth        int                  `json:"maxDepth"`
+	Concurrency     int                  `json:"concurrency"`
+	Watch           bool                 `json:"watch"`
+	SniffTypes      bool                 `json:"sniffTypes"`
+	IndexArchives   bool                 `json:"indexArchives"`
+	Theme           string               `json:"theme"`
+	KeyBindings     map[string]string    `json:"keyBindings"`
+	LastDestination string               `json:"lastDestination"`
+	Import          string               `json:"-"`
+	Export          string               `json:"-"`
+	StartOnMounts   bool                 `json:"-"`
 }
 
 type fileConfig struct {
-	Path            *string           `json:"path"`
-	ShowHidden      *bool             `json:"showHidden"`
-	SafeMode        *bool             `json:"safeMode"`
-	SortMode        *string           `json:"sortMode"`
-	Theme           *string           `json:"theme"`
-	KeyBindings     map[string]string `json:"keyBindings"`
-	LastDestination *string           `json:"lastDestination"`
+	Path            *string              `json:"path"`
+	ShowHidden      *bool                `json:"showHidden"`
+	SafeMode        *bool                `json:"safeMode"`
+	SortMode        *string              `json:"sortMode"`
+	SizeMode        *string              `json:"sizeMode"`
+	OneFileSystem   *bool                `json:"oneFileSystem"`
+	FollowSymlinks  *bool                `json:"followSymlinks"`
+	Exclusions      []string             `json:"exclusions"`
+	CleanupRules    []domain.CleanupRule `json:"cleanupRules"`
+	MaxDepth        *int                 `json:"maxDepth"`
+	Concurrency     *int                 `json:"concurrency"`
+	Watch           *bool                `json:"watch"`
+	SniffTypes      *bool                `json:"sniffTypes"`
+	IndexArchives   *bool                `json:"indexArchives"`
+	Theme           *string              `json:"theme"`
+	KeyBindings     map[string]string    `json:"keyBindings"`
+	LastDestination *string              `json:"lastDestination"`
 }
@@ -6,10 +6,36 @@ func ParseFlags(base Config) Config {
 	path := flag.String("path", base.Path, "Initial path to scan")
 	showHidden := flag.Bool("show-hidden", base.ShowHidden, "Show hidden files")
 	safeMode := flag.Bool("safe-mode", base.SafeMode, "Enable safe mode protections")
+	oneFileSystem := flag.Bool("one-file-system", base.OneFileSystem, "Do not cross filesystem boundaries while scanning")
+	flag.BoolVar(oneFileSystem, "x", base.OneFileSystem, "Shorthand for -one-file-system")
+	followSymlinks := flag.Bool("follow-symlinks", base.FollowSymlinks, "Scan the files and folders that symlinks point to")
+	flag.BoolVar(followSymlinks, "L", base.FollowSymlinks, "Shorthand for -follow-symlinks")
+	maxDepth := flag.Int("max-depth", base.MaxDepth, "Limit scan depth (0 = unlimited)")
+	concurrency := flag.Int("concurrency", base.Concurrency, "Directory scan workers (0 = one per CPU, 1 = sequential)")
+	watch := flag.Bool("watch", base.Watch, "Keep the scanned tree up to date while browsing (Linux)")
+	sniffTypes := flag.Bool("sniff", base.SniffTypes, "Classify files without a known extension by their first bytes")
+	indexArchives := flag.Bool("archives", base.IndexArchives, "List the members of zip and tar archives below them while scanning")
+	importFile := flag.String("import", "", "Browse an ncdu JSON export instead of scanning")
+	exportFile := flag.String("export", "", "Scan -path, write an ncdu JSON export to FILE (- for stdout) and exit")
+	mounts := flag.Bool("mounts", false, "Start on the filesystem overview")
 	flag.Parse()
 
 	base.Path = *path
 	base.ShowHidden = *showHidden
 	base.SafeMode = *safeMode
+	base.OneFileSystem = *oneFileSystem
+	base.FollowSymlinks = *followSymlinks
+	base.Watch = *watch
+	base.SniffTypes = *sniffTypes
+	base.IndexArchives = *indexArchives
+	base.Import = *importFile
+	base.Export = *exportFile
+	base.StartOnMounts = *mounts && *importFile == ""
+	if *maxDepth >= 0 {
+		base.MaxDepth = *maxDepth
+	}
+	if *concurrency >= 0 {
+		base.Concurrency = *concurrency
+	}
 	return base
 }
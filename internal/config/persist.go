@@ -19,6 +19,8 @@ func DefaultConfig() Config {
 		ShowHidden:  false,
 		SafeMode:    true,
 		SortMode:    domain.SortBySize,
+		SizeMode:    domain.SizeApparent,
+		Exclusions:  []string{".git", "node_modules", ".cache"},
 		Theme:       "dark",
 		KeyBindings: map[string]string{},
 	}
@@ -60,6 +62,10 @@ func SaveConfig(config Config) error {
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return err
 	}
+	// Sorting by growth needs the baseline of the session, which is not kept.
+	if config.SortMode == domain.SortByGrowth {
+		config.SortMode = domain.SortBySize
+	}
 	data, err := json.MarshalIndent(config, "", "  ")
 	if err != nil {
 		return err
@@ -81,6 +87,36 @@ func mergeConfig(base Config, stored fileConfig) Config {
 	if stored.SortMode != nil {
 		merged.SortMode = domainSortMode(*stored.SortMode, base.SortMode)
 	}
+	if stored.SizeMode != nil {
+		merged.SizeMode = domainSizeMode(*stored.SizeMode, base.SizeMode)
+	}
+	if stored.OneFileSystem != nil {
+		merged.OneFileSystem = *stored.OneFileSystem
+	}
+	if stored.FollowSymlinks != nil {
+		merged.FollowSymlinks = *stored.FollowSymlinks
+	}
+	if stored.Exclusions != nil {
+		merged.Exclusions = stored.Exclusions
+	}
+	if stored.CleanupRules != nil {
+		merged.CleanupRules = stored.CleanupRules
+	}
+	if stored.MaxDepth != nil && *stored.MaxDepth >= 0 {
+		merged.MaxDepth = *stored.MaxDepth
+	}
+	if stored.Concurrency != nil && *stored.Concurrency >= 0 {
+		merged.Concurrency = *stored.Concurrency
+	}
+	if stored.Watch != nil {
+		merged.Watch = *stored.Watch
+	}
+	if stored.SniffTypes != nil {
+		merged.SniffTypes = *stored.SniffTypes
+	}
+	if stored.IndexArchives != nil {
+		merged.IndexArchives = *stored.IndexArchives
+	}
 	if stored.Theme != nil {
 		merged.Theme = *stored.Theme
 	}
@@ -93,10 +129,23 @@ func mergeConfig(base Config, stored fileConfig) Config {
 	return merged
 }
 
+// domainSortMode restores a stored sort mode. Growth was stored by earlier
+// versions and falls back to size, as no baseline is loaded at start.
 func domainSortMode(value string, fallback domain.SortMode) domain.SortMode {
 	switch domain.SortMode(value) {
-	case domain.SortByName, domain.SortByMod, domain.SortBySize:
+	case domain.SortByName, domain.SortByMod, domain.SortBySize, domain.SortByCount:
 		return domain.SortMode(value)
+	case domain.SortByGrowth:
+		return domain.SortBySize
+	default:
+		return fallback
+	}
+}
+
+func domainSizeMode(value string, fallback domain.SizeMode) domain.SizeMode {
+	switch domain.SizeMode(value) {
+	case domain.SizeApparent, domain.SizeDisk:
+		return domain.SizeMode(value)
 	default:
 		return fallback
 	}
@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+// AgeLimits are the upper bounds, in days, of the modification-age buckets.
+// Files older than the last limit fall into one more bucket.
+var AgeLimits = []int{30, 180, 365, 730, 1825}
+
+const AgeBucketCount = 6
+
+// AgeHistogram holds bytes per modification-age bucket.
+type AgeHistogram [AgeBucketCount]int64
+
+// AgeBucket returns the bucket of a file modified at modTime, or -1 when the
+// time is unknown.
+func AgeBucket(modTime, now time.Time) int {
+	if modTime.IsZero() {
+		return -1
+	}
+	days := DaysSince(modTime, now)
+	for index, limit := range AgeLimits {
+		if days < limit {
+			return index
+		}
+	}
+	return len(AgeLimits)
+}
+
+func AgeBucketLabel(index int) string {
+	switch {
+	case index == 0:
+		return fmt.Sprintf("< %s", formatDays(AgeLimits[0]))
+	case index < len(AgeLimits):
+		return fmt.Sprintf("%s-%s", formatDays(AgeLimits[index-1]), formatDays(AgeLimits[index]))
+	default:
+		return fmt.Sprintf("> %s", formatDays(AgeLimits[len(AgeLimits)-1]))
+	}
+}
+
+// Add adds sign times other to the histogram, never going below zero.
+func (histogram AgeHistogram) Add(other AgeHistogram, sign int64) AgeHistogram {
+	for index := range histogram {
+		histogram[index] += sign * other[index]
+		if histogram[index] < 0 {
+			histogram[index] = 0
+		}
+	}
+	return histogram
+}
+
+func (histogram AgeHistogram) Total() int64 {
+	var total int64
+	for _, bytes := range histogram {
+		total += bytes
+	}
+	return total
+}
+
+// DaysSince is the number of whole days between value and now.
+func DaysSince(value, now time.Time) int {
+	return int(now.Sub(value).Hours() / 24)
+}
+
+func formatDays(days int) string {
+	if days >= 365 && days%365 == 0 {
+		return fmt.Sprintf("%dy", days/365)
+	}
+	if days >= 30 && days%30 == 0 {
+		return fmt.Sprintf("%dmo", days/30)
+	}
+	return fmt.Sprintf("%dd", days)
+}
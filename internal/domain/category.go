@@ -0,0 +1,85 @@
+package domain
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type FileCategory string
+
+const (
+	CategoryImage      FileCategory = "image"
+	CategoryVideo      FileCategory = "video"
+	CategoryAudio      FileCategory = "audio"
+	CategoryDocument   FileCategory = "document"
+	CategoryArchive    FileCategory = "archive"
+	CategoryCode       FileCategory = "code"
+	CategoryData       FileCategory = "data"
+	CategoryExecutable FileCategory = "executable"
+	CategoryOther      FileCategory = "other"
+)
+
+var categoryExtensions = map[FileCategory][]string{
+	CategoryImage:      {"jpg", "jpeg", "png", "gif", "bmp", "tif", "tiff", "webp", "heic", "heif", "svg", "ico", "raw", "cr2", "nef", "arw", "dng", "psd", "xcf"},
+	CategoryVideo:      {"mp4", "m4v", "mkv", "mov", "avi", "wmv", "flv", "webm", "mpg", "mpeg", "3gp", "m2ts", "vob"},
+	CategoryAudio:      {"mp3", "m4a", "aac", "flac", "wav", "ogg", "oga", "opus", "wma", "aiff", "alac", "mid", "midi"},
+	CategoryDocument:   {"pdf", "doc", "docx", "odt", "rtf", "txt", "md", "rst", "tex", "xls", "xlsx", "ods", "ppt", "pptx", "odp", "epub", "mobi", "djvu", "pages", "numbers", "key"},
+	CategoryArchive:    {"zip", "tar", "gz", "tgz", "bz2", "tbz2", "xz", "txz", "zst", "lz4", "lzma", "7z", "rar", "iso", "dmg", "img", "deb", "rpm", "apk", "jar", "war", "whl", "cab"},
+	CategoryCode:       {"go", "c", "h", "cc", "cpp", "hpp", "cs", "java", "kt", "scala", "rs", "py", "rb", "php", "pl", "js", "mjs", "ts", "tsx", "jsx", "vue", "swift", "m", "sh", "bash", "zsh", "fish", "ps1", "lua", "r", "sql", "html", "htm", "css", "scss", "less", "mk", "cmake", "proto"},
+	CategoryData:       {"json", "yaml", "yml", "toml", "xml", "csv", "tsv", "ini", "conf", "cfg", "log", "db", "sqlite", "sqlite3", "parquet", "avro", "npy", "npz", "h5", "hdf5", "pkl", "bin", "dat"},
+	CategoryExecutable: {"exe", "dll", "so", "dylib", "a", "o", "lib", "ko", "sys", "msi", "app", "class", "pyc", "wasm"},
+}
+
+var extensionCategories = func() map[string]FileCategory {
+	byExt := make(map[string]FileCategory)
+	for _, category := range Categories {
+		for _, ext := range categoryExtensions[category] {
+			if _, taken := byExt[ext]; !taken {
+				byExt[ext] = category
+			}
+		}
+	}
+	return byExt
+}()
+
+// Categories lists every category in display order.
+var Categories = []FileCategory{
+	CategoryImage,
+	CategoryVideo,
+	CategoryAudio,
+	CategoryDocument,
+	CategoryArchive,
+	CategoryCode,
+	CategoryData,
+	CategoryExecutable,
+	CategoryOther,
+}
+
+// CategoryOf classifies a file by its extension.
+func CategoryOf(name string) FileCategory {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	if category, ok := extensionCategories[ext]; ok {
+		return category
+	}
+	return CategoryOther
+}
+
+// RankCategories returns the categories in totals, largest first.
+func RankCategories(totals map[FileCategory]UsageTotal) []FileCategory {
+	ranked := make([]FileCategory, 0, len(totals))
+	for category := range totals {
+		ranked = append(ranked, category)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		left, right := totals[ranked[i]], totals[ranked[j]]
+		if left.Bytes != right.Bytes {
+			return left.Bytes > right.Bytes
+		}
+		if left.Files != right.Files {
+			return left.Files > right.Files
+		}
+		return ranked[i] < ranked[j]
+	})
+	return ranked
+}
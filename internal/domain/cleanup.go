@@ -0,0 +1,63 @@
+package domain
+
+// CleanupRule describes nodes that are usually safe to remove. Pattern is a
+// glob matched against the node name. Marker, also a glob, names a file that
+// must sit next to the node, such as the package.json beside node_modules.
+// Zero limits are ignored.
+type CleanupRule struct {
+	Name       string `json:"name"`
+	Pattern    string `json:"pattern"`
+	Type       string `json:"type,omitempty"`
+	Marker     string `json:"marker,omitempty"`
+	MinAgeDays int    `json:"minAgeDays,omitempty"`
+	MinBytes   int64  `json:"minBytes,omitempty"`
+	Disabled   bool   `json:"disabled,omitempty"`
+}
+
+const (
+	RuleTypeDir  = "dir"
+	RuleTypeFile = "file"
+)
+
+// BuiltinCleanupRules are always evaluated unless a configured rule with the
+// same name replaces or disables them.
+var BuiltinCleanupRules = []CleanupRule{
+	{Name: "npm dependencies", Pattern: "node_modules", Type: RuleTypeDir, Marker: "package.json"},
+	{Name: "Rust build output", Pattern: "target", Type: RuleTypeDir, Marker: "Cargo.toml"},
+	{Name: "Maven build output", Pattern: "target", Type: RuleTypeDir, Marker: "pom.xml"},
+	{Name: "Gradle cache", Pattern: ".gradle", Type: RuleTypeDir, Marker: "*.gradle*"},
+	{Name: "Gradle build output", Pattern: "build", Type: RuleTypeDir, Marker: "build.gradle*"},
+	{Name: "Python bytecode", Pattern: "__pycache__", Type: RuleTypeDir},
+	{Name: "Python tool caches", Pattern: ".*_cache", Type: RuleTypeDir},
+	{Name: "tox environments", Pattern: ".tox", Type: RuleTypeDir, Marker: "tox.ini"},
+	{Name: "Next.js build cache", Pattern: ".next", Type: RuleTypeDir, Marker: "package.json"},
+	{Name: "Parcel cache", Pattern: ".parcel-cache", Type: RuleTypeDir},
+	{Name: "old logs", Pattern: "*.log", Type: RuleTypeFile, MinAgeDays: 30},
+	{Name: "old rotated logs", Pattern: "*.log.*", Type: RuleTypeFile, MinAgeDays: 30},
+}
+
+// MergeCleanupRules returns the built-in rules with configured rules applied:
+// a configured rule replaces the built-in rule of the same name, and
+// disabled rules are dropped.
+func MergeCleanupRules(configured []CleanupRule) []CleanupRule {
+	byName := make(map[string]CleanupRule, len(configured))
+	for _, rule := range configured {
+		byName[rule.Name] = rule
+	}
+	merged := make([]CleanupRule, 0, len(BuiltinCleanupRules)+len(configured))
+	for _, rule := range BuiltinCleanupRules {
+		if override, ok := byName[rule.Name]; ok {
+			rule = override
+			delete(byName, rule.Name)
+		}
+		if !rule.Disabled {
+			merged = append(merged, rule)
+		}
+	}
+	for _, rule := range configured {
+		if _, ok := byName[rule.Name]; ok && !rule.Disabled && rule.Pattern != "" {
+			merged = append(merged, rule)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,43 @@
+package domain
+
+import "testing"
+
+func TestMergeCleanupRules(t *testing.T) {
+	configured := []CleanupRule{
+		{Name: "old logs", Pattern: "*.log", Type: RuleTypeFile, MinAgeDays: 7},
+		{Name: "Python bytecode", Disabled: true},
+		{Name: "Terraform plugins", Pattern: ".terraform", Type: RuleTypeDir},
+		{Name: "no pattern", Type: RuleTypeDir},
+		{Name: "switched off", Pattern: "tmp", Disabled: true},
+	}
+	merged := MergeCleanupRules(configured)
+	if len(merged) != len(BuiltinCleanupRules) {
+		t.Fatalf("merged %d rules, want %d: one dropped, one added", len(merged), len(BuiltinCleanupRules))
+	}
+	byName := make(map[string]int, len(merged))
+	for index, rule := range merged {
+		byName[rule.Name] = index
+	}
+	if _, ok := byName["Python bytecode"]; ok {
+		t.Error("a disabled built-in rule was kept")
+	}
+	for _, name := range []string{"no pattern", "switched off"} {
+		if _, ok := byName[name]; ok {
+			t.Errorf("%q was added", name)
+		}
+	}
+	index, ok := byName["old logs"]
+	if !ok || merged[index].MinAgeDays != 7 {
+		t.Errorf("old logs was not replaced: %+v", merged[index])
+	}
+	// Second to last among the built-in rules, with one before it dropped.
+	if want := len(BuiltinCleanupRules) - 3; index != want {
+		t.Errorf("old logs moved to %d, want %d", index, want)
+	}
+	if last := merged[len(merged)-1]; last.Name != "Terraform plugins" {
+		t.Errorf("last rule %q, want the added one", last.Name)
+	}
+	if got := MergeCleanupRules(nil); len(got) != len(BuiltinCleanupRules) {
+		t.Errorf("no configured rules: %d, want every built-in rule", len(got))
+	}
+}
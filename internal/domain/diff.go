@@ -0,0 +1,128 @@
+package domain
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type ChangeKind string
+
+const (
+	ChangeNone    ChangeKind = ""
+	ChangeAdded   ChangeKind = "added"
+	ChangeRemoved ChangeKind = "removed"
+	ChangeGrown   ChangeKind = "grown"
+	ChangeShrunk  ChangeKind = "shrunk"
+)
+
+type NodeChange struct {
+	Path   string
+	Type   NodeType
+	Kind   ChangeKind
+	Before int64
+	After  int64
+}
+
+func (change NodeChange) Delta() int64 {
+	return change.After - change.Before
+}
+
+// TreeDiff holds the changed nodes between a baseline tree and the current
+// one, keyed by path. Unchanged nodes are left out.
+type TreeDiff struct {
+	Baseline time.Time
+	Changes  map[string]NodeChange
+	Added    int
+	Removed  int
+	Grown    int
+	Shrunk   int
+}
+
+// DiffTrees compares two trees by path. Sizes are the accumulated bytes of
+// directories and the size of files. Nodes missing from after count as
+// removed unless they sit below a directory after did not scan. Archive
+// members are left out since scans do not record them.
+func DiffTrees(before, after TreeIndex) TreeDiff {
+	diff := TreeDiff{Changes: make(map[string]NodeChange)}
+	for path, node := range after.Nodes {
+		if node.Archive != "" {
+			continue
+		}
+		change := NodeChange{Path: path, Type: node.Type, After: bytesOf(node)}
+		if previous, ok := before.Nodes[path]; ok {
+			change.Before = bytesOf(previous)
+			switch {
+			case change.After > change.Before:
+				change.Kind = ChangeGrown
+				diff.Grown++
+			case change.After < change.Before:
+				change.Kind = ChangeShrunk
+				diff.Shrunk++
+			default:
+				continue
+			}
+		} else {
+			change.Kind = ChangeAdded
+			diff.Added++
+		}
+		diff.Changes[path] = change
+	}
+	for path, node := range before.Nodes {
+		if _, ok := after.Nodes[path]; ok || !within(after.RootID, path) || !knownAbsent(after, path) {
+			continue
+		}
+		diff.Changes[path] = NodeChange{Path: path, Type: node.Type, Kind: ChangeRemoved, Before: bytesOf(node)}
+		diff.Removed++
+	}
+	return diff
+}
+
+func (diff TreeDiff) Change(path string) NodeChange {
+	if change, ok := diff.Changes[path]; ok {
+		return change
+	}
+	return NodeChange{Path: path}
+}
+
+// RemovedBelow counts the removed nodes under path and the bytes they held
+// at the baseline.
+func (diff TreeDiff) RemovedBelow(path string) (int, int64) {
+	count := 0
+	var bytes int64
+	for changedPath, change := range diff.Changes {
+		if change.Kind != ChangeRemoved || changedPath == path || !within(path, changedPath) {
+			continue
+		}
+		count++
+		if change.Type == NodeFile {
+			bytes += change.Before
+		}
+	}
+	return count, bytes
+}
+
+func knownAbsent(tree TreeIndex, path string) bool {
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if node, ok := tree.Nodes[dir]; ok {
+			return node.Type == NodeDir && node.Scanned && node.Skipped == SkipNone
+		}
+		if dir == filepath.Dir(dir) {
+			return false
+		}
+	}
+}
+
+func bytesOf(node *Node) int64 {
+	if node.Type == NodeDir {
+		return node.AccumBytes
+	}
+	return node.SizeBytes
+}
+
+func within(root, path string) bool {
+	if root == "" || root == path {
+		return root == path
+	}
+	return strings.HasPrefix(path, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator))
+}
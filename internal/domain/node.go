@@ -1,28 +1,68 @@
 package domain
 
-import "time"
+import (
+	"io/fs"
+	"time"
+)
 
 type NodeType int
 
 const (
 	NodeFile NodeType = iota
 	NodeDir
+	NodeSymlink
 )
 
 type Node struct {
-	ID          string
-	Name        string
-	Path        string
-	Type        NodeType
-	SizeBytes   int64
-	AccumBytes  int64
-	ModTime     time.Time
-	ParentID    string
-	ChildrenIDs []string
-	ChildCount  int
-	FileCount   int
-	DirCount    int
-	Scanned     bool
+	ID            string
+	Name          string
+	Path          string
+	Type          NodeType
+	SizeBytes     int64
+	AccumBytes    int64
+	SizeMode      SizeMode
+	SharedBytes   int64
+	Device        uint64
+	Inode         uint64
+	Links         int
+	Shared        bool
+	Skipped       SkipReason
+	FSType        string
+	ExcludedBy    string
+	IgnoreModTime time.Time
+	IgnoreSize    int64
+	ReadError     string
+	ErrorKind     ErrorKind
+	Incomplete    bool
+	Archive       string
+	PackedBytes   int64
+	UnpackedBytes int64
+	LinkTarget    string
+	BrokenLink    bool
+	Category      FileCategory
+	Categories    map[FileCategory]UsageTotal
+	Owners        map[uint32]UsageTotal
+	ModTime       time.Time
+	AccessTime    time.Time
+	NewestMod     time.Time
+	NewestAccess  time.Time
+	ModAges       AgeHistogram
+	Mode          fs.FileMode
+	UID           uint32
+	GID           uint32
+	ParentID      string
+	ChildrenIDs   []string
+	ChildCount    int
+	FileCount     int
+	DirCount      int
+	Scanned       bool
+}
+
+// UsageTotal is the bytes and file count a directory holds for one file
+// category or owner.
+type UsageTotal struct {
+	Bytes int64
+	Files int
 }
 
 type TreeIndex struct {
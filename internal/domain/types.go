@@ -3,7 +3,37 @@ package domain
 type SortMode string
 
 const (
-	SortBySize SortMode = "size"
-	SortByName SortMode = "name"
-	SortByMod  SortMode = "mod"
+	SortBySize   SortMode = "size"
+	SortByName   SortMode = "name"
+	SortByMod    SortMode = "mod"
+	SortByGrowth SortMode = "growth"
+	SortByCount  SortMode = "count"
+)
+
+type SkipReason string
+
+const (
+	SkipNone     SkipReason = ""
+	SkipMount    SkipReason = "mount"
+	SkipExcluded SkipReason = "excluded"
+	SkipDepth    SkipReason = "depth"
+	SkipLoop     SkipReason = "loop"
+	SkipLinked   SkipReason = "linked"
+)
+
+type SizeMode string
+
+const (
+	SizeApparent SizeMode = "apparent"
+	SizeDisk     SizeMode = "disk"
+)
+
+type ErrorKind string
+
+const (
+	ErrorNone       ErrorKind = ""
+	ErrorPermission ErrorKind = "permission"
+	ErrorVanished   ErrorKind = "vanished"
+	ErrorIO         ErrorKind = "io"
+	ErrorOther      ErrorKind = "other"
 )
@@ -0,0 +1,10 @@
+package fsinfo
+
+import (
+	"syscall"
+	"time"
+)
+
+func accessTime(sys *syscall.Stat_t) time.Time {
+	return time.Unix(int64(sys.Atim.Sec), int64(sys.Atim.Nsec))
+}
@@ -0,0 +1,62 @@
+package fsinfo
+
+import (
+	"os"
+	"time"
+
+	"sweepfs/internal/domain"
+)
+
+// Stat holds the platform specific fields SweepFS reads from a FileInfo.
+type Stat struct {
+	Blocks int64
+	Dev    uint64
+	Ino    uint64
+	Nlink  uint64
+	UID    uint32
+	GID    uint32
+	Atime  time.Time
+}
+
+// Of returns the platform stat fields for info. The boolean is false when the
+// platform does not expose them.
+func Of(info os.FileInfo) (Stat, bool) {
+	if info == nil {
+		return Stat{}, false
+	}
+	return fromSys(info)
+}
+
+// Size returns the size of info for the given mode. Disk mode reports the
+// allocated blocks and falls back to the apparent size when they are unknown.
+func Size(info os.FileInfo, mode domain.SizeMode) int64 {
+	if mode == domain.SizeDisk {
+		if stat, ok := Of(info); ok {
+			return stat.Blocks * 512
+		}
+	}
+	return info.Size()
+}
+
+// Apply copies the metadata of info onto node. Link counts are only recorded
+// for regular files, since directories always have several links.
+func Apply(node *domain.Node, info os.FileInfo) {
+	if node == nil || info == nil {
+		return
+	}
+	node.ModTime = info.ModTime()
+	node.Mode = info.Mode()
+	stat, ok := Of(info)
+	if !ok {
+		return
+	}
+	node.AccessTime = stat.Atime
+	node.UID = stat.UID
+	node.GID = stat.GID
+	node.Device = stat.Dev
+	node.Inode = stat.Ino
+	if node.Type == domain.NodeFile {
+		node.Links = int(stat.Nlink)
+		node.Shared = stat.Nlink > 1
+	}
+}
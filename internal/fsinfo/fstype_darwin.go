@@ -0,0 +1,20 @@
+package fsinfo
+
+import "syscall"
+
+// FSType returns the name of the filesystem that holds path, or an empty
+// string when it cannot be determined.
+func FSType(path string) string {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return ""
+	}
+	name := make([]byte, 0, len(stat.Fstypename))
+	for _, value := range stat.Fstypename {
+		if value == 0 {
+			break
+		}
+		name = append(name, byte(value))
+	}
+	return string(name)
+}
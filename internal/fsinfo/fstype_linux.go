@@ -0,0 +1,58 @@
+package fsinfo
+
+import (
+	"fmt"
+	"syscall"
+)
+
+var fsMagicNames = map[uint32]string{
+	0x0187:     "autofs",
+	0x00c36400: "ceph",
+	0x1cd1:     "devpts",
+	0x4d44:     "vfat",
+	0x6969:     "nfs",
+	0x9660:     "iso9660",
+	0x9fa0:     "proc",
+	0xef53:     "ext4",
+	0x01021994: "tmpfs",
+	0x19800202: "mqueue",
+	0x2011bab0: "exfat",
+	0x27e0eb:   "cgroup",
+	0x2fc12fc1: "zfs",
+	0x42494e4d: "binfmt_misc",
+	0x5346544e: "ntfs",
+	0x58465342: "xfs",
+	0x62656570: "configfs",
+	0x62656572: "sysfs",
+	0x63677270: "cgroup2",
+	0x64626720: "debugfs",
+	0x65735546: "fuse",
+	0x6165676c: "pstore",
+	0x6e736673: "nsfs",
+	0x73636673: "securityfs",
+	0x73717368: "squashfs",
+	0x74726163: "tracefs",
+	0x794c7630: "overlay",
+	0x858458f6: "ramfs",
+	0x9123683e: "btrfs",
+	0x958458f6: "hugetlbfs",
+	0xcafe4a11: "bpf",
+	0xde5e81e4: "efivarfs",
+	0xf2f52010: "f2fs",
+	0xfe534d42: "smb2",
+	0xff534d42: "cifs",
+}
+
+// FSType returns the name of the filesystem that holds path, or an empty
+// string when it cannot be determined.
+func FSType(path string) string {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return ""
+	}
+	magic := uint32(stat.Type)
+	if name, ok := fsMagicNames[magic]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%x", magic)
+}
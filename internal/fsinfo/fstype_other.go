@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package fsinfo
+
+// FSType returns the name of the filesystem that holds path, or an empty
+// string when it cannot be determined.
+func FSType(path string) string {
+	return ""
+}
@@ -0,0 +1,47 @@
+package fsinfo
+
+import "syscall"
+
+// mntNoWait asks getfsstat for cached statistics instead of querying every
+// filesystem, which can hang on unreachable network mounts.
+const mntNoWait = 2
+
+// Mounts lists the mounted filesystems with their statfs totals.
+func Mounts() ([]Mount, error) {
+	count, err := syscall.Getfsstat(nil, mntNoWait)
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]syscall.Statfs_t, count)
+	count, err = syscall.Getfsstat(stats, mntNoWait)
+	if err != nil {
+		return nil, err
+	}
+	mounts := []Mount{}
+	for index := range stats[:count] {
+		stat := &stats[index]
+		usage := usageOf(stat)
+		if usage.Total == 0 {
+			continue
+		}
+		mounts = append(mounts, Mount{
+			Path:     cString(stat.Mntonname[:]),
+			Source:   cString(stat.Mntfromname[:]),
+			FSType:   cString(stat.Fstypename[:]),
+			ReadOnly: stat.Flags&0x1 != 0,
+			Usage:    usage,
+		})
+	}
+	return mounts, nil
+}
+
+func cString(value []int8) string {
+	name := make([]byte, 0, len(value))
+	for _, char := range value {
+		if char == 0 {
+			break
+		}
+		name = append(name, byte(char))
+	}
+	return string(name)
+}
@@ -0,0 +1,88 @@
+package fsinfo
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Mounts lists the mounted filesystems from /proc/self/mountinfo with their
+// statfs totals. Filesystems without blocks, such as proc or sysfs, are left
+// out, and so is every mount but the last on the same mount point.
+func Mounts() ([]Mount, error) {
+	file, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	mounts := []Mount{}
+	index := make(map[string]int)
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		mount, ok := parseMountInfo(lines.Text())
+		if !ok {
+			continue
+		}
+		usage, ok := Usage(mount.Path)
+		if !ok || usage.Total == 0 {
+			continue
+		}
+		mount.Usage = usage
+		if position, ok := index[mount.Path]; ok {
+			mounts[position] = mount
+			continue
+		}
+		index[mount.Path] = len(mounts)
+		mounts = append(mounts, mount)
+	}
+	return mounts, lines.Err()
+}
+
+// parseMountInfo reads one mountinfo line: the mount point is the fifth
+// field, and the filesystem type and source follow the "-" separator.
+func parseMountInfo(line string) (Mount, bool) {
+	fields := strings.Fields(line)
+	separator := -1
+	for position, field := range fields {
+		if field == "-" && position >= 6 {
+			separator = position
+			break
+		}
+	}
+	if separator < 0 || len(fields) < separator+3 {
+		return Mount{}, false
+	}
+	mount := Mount{
+		Path:   unescapeMountField(fields[4]),
+		FSType: fields[separator+1],
+		Source: unescapeMountField(fields[separator+2]),
+	}
+	for _, option := range strings.Split(fields[5], ",") {
+		if option == "ro" {
+			mount.ReadOnly = true
+		}
+	}
+	return mount, true
+}
+
+// unescapeMountField decodes the octal escapes the kernel writes for spaces,
+// tabs, newlines and backslashes.
+func unescapeMountField(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	var builder strings.Builder
+	for position := 0; position < len(value); position++ {
+		if value[position] == '\\' && position+4 <= len(value) {
+			if code, err := strconv.ParseUint(value[position+1:position+4], 8, 8); err == nil {
+				builder.WriteByte(byte(code))
+				position += 3
+				continue
+			}
+		}
+		builder.WriteByte(value[position])
+	}
+	return builder.String()
+}
@@ -0,0 +1,45 @@
+package fsinfo
+
+import (
+	"os/user"
+	"strconv"
+	"sync"
+)
+
+var (
+	ownerMu    sync.Mutex
+	ownerNames = make(map[uint32]string)
+)
+
+// UserName resolves uid to a login name, falling back to the number. Results
+// are cached since a tree usually has only a handful of owners.
+func UserName(uid uint32) string {
+	ownerMu.Lock()
+	defer ownerMu.Unlock()
+	if name, ok := ownerNames[uid]; ok {
+		return name
+	}
+	id := strconv.FormatUint(uint64(uid), 10)
+	name := id
+	if found, err := user.LookupId(id); err == nil && found.Username != "" {
+		name = found.Username
+	}
+	ownerNames[uid] = name
+	return name
+}
+
+// LookupUID accepts a login name or a numeric uid.
+func LookupUID(value string) (uint32, bool) {
+	if uid, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return uint32(uid), true
+	}
+	found, err := user.Lookup(value)
+	if err != nil {
+		return 0, false
+	}
+	uid, err := strconv.ParseUint(found.Uid, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(uid), true
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package fsinfo
+
+import "os"
+
+func fromSys(info os.FileInfo) (Stat, bool) {
+	return Stat{}, false
+}
@@ -0,0 +1,24 @@
+//go:build linux || darwin
+
+package fsinfo
+
+import (
+	"os"
+	"syscall"
+)
+
+func fromSys(info os.FileInfo) (Stat, bool) {
+	sys, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return Stat{}, false
+	}
+	return Stat{
+		Blocks: int64(sys.Blocks),
+		Dev:    uint64(sys.Dev),
+		Ino:    uint64(sys.Ino),
+		Nlink:  uint64(sys.Nlink),
+		UID:    sys.Uid,
+		GID:    sys.Gid,
+		Atime:  accessTime(sys),
+	}, true
+}
@@ -0,0 +1,35 @@
+package fsinfo
+
+// DiskUsage is what statfs reports for the filesystem that holds a path.
+// Free counts the bytes available to unprivileged users, so Used + Free can
+// be less than Total on filesystems with reserved blocks.
+type DiskUsage struct {
+	Total      int64
+	Used       int64
+	Free       int64
+	Inodes     int64
+	InodesFree int64
+}
+
+// Mount is one mounted filesystem.
+type Mount struct {
+	Path     string
+	Source   string
+	FSType   string
+	ReadOnly bool
+	Usage    DiskUsage
+}
+
+func (usage DiskUsage) UsedShare() float64 {
+	if usage.Used+usage.Free <= 0 {
+		return 0
+	}
+	return float64(usage.Used) / float64(usage.Used+usage.Free)
+}
+
+func (usage DiskUsage) InodeShare() float64 {
+	if usage.Inodes <= 0 {
+		return 0
+	}
+	return float64(usage.Inodes-usage.InodesFree) / float64(usage.Inodes)
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package fsinfo
+
+import "errors"
+
+// Usage returns the size and free space of the filesystem that holds path.
+func Usage(path string) (DiskUsage, bool) {
+	return DiskUsage{}, false
+}
+
+// Mounts lists the mounted filesystems.
+func Mounts() ([]Mount, error) {
+	return nil, errors.New("mount listing is not supported on this platform")
+}
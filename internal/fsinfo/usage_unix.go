@@ -0,0 +1,25 @@
+//go:build linux || darwin
+
+package fsinfo
+
+import "syscall"
+
+// Usage returns the size and free space of the filesystem that holds path.
+func Usage(path string) (DiskUsage, bool) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return DiskUsage{}, false
+	}
+	return usageOf(&stat), true
+}
+
+func usageOf(stat *syscall.Statfs_t) DiskUsage {
+	blockSize := int64(stat.Bsize)
+	return DiskUsage{
+		Total:      int64(stat.Blocks) * blockSize,
+		Used:       int64(stat.Blocks-stat.Bfree) * blockSize,
+		Free:       int64(stat.Bavail) * blockSize,
+		Inodes:     int64(stat.Files),
+		InodesFree: int64(stat.Ffree),
+	}
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"sweepfs/internal/domain"
+)
+
+// applyAges sets the newest mtime and atime of every directory from the
+// nodes below it and sorts file bytes into modification-age buckets. Empty
+// directories keep their own times.
+func applyAges(nodes map[string]*domain.Node, now time.Time) {
+	paths := make([]string, 0, len(nodes))
+	for path := range nodes {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return depth(paths[i]) > depth(paths[j])
+	})
+
+	for _, path := range paths {
+		node := nodes[path]
+		if node.Type != domain.NodeDir {
+			continue
+		}
+		node.NewestMod = time.Time{}
+		node.NewestAccess = time.Time{}
+		node.ModAges = domain.AgeHistogram{}
+		for _, childID := range node.ChildrenIDs {
+			if child, ok := nodes[childID]; ok {
+				applyNewest(node, child)
+				node.ModAges = node.ModAges.Add(ageHistogram(child, now), 1)
+			}
+		}
+		if node.NewestMod.IsZero() {
+			node.NewestMod = node.ModTime
+		}
+		if node.NewestAccess.IsZero() {
+			node.NewestAccess = node.AccessTime
+		}
+	}
+}
+
+// ageHistogram is what node contributes to the age buckets of its ancestors.
+func ageHistogram(node *domain.Node, now time.Time) domain.AgeHistogram {
+	if node == nil {
+		return domain.AgeHistogram{}
+	}
+	if node.Type == domain.NodeDir {
+		return node.ModAges
+	}
+	var histogram domain.AgeHistogram
+	if bucket := domain.AgeBucket(node.ModTime, now); bucket >= 0 {
+		histogram[bucket] = node.AccumBytes
+	}
+	return histogram
+}
+
+// applyNewest moves the newest times of node forward to those of child.
+func applyNewest(node, child *domain.Node) {
+	modTime, accessTime := child.NewestMod, child.NewestAccess
+	if child.Type != domain.NodeDir {
+		modTime, accessTime = child.ModTime, child.AccessTime
+	}
+	if modTime.After(node.NewestMod) {
+		node.NewestMod = modTime
+	}
+	if accessTime.After(node.NewestAccess) {
+		node.NewestAccess = accessTime
+	}
+}
@@ -0,0 +1,480 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"sweepfs/internal/domain"
+)
+
+// ArchiveMember is one entry of a zip or tar archive. Name is a cleaned,
+// slash-separated path relative to the archive. Packed is the compressed
+// size where the format records it per entry, which tar does not.
+type ArchiveMember struct {
+	Name    string
+	Dir     bool
+	Link    bool
+	Size    int64
+	Packed  int64
+	ModTime time.Time
+	Mode    fs.FileMode
+}
+
+// ArchiveIndexer is implemented by scanners that can list the members of an
+// archive in the scanned tree as virtual nodes below the archive file.
+type ArchiveIndexer interface {
+	IndexArchive(ctx context.Context, path string) (int, error)
+}
+
+// IsArchive reports whether a file name has an extension SweepFS can read
+// as an archive.
+func IsArchive(name string) bool {
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// IndexArchive reads the archive at path and hangs its members below the
+// archive node of the cached tree, replacing an earlier index. Members do not
+// count towards the totals of the folders above the archive.
+func (scanner *FSScanner) IndexArchive(ctx context.Context, path string) (int, error) {
+	path = cleanPath(path)
+	members, err := readArchive(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	scanner.mu.Lock()
+	defer scanner.mu.Unlock()
+	node, ok := scanner.cache[path]
+	if !ok || node.Type != domain.NodeFile || node.Archive != "" {
+		return 0, fmt.Errorf("%s is not a file in the scanned tree", path)
+	}
+	attachArchive(scanner.cache, node, members)
+	return len(members), nil
+}
+
+// indexArchives indexes the archives below root that have no members yet.
+// Archives that cannot be read are reported as scan warnings.
+func (scanner *FSScanner) indexArchives(ctx context.Context, root string, progress chan<- ScanProgress) {
+	scanner.mu.RLock()
+	paths := []string{}
+	for path, node := range scanner.cache {
+		if node.Type == domain.NodeFile && node.Archive == "" && len(node.ChildrenIDs) == 0 && isWithin(root, path) && IsArchive(node.Name) {
+			paths = append(paths, path)
+		}
+	}
+	scanner.mu.RUnlock()
+	sort.Strings(paths)
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, err := scanner.IndexArchive(ctx, path); err != nil {
+			progressNonBlocking(progress, ScanProgress{Path: path, ErrMessage: err.Error()})
+		}
+	}
+}
+
+// attachArchive adds members as virtual nodes below archive. Folders that
+// only appear in member names are created, and folder totals cover the
+// uncompressed sizes below them.
+func attachArchive(nodes map[string]*domain.Node, archive *domain.Node, members []ArchiveMember) {
+	detachArchive(nodes, archive)
+	virtual := map[string]*domain.Node{archive.ID: archive}
+	var ensureDir func(name string) string
+	ensureDir = func(name string) string {
+		if name == "." {
+			return archive.ID
+		}
+		id := filepath.Join(archive.Path, filepath.FromSlash(name))
+		if _, ok := virtual[id]; !ok {
+			virtual[id] = &domain.Node{
+				ID:       id,
+				Name:     path.Base(name),
+				Path:     id,
+				Type:     domain.NodeDir,
+				SizeMode: archive.SizeMode,
+				ParentID: ensureDir(path.Dir(name)),
+				Archive:  archive.Path,
+				Scanned:  true,
+			}
+		}
+		return id
+	}
+	archive.UnpackedBytes = 0
+	for _, member := range members {
+		if member.Dir {
+			node := virtual[ensureDir(member.Name)]
+			node.ModTime = member.ModTime
+			node.Mode = member.Mode
+			continue
+		}
+		id := filepath.Join(archive.Path, filepath.FromSlash(member.Name))
+		if existing, ok := virtual[id]; ok && existing.Type == domain.NodeDir {
+			continue
+		}
+		virtual[id] = &domain.Node{
+			ID:          id,
+			Name:        path.Base(member.Name),
+			Path:        id,
+			Type:        domain.NodeFile,
+			SizeBytes:   member.Size,
+			SizeMode:    archive.SizeMode,
+			PackedBytes: member.Packed,
+			Category:    domain.CategoryOf(member.Name),
+			ModTime:     member.ModTime,
+			Mode:        member.Mode,
+			ParentID:    ensureDir(path.Dir(member.Name)),
+			Archive:     archive.Path,
+		}
+	}
+	archive.ChildrenIDs = nil
+	archive.ChildCount = 0
+	applyHierarchy(virtual)
+	applyAccumulation(virtual)
+	applyFileCounts(virtual)
+	applyDirCounts(virtual)
+	for id, node := range virtual {
+		if node.Type == domain.NodeFile && id != archive.ID {
+			archive.UnpackedBytes += node.SizeBytes
+		}
+		nodes[id] = node
+	}
+}
+
+// detachArchive drops the members of an indexed archive, for example when
+// the archive changed on disk.
+func detachArchive(nodes map[string]*domain.Node, archive *domain.Node) {
+	if len(archive.ChildrenIDs) == 0 {
+		return
+	}
+	for id, node := range nodes {
+		if node.Archive == archive.Path {
+			delete(nodes, id)
+		}
+	}
+	archive.ChildrenIDs = nil
+	archive.ChildCount = 0
+	archive.UnpackedBytes = 0
+}
+
+func readArchive(ctx context.Context, path string) ([]ArchiveMember, error) {
+	members := []ArchiveMember{}
+	err := walkArchive(ctx, path, func(member ArchiveMember, _ func() (io.ReadCloser, error)) error {
+		members = append(members, member)
+		return nil
+	})
+	return members, err
+}
+
+// walkArchive calls visit for every usable entry of a zip or tar archive in
+// order. Entries with unsafe names and special files are left out. open reads
+// the content of a regular file and is only valid during the call.
+func walkArchive(ctx context.Context, archivePath string, visit func(member ArchiveMember, open func() (io.ReadCloser, error)) error) error {
+	if !IsArchive(archivePath) {
+		return fmt.Errorf("%s: not a zip or tar archive", archivePath)
+	}
+	if strings.HasSuffix(strings.ToLower(archivePath), ".zip") {
+		return walkZip(ctx, archivePath, visit)
+	}
+	return walkTar(ctx, archivePath, visit)
+}
+
+func walkZip(ctx context.Context, archivePath string, visit func(ArchiveMember, func() (io.ReadCloser, error)) error) error {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	for _, file := range reader.File {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		name, ok := memberName(file.Name)
+		mode := file.Mode()
+		if !ok || !(mode.IsDir() || mode.IsRegular() || mode&fs.ModeSymlink != 0) {
+			continue
+		}
+		member := ArchiveMember{
+			Name:    name,
+			Dir:     mode.IsDir(),
+			Link:    mode&fs.ModeSymlink != 0,
+			ModTime: file.Modified,
+			Mode:    mode,
+		}
+		if !member.Dir {
+			member.Size = int64(file.UncompressedSize64)
+			member.Packed = int64(file.CompressedSize64)
+		}
+		if err := visit(member, file.Open); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkTar(ctx context.Context, archivePath string, visit func(ArchiveMember, func() (io.ReadCloser, error)) error) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var stream io.Reader = file
+	lower := strings.ToLower(archivePath)
+	if strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		stream = gzipReader
+	}
+	reader := tar.NewReader(stream)
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name, ok := memberName(header.Name)
+		if !ok {
+			continue
+		}
+		member := ArchiveMember{Name: name, ModTime: header.ModTime, Mode: header.FileInfo().Mode()}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			member.Dir = true
+		case tar.TypeReg, tar.TypeRegA:
+			member.Size = header.Size
+		case tar.TypeSymlink, tar.TypeLink:
+			member.Link = true
+		default:
+			continue
+		}
+		open := func() (io.ReadCloser, error) {
+			return io.NopCloser(reader), nil
+		}
+		if err := visit(member, open); err != nil {
+			return err
+		}
+	}
+}
+
+// memberName cleans an entry name into a relative slash path. Names with
+// ".." elements are rejected so that extraction cannot escape the target.
+func memberName(raw string) (string, bool) {
+	name := strings.TrimLeft(strings.ReplaceAll(raw, "\\", "/"), "/")
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", false
+		}
+	}
+	name = path.Clean(name)
+	if name == "." || name == "" {
+		return "", false
+	}
+	return name, true
+}
+
+// splitArchivePath splits the path of a virtual member node into the archive
+// file and the member name inside it.
+func splitArchivePath(memberPath string) (string, string, bool) {
+	for dir := filepath.Dir(memberPath); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		info, err := os.Stat(dir)
+		if err != nil {
+			continue
+		}
+		if !info.Mode().IsRegular() || !IsArchive(info.Name()) {
+			return "", "", false
+		}
+		rel, err := filepath.Rel(dir, memberPath)
+		if err != nil {
+			return "", "", false
+		}
+		return dir, filepath.ToSlash(rel), true
+	}
+	return "", "", false
+}
+
+// groupArchiveMembers maps each archive to the requested members inside it,
+// keeping the order of paths.
+func groupArchiveMembers(paths []string) ([]string, map[string][]string, error) {
+	archives := []string{}
+	members := make(map[string][]string)
+	for _, memberPath := range paths {
+		archive, member, ok := splitArchivePath(memberPath)
+		if !ok {
+			return nil, nil, fmt.Errorf("not an archive member: %s", memberPath)
+		}
+		if _, seen := members[archive]; !seen {
+			archives = append(archives, archive)
+		}
+		members[archive] = append(members[archive], member)
+	}
+	return archives, members, nil
+}
+
+// requestedMember returns the requested member that name is or lies below.
+func requestedMember(requested []string, name string) (string, bool) {
+	for _, member := range requested {
+		if name == member || strings.HasPrefix(name, member+"/") {
+			return member, true
+		}
+	}
+	return "", false
+}
+
+func previewExtract(ctx context.Context, preview *ActionPreview, paths []string) error {
+	archives, members, err := groupArchiveMembers(paths)
+	if err != nil {
+		return err
+	}
+	for _, archive := range archives {
+		err := walkArchive(ctx, archive, func(member ArchiveMember, _ func() (io.ReadCloser, error)) error {
+			if _, ok := requestedMember(members[archive], member.Name); !ok {
+				return nil
+			}
+			if member.Dir {
+				preview.TotalDirs++
+				return nil
+			}
+			preview.TotalFiles++
+			preview.TotalBytes += member.Size
+			if len(preview.Samples) < 5 {
+				preview.Samples = append(preview.Samples, filepath.Join(archive, filepath.FromSlash(member.Name)))
+			}
+			if member.Link {
+				preview.Warnings = append(preview.Warnings, fmt.Sprintf("links are not extracted: %s", member.Name))
+			}
+			return nil
+		})
+		if err != nil {
+			preview.Warnings = append(preview.Warnings, fmt.Sprintf("%s: %v", archive, err))
+		}
+	}
+	return nil
+}
+
+// extractPaths writes the requested members, and everything below member
+// folders, to destination. Each member lands under its base name like a copy.
+func (actions *FSActions) extractPaths(ctx context.Context, progress chan<- ActionProgress, paths []string, destination string) ActionResult {
+	result := ActionResult{Type: ActionExtract}
+	archives, members, err := groupArchiveMembers(paths)
+	destDir := false
+	if err == nil {
+		destination, destDir, err = resolveDestination(destination, paths)
+	}
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		result.Message = "extract failed"
+		return result
+	}
+	for _, archive := range archives {
+		targets := make(map[string]string)
+		requested := []string{}
+		for _, member := range members[archive] {
+			target := destination
+			if destDir {
+				target = filepath.Join(destination, path.Base(member))
+			}
+			if exists(target) {
+				result.FailureCount++
+				result.Errors = append(result.Errors, fmt.Sprintf("target exists: %s", target))
+				continue
+			}
+			targets[member] = target
+			requested = append(requested, member)
+		}
+		err := walkArchive(ctx, archive, func(member ArchiveMember, open func() (io.ReadCloser, error)) error {
+			root, ok := requestedMember(requested, member.Name)
+			if !ok {
+				return nil
+			}
+			if member.Link {
+				result.Skipped++
+				return nil
+			}
+			target := filepath.Join(targets[root], filepath.FromSlash(strings.TrimPrefix(member.Name, root)))
+			if err := extractMember(member, open, target); err != nil {
+				result.FailureCount++
+				result.Errors = append(result.Errors, err.Error())
+				return nil
+			}
+			if !member.Dir {
+				result.SuccessCount++
+			}
+			actionProgressNonBlocking(progress, ActionProgress{Type: ActionExtract, Current: target, Processed: result.SuccessCount + result.FailureCount})
+			return nil
+		})
+		if err != nil {
+			result.FailureCount++
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", archive, err))
+		}
+	}
+	if ctx.Err() != nil {
+		result.Message = "extract cancelled"
+		return result
+	}
+	result.Message = "extract complete"
+	return result
+}
+
+func extractMember(member ArchiveMember, open func() (io.ReadCloser, error), target string) error {
+	if member.Dir {
+		return os.MkdirAll(target, dirMode(member.Mode))
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	input, err := open()
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	perm := member.Mode.Perm()
+	if perm == 0 {
+		perm = 0o644
+	}
+	output, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(output, input); err != nil {
+		_ = output.Close()
+		return err
+	}
+	if err := output.Close(); err != nil {
+		return err
+	}
+	if !member.ModTime.IsZero() {
+		_ = os.Chtimes(target, time.Now(), member.ModTime)
+	}
+	return nil
+}
+
+func dirMode(mode fs.FileMode) fs.FileMode {
+	if mode.Perm() == 0 {
+		return 0o755
+	}
+	return mode.Perm() | 0o700
+}
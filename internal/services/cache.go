@@ -1,113 +1,296 @@
 package services
 
 import (
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"sweepfs/internal/domain"
+	"sweepfs/internal/fsinfo"
 )
 
-const cacheVersion = 1
-const maxCacheBytes = 50 * 1024 * 1024
+const (
+	maxCacheFiles    = 16
+	maxCacheDirBytes = 1 << 30
+)
 
-type cacheFile struct {
-	Version    int                 `json:"version"`
-	ShowHidden bool                `json:"showHidden"`
-	Entries    map[string]cacheEntry `json:"entries"`
+type cacheEntry struct {
+	Path          string
+	Name          string
+	Type          domain.NodeType
+	ModTime       int64
+	AccessTime    int64
+	Mode          uint32
+	UID           uint32
+	GID           uint32
+	SizeBytes     int64
+	AccumBytes    int64
+	SharedBytes   int64
+	Device        uint64
+	Inode         uint64
+	Links         int
+	Shared        bool
+	LinkTarget    string
+	BrokenLink    bool
+	Skipped       domain.SkipReason
+	FSType        string
+	ExcludedBy    string
+	IgnoreModTime int64
+	IgnoreSize    int64
+	ReadError     string
+	ErrorKind     domain.ErrorKind
+	Incomplete    bool
+	Category      domain.FileCategory
+	FileCount     int
+	DirCount      int
+	ChildCount    int
+	Children      []string
+	ParentID      string
 }
 
-type cacheEntry struct {
-	Path       string     `json:"path"`
-	Name       string     `json:"name"`
-	Type       domain.NodeType `json:"type"`
-	ModTime    int64      `json:"modTime"`
-	SizeBytes  int64      `json:"sizeBytes"`
-	AccumBytes int64      `json:"accumBytes"`
-	FileCount  int        `json:"fileCount"`
-	DirCount   int        `json:"dirCount"`
-	ChildCount int        `json:"childCount"`
-	Children   []string   `json:"children"`
-	ParentID   string     `json:"parentId"`
-}
-
-func cacheFilePath() (string, error) {
+func cacheDirPath() (string, error) {
 	base, err := os.UserCacheDir()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(base, "sweepfs", "cache.json"), nil
+	return filepath.Join(base, "sweepfs", "roots"), nil
+}
+
+// cacheKey names the cache file for a scan root and the options that shape
+// the tree, so scans with different options never share a file.
+func cacheKey(root string, req ScanRequest) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%t\x00%s\x00%t\x00%d\x00%t\x00%t", root, req.ShowHidden, req.SizeMode, req.OneFileSystem, req.MaxDepth, req.SniffTypes, req.FollowSymlinks)
+	for _, pattern := range req.Exclude {
+		fmt.Fprintf(hash, "\x00%s", pattern)
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
+
+func (scanner *FSScanner) cacheFile(root string, req ScanRequest) string {
+	return filepath.Join(scanner.cacheDir, cacheKey(root, req)+".bin")
 }
 
-func (scanner *FSScanner) loadCache() error {
+// loadCache loads the cache file for root, falling back to the file of the
+// nearest cached ancestor. Depth-limited scans only use their own file since
+// the limit is relative to the scan root.
+func (scanner *FSScanner) loadCache(root string, req ScanRequest) error {
 	scanner.mu.Lock()
 	defer scanner.mu.Unlock()
-	if scanner.cacheLoaded || scanner.cachePath == "" {
-		scanner.cacheLoaded = true
+	if scanner.cacheDir == "" {
 		return nil
 	}
-	info, err := os.Stat(scanner.cachePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			scanner.cacheLoaded = true
+	key := cacheKey(root, req)
+	if key == scanner.cacheKey {
+		return nil
+	}
+	scanner.cacheKey = key
+	scanner.cacheEntries = nil
+	scanner.cacheCheck = nil
+
+	for dir := root; ; dir = filepath.Dir(dir) {
+		path := scanner.cacheFile(dir, req)
+		header, entries, err := readCacheFile(path)
+		switch {
+		case err == nil && header.Root == dir:
+			for stale := range scanner.stale {
+				for entryPath := range entries {
+					if isWithin(stale, entryPath) {
+						delete(entries, entryPath)
+					}
+				}
+			}
+			scanner.cacheEntries = entries
+			scanner.cacheCheck = &cacheValidity{}
+			scanner.cacheHiddenFlag = header.ShowHidden
+			scanner.cacheSizeMode = normalizeSizeMode(header.SizeMode)
+			scanner.cacheOneFS = header.OneFileSystem
+			scanner.cacheFollow = header.FollowSymlinks
+			scanner.cacheExclude = header.Exclude
+			scanner.cacheMaxDepth = header.MaxDepth
+			scanner.cacheSniff = header.SniffTypes
+			now := time.Now()
+			_ = os.Chtimes(path, now, now)
+			return nil
+		case errors.Is(err, errCacheCorrupt) || errors.Is(err, errCacheVersion):
+			_ = os.Remove(path)
+		case err != nil && !os.IsNotExist(err):
+			return err
+		}
+		if req.MaxDepth > 0 || dir == filepath.Dir(dir) {
 			return nil
 		}
-		return err
 	}
-	if info.Size() > maxCacheBytes {
-		return fmt.Errorf("cache too large")
+}
+
+func readCacheFile(path string) (cacheHeader, map[string]cacheEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cacheHeader{}, nil, err
+	}
+	return decodeCache(data)
+}
+
+func (scanner *FSScanner) saveCache(root string, nodes map[string]*domain.Node, req ScanRequest) {
+	if scanner.cacheDir == "" && scanner.historyDir == "" {
+		return
+	}
+	entries := make(map[string]cacheEntry, len(nodes))
+	for path, node := range nodes {
+		entries[path] = newCacheEntry(node)
+	}
+	header := newCacheHeader(root, req)
+	data := encodeCache(header, entries)
+	scanner.saveSnapshot(root, req, header.Created, data)
+	if scanner.cacheDir == "" {
+		return
 	}
-	data, err := os.ReadFile(scanner.cachePath)
+	if err := writeFileAtomic(scanner.cacheFile(root, req), data); err != nil {
+		return
+	}
+	evictCache(scanner.cacheDir, maxCacheFiles, maxCacheDirBytes)
+
+	scanner.mu.Lock()
+	defer scanner.mu.Unlock()
+	for stale := range scanner.stale {
+		if isWithin(root, stale) {
+			delete(scanner.stale, stale)
+		}
+	}
+	scanner.cacheKey = cacheKey(root, req)
+	scanner.cacheEntries = entries
+	scanner.cacheCheck = &cacheValidity{}
+	scanner.cacheHiddenFlag = req.ShowHidden
+	scanner.cacheSizeMode = req.SizeMode
+	scanner.cacheOneFS = req.OneFileSystem
+	scanner.cacheFollow = req.FollowSymlinks
+	scanner.cacheExclude = req.Exclude
+	scanner.cacheMaxDepth = req.MaxDepth
+	scanner.cacheSniff = req.SniffTypes
+}
+
+func newCacheHeader(root string, req ScanRequest) cacheHeader {
+	return cacheHeader{
+		Root:           root,
+		ShowHidden:     req.ShowHidden,
+		SizeMode:       req.SizeMode,
+		OneFileSystem:  req.OneFileSystem,
+		FollowSymlinks: req.FollowSymlinks,
+		Exclude:        req.Exclude,
+		MaxDepth:       req.MaxDepth,
+		SniffTypes:     req.SniffTypes,
+		Created:        time.Now(),
+	}
+}
+
+func newCacheEntry(node *domain.Node) cacheEntry {
+	return cacheEntry{
+		Path:          node.Path,
+		Name:          node.Name,
+		Type:          node.Type,
+		ModTime:       unixNano(node.ModTime),
+		AccessTime:    unixNano(node.AccessTime),
+		Mode:          uint32(node.Mode),
+		UID:           node.UID,
+		GID:           node.GID,
+		SizeBytes:     node.SizeBytes,
+		AccumBytes:    node.AccumBytes,
+		SharedBytes:   node.SharedBytes,
+		Device:        node.Device,
+		Inode:         node.Inode,
+		Links:         node.Links,
+		Shared:        node.Shared,
+		LinkTarget:    node.LinkTarget,
+		BrokenLink:    node.BrokenLink,
+		Skipped:       node.Skipped,
+		FSType:        node.FSType,
+		ExcludedBy:    node.ExcludedBy,
+		IgnoreModTime: unixNano(node.IgnoreModTime),
+		IgnoreSize:    node.IgnoreSize,
+		ReadError:     node.ReadError,
+		ErrorKind:     node.ErrorKind,
+		Incomplete:    node.Incomplete,
+		Category:      node.Category,
+		FileCount:     node.FileCount,
+		DirCount:      node.DirCount,
+		ChildCount:    node.ChildCount,
+		Children:      append([]string{}, node.ChildrenIDs...),
+		ParentID:      node.ParentID,
+	}
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// into place, so readers never see a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
 	if err != nil {
 		return err
 	}
-	var cached cacheFile
-	if err := json.Unmarshal(data, &cached); err != nil {
+	tempPath := temp.Name()
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		os.Remove(tempPath)
 		return err
 	}
-	if cached.Version != cacheVersion {
-		return nil
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		os.Remove(tempPath)
+		return err
 	}
-	scanner.cacheEntries = cached.Entries
-	scanner.cacheHiddenFlag = cached.ShowHidden
-	scanner.cacheLoaded = true
-	return nil
+	if err := temp.Close(); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	if err := os.Chmod(tempPath, 0o600); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return os.Rename(tempPath, path)
 }
 
-func (scanner *FSScanner) saveCache(nodes map[string]*domain.Node, showHidden bool) {
-	if scanner.cachePath == "" {
+// evictCache removes the least recently used cache files until at most
+// maxFiles remain and they fit in maxBytes. Loading a file refreshes its
+// modification time.
+func evictCache(dir string, maxFiles int, maxBytes int64) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
 		return
 	}
-	entries := make(map[string]cacheEntry, len(nodes))
-	for path, node := range nodes {
-		entries[path] = cacheEntry{
-			Path:       node.Path,
-			Name:       node.Name,
-			Type:       node.Type,
-			ModTime:    node.ModTime.UnixNano(),
-			SizeBytes:  node.SizeBytes,
-			AccumBytes: node.AccumBytes,
-			FileCount:  node.FileCount,
-			DirCount:   node.DirCount,
-			ChildCount: node.ChildCount,
-			Children:   append([]string{}, node.ChildrenIDs...),
-			ParentID:   node.ParentID,
+	files := make([]fs.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".bin" {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			files = append(files, info)
 		}
 	}
-	file := cacheFile{Version: cacheVersion, ShowHidden: showHidden, Entries: entries}
-	data, err := json.Marshal(file)
-	if err != nil || len(data) > maxCacheBytes {
-		return
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().After(files[j].ModTime())
+	})
+	var total int64
+	for index, info := range files {
+		total += info.Size()
+		if index < maxFiles && total <= maxBytes {
+			continue
+		}
+		_ = os.Remove(filepath.Join(dir, info.Name()))
 	}
-	_ = os.MkdirAll(filepath.Dir(scanner.cachePath), 0o755)
-	_ = os.WriteFile(scanner.cachePath, data, 0o600)
 }
 
-func (scanner *FSScanner) canReuseRoot(path string, showHidden bool) bool {
+func (scanner *FSScanner) canReuseRoot(path string, req ScanRequest) bool {
 	scanner.mu.RLock()
 	entries := scanner.cacheEntries
 	scanner.mu.RUnlock()
@@ -118,45 +301,178 @@ func (scanner *FSScanner) canReuseRoot(path string, showHidden bool) bool {
 	if !ok {
 		return false
 	}
-	if entry.Type != domain.NodeDir {
-		return false
-	}
-	if !scanner.cacheShowHidden(showHidden) {
+	if entry.Type != domain.NodeDir || entry.Skipped != domain.SkipNone || entry.Incomplete {
 		return false
 	}
-	info, err := os.Stat(path)
-	if err != nil {
+	if !scanner.cacheMatches(req) {
 		return false
 	}
-	return entry.ModTime == info.ModTime().UnixNano()
+	return scanner.unchangedDirs()[path]
 }
 
-func (scanner *FSScanner) canReuseDir(path string, entry os.DirEntry, showHidden bool) bool {
+func (scanner *FSScanner) canReuseDir(path string, req ScanRequest) bool {
 	scanner.mu.RLock()
 	entries := scanner.cacheEntries
 	scanner.mu.RUnlock()
 	if entries == nil {
 		return false
 	}
-	if !scanner.cacheShowHidden(showHidden) {
+	cached, ok := entries[path]
+	if !ok || cached.Type != domain.NodeDir || cached.Skipped != domain.SkipNone || cached.Incomplete {
 		return false
 	}
-	info, err := entry.Info()
-	if err != nil {
+	return scanner.unchangedDirs()[path]
+}
+
+// cacheValidity holds which cached folders have nothing changed below them.
+// It is worked out once per set of cache entries, on first use.
+type cacheValidity struct {
+	once      sync.Once
+	unchanged map[string]bool
+}
+
+func (scanner *FSScanner) unchangedDirs() map[string]bool {
+	scanner.mu.RLock()
+	check := scanner.cacheCheck
+	entries := scanner.cacheEntries
+	mode := scanner.cacheSizeMode
+	scanner.mu.RUnlock()
+	if check == nil {
+		return nil
+	}
+	check.once.Do(func() {
+		check.unchanged = checkCachedTree(entries, mode)
+	})
+	return check.unchanged
+}
+
+// checkCachedTree stats every cached entry once and marks, bottom-up, the
+// folders whose whole subtree is unchanged. A folder's mtime only changes
+// with its own entries and a file can grow in place, so every folder's mtime
+// and every file's size and mtime count. Placeholders keep their cached
+// state and are not checked. An ignore file is hidden and edited in place
+// without touching its folder, so it is compared on its own, and once it
+// changes no folder below it is reused either: its rules decide what is
+// excluded all the way down.
+func checkCachedTree(entries map[string]cacheEntry, mode domain.SizeMode) map[string]bool {
+	paths := make([]string, 0, len(entries))
+	for path, entry := range entries {
+		if entry.Skipped == domain.SkipNone {
+			paths = append(paths, path)
+		}
+	}
+	same := make([]bool, len(paths))
+	rules := make([]bool, len(paths))
+	next := int64(-1)
+	var wg sync.WaitGroup
+	for worker := 0; worker < scanConcurrency(0); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				index := int(atomic.AddInt64(&next, 1))
+				if index >= len(paths) {
+					return
+				}
+				path, entry := paths[index], entries[paths[index]]
+				rules[index] = entry.Type != domain.NodeDir || ignoreFileUnchanged(path, entry)
+				same[index] = rules[index] && entryUnchanged(path, entry, mode)
+			}
+		}()
+	}
+	wg.Wait()
+	own := make(map[string]bool, len(paths))
+	ownRules := make(map[string]bool, len(paths))
+	for index, path := range paths {
+		own[path] = same[index]
+		ownRules[path] = rules[index]
+	}
+
+	subtree := make(map[string]bool)
+	var check func(path string) bool
+	check = func(path string) bool {
+		if result, ok := subtree[path]; ok {
+			return result
+		}
+		result := own[path]
+		for _, child := range entries[path].Children {
+			if !result {
+				break
+			}
+			entry, ok := entries[child]
+			switch {
+			case !ok:
+				result = false
+			case entry.Skipped != domain.SkipNone:
+			case entry.Type == domain.NodeDir:
+				result = check(child)
+			default:
+				result = own[child]
+			}
+		}
+		subtree[path] = result
+		return result
+	}
+	rulesKept := make(map[string]bool)
+	var kept func(path string) bool
+	kept = func(path string) bool {
+		if result, ok := rulesKept[path]; ok {
+			return result
+		}
+		result := ownRules[path]
+		if parent, ok := entries[entries[path].ParentID]; ok && parent.Type == domain.NodeDir {
+			result = result && kept(parent.Path)
+		}
+		rulesKept[path] = result
+		return result
+	}
+	unchanged := make(map[string]bool)
+	for path, entry := range entries {
+		if entry.Type == domain.NodeDir && entry.Skipped == domain.SkipNone {
+			unchanged[path] = check(path) && kept(path)
+		}
+	}
+	return unchanged
+}
+
+// entryUnchanged compares one cached entry with the filesystem. Folders
+// behind a followed link are compared with their target.
+func entryUnchanged(path string, entry cacheEntry, mode domain.SizeMode) bool {
+	if entry.Incomplete {
 		return false
 	}
-	cached, ok := entries[path]
-	if !ok || cached.Type != domain.NodeDir {
+	stat := os.Lstat
+	if entry.LinkTarget != "" && entry.Type != domain.NodeSymlink {
+		stat = os.Stat
+	}
+	info, err := stat(path)
+	if err != nil || info.ModTime().UnixNano() != entry.ModTime {
 		return false
 	}
-	return cached.ModTime == info.ModTime().UnixNano()
+	return entry.Type == domain.NodeDir || fsinfo.Size(info, mode) == entry.SizeBytes
 }
 
-func (scanner *FSScanner) cacheShowHidden(showHidden bool) bool {
+// ignoreFileUnchanged compares the ignore file in a cached folder with the
+// one read when the folder was walked.
+func ignoreFileUnchanged(dir string, entry cacheEntry) bool {
+	ignore, err := os.Stat(filepath.Join(dir, ignoreFileName))
+	if err != nil {
+		return os.IsNotExist(err) && entry.IgnoreModTime == 0 && entry.IgnoreSize == 0
+	}
+	return ignore.ModTime().UnixNano() == entry.IgnoreModTime && ignore.Size() == entry.IgnoreSize
+}
+
+func (scanner *FSScanner) cacheMatches(req ScanRequest) bool {
 	if scanner.cacheEntries == nil {
 		return false
 	}
-	return scanner.cacheHiddenFlag == showHidden
+	return scanner.cacheHiddenFlag == req.ShowHidden &&
+		scanner.cacheSizeMode == req.SizeMode &&
+		scanner.cacheOneFS == req.OneFileSystem &&
+		scanner.cacheFollow == req.FollowSymlinks &&
+		equalStrings(scanner.cacheExclude, req.Exclude) &&
+		scanner.cacheMaxDepth == req.MaxDepth &&
+		scanner.cacheSniff == req.SniffTypes
 }
 
 func (scanner *FSScanner) cachedTree(root string) map[string]*domain.Node {
@@ -169,7 +485,7 @@ func (scanner *FSScanner) cachedTree(root string) map[string]*domain.Node {
 		if !hasPathPrefix(root, path) {
 			continue
 		}
-		nodes[path] = entry.toNode()
+		nodes[path] = entry.toNode(scanner.cacheSizeMode)
 	}
 	return nodes
 }
@@ -182,28 +498,56 @@ func (scanner *FSScanner) mergeCachedSubtree(root string, nodes map[string]*doma
 	mu.Lock()
 	for path, entry := range entries {
 		if hasPathPrefix(root, path) {
-			nodes[path] = entry.toNode()
+			nodes[path] = entry.toNode(scanner.cacheSizeMode)
 		}
 	}
 	mu.Unlock()
 }
 
-func (entry cacheEntry) toNode() *domain.Node {
+func (entry cacheEntry) toNode(mode domain.SizeMode) *domain.Node {
 	return &domain.Node{
-		ID:          entry.Path,
-		Name:        entry.Name,
-		Path:        entry.Path,
-		Type:        entry.Type,
-		SizeBytes:   entry.SizeBytes,
-		AccumBytes:  entry.AccumBytes,
-		ModTime:     timeFrom(entry.ModTime),
-		ParentID:    entry.ParentID,
-		ChildrenIDs: append([]string{}, entry.Children...),
-		ChildCount:  entry.ChildCount,
-		FileCount:   entry.FileCount,
-		DirCount:    entry.DirCount,
-		Scanned:     entry.Type == domain.NodeDir,
+		ID:            entry.Path,
+		Name:          entry.Name,
+		Path:          entry.Path,
+		Type:          entry.Type,
+		SizeBytes:     entry.SizeBytes,
+		AccumBytes:    entry.AccumBytes,
+		SizeMode:      mode,
+		SharedBytes:   entry.SharedBytes,
+		Device:        entry.Device,
+		Inode:         entry.Inode,
+		Links:         entry.Links,
+		Shared:        entry.Shared,
+		LinkTarget:    entry.LinkTarget,
+		BrokenLink:    entry.BrokenLink,
+		Skipped:       entry.Skipped,
+		FSType:        entry.FSType,
+		ExcludedBy:    entry.ExcludedBy,
+		IgnoreModTime: timeFrom(entry.IgnoreModTime),
+		IgnoreSize:    entry.IgnoreSize,
+		ReadError:     entry.ReadError,
+		ErrorKind:     entry.ErrorKind,
+		Incomplete:    entry.Incomplete,
+		Category:      entry.Category,
+		ModTime:       timeFrom(entry.ModTime),
+		AccessTime:    timeFrom(entry.AccessTime),
+		Mode:          fs.FileMode(entry.Mode),
+		UID:           entry.UID,
+		GID:           entry.GID,
+		ParentID:      entry.ParentID,
+		ChildrenIDs:   append([]string{}, entry.Children...),
+		ChildCount:    entry.ChildCount,
+		FileCount:     entry.FileCount,
+		DirCount:      entry.DirCount,
+		Scanned:       entry.Type == domain.NodeDir && entry.Skipped == domain.SkipNone,
+	}
+}
+
+func unixNano(value time.Time) int64 {
+	if value.IsZero() {
+		return 0
 	}
+	return value.UnixNano()
 }
 
 func timeFrom(value int64) time.Time {
@@ -220,3 +564,15 @@ func hasPathPrefix(root, path string) bool {
 	rootWithSep := root + string(filepath.Separator)
 	return strings.HasPrefix(path, rootWithSep)
 }
+
+func equalStrings(left, right []string) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for index := range left {
+		if left[index] != right[index] {
+			return false
+		}
+	}
+	return true
+}
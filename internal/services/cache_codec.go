@@ -0,0 +1,302 @@
+package services
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"sweepfs/internal/domain"
+)
+
+// Cache files are a magic string and version followed by a header and the
+// entries in path order, every integer varint encoded and every string length
+// prefixed. Entries below another entry store only the index of their parent
+// and their name. A CRC32 of everything before it closes the file.
+const cacheMagic = "SWFC"
+const cacheVersion = 8
+
+var (
+	errCacheCorrupt = errors.New("cache file corrupt")
+	errCacheVersion = errors.New("cache version mismatch")
+)
+
+type cacheHeader struct {
+	Root           string
+	ShowHidden     bool
+	SizeMode       domain.SizeMode
+	OneFileSystem  bool
+	FollowSymlinks bool
+	Exclude        []string
+	MaxDepth       int
+	SniffTypes     bool
+	Created        time.Time
+}
+
+const (
+	entryShared     = 1
+	entryIncomplete = 2
+	entryBrokenLink = 4
+)
+
+func encodeCache(header cacheHeader, entries map[string]cacheEntry) []byte {
+	paths := make([]string, 0, len(entries))
+	for path := range entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	index := make(map[string]int, len(paths))
+
+	out := make([]byte, 0, 64+len(paths)*48)
+	out = append(out, cacheMagic...)
+	out = binary.AppendUvarint(out, cacheVersion)
+	out = appendString(out, header.Root)
+	out = appendBool(out, header.ShowHidden)
+	out = appendString(out, string(header.SizeMode))
+	out = appendBool(out, header.OneFileSystem)
+	out = appendBool(out, header.FollowSymlinks)
+	out = binary.AppendUvarint(out, uint64(len(header.Exclude)))
+	for _, pattern := range header.Exclude {
+		out = appendString(out, pattern)
+	}
+	out = binary.AppendVarint(out, int64(header.MaxDepth))
+	out = appendBool(out, header.SniffTypes)
+	out = binary.AppendVarint(out, unixNano(header.Created))
+	out = binary.AppendUvarint(out, uint64(len(paths)))
+
+	for position, path := range paths {
+		entry := entries[path]
+		index[path] = position
+		parent, hasParent := index[entry.ParentID]
+		if hasParent && filepath.Join(entry.ParentID, entry.Name) == path {
+			out = binary.AppendUvarint(out, uint64(parent+1))
+			out = appendString(out, entry.Name)
+		} else {
+			out = binary.AppendUvarint(out, 0)
+			out = appendString(out, entry.Path)
+			out = appendString(out, entry.Name)
+			out = appendString(out, entry.ParentID)
+		}
+		var flags byte
+		if entry.Shared {
+			flags |= entryShared
+		}
+		if entry.Incomplete {
+			flags |= entryIncomplete
+		}
+		if entry.BrokenLink {
+			flags |= entryBrokenLink
+		}
+		out = append(out, byte(entry.Type), flags)
+		out = appendString(out, string(entry.Skipped))
+		out = appendString(out, entry.FSType)
+		out = appendString(out, entry.ExcludedBy)
+		out = appendString(out, entry.ReadError)
+		out = appendString(out, string(entry.ErrorKind))
+		out = appendString(out, string(entry.Category))
+		out = appendString(out, entry.LinkTarget)
+		out = binary.AppendVarint(out, entry.ModTime)
+		out = binary.AppendVarint(out, entry.AccessTime)
+		out = binary.AppendVarint(out, entry.SizeBytes)
+		out = binary.AppendVarint(out, entry.AccumBytes)
+		out = binary.AppendVarint(out, entry.SharedBytes)
+		out = binary.AppendUvarint(out, uint64(entry.Mode))
+		out = binary.AppendUvarint(out, uint64(entry.UID))
+		out = binary.AppendUvarint(out, uint64(entry.GID))
+		out = binary.AppendUvarint(out, entry.Device)
+		out = binary.AppendUvarint(out, entry.Inode)
+		out = binary.AppendUvarint(out, uint64(entry.Links))
+		out = binary.AppendUvarint(out, uint64(entry.FileCount))
+		out = binary.AppendUvarint(out, uint64(entry.DirCount))
+		out = binary.AppendUvarint(out, uint64(entry.ChildCount))
+		out = binary.AppendVarint(out, entry.IgnoreModTime)
+		out = binary.AppendVarint(out, entry.IgnoreSize)
+	}
+	return binary.LittleEndian.AppendUint32(out, crc32.ChecksumIEEE(out))
+}
+
+func decodeCache(data []byte) (cacheHeader, map[string]cacheEntry, error) {
+	if len(data) < len(cacheMagic)+4 || string(data[:len(cacheMagic)]) != cacheMagic {
+		return cacheHeader{}, nil, errCacheCorrupt
+	}
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(data[len(data)-4:]) {
+		return cacheHeader{}, nil, errCacheCorrupt
+	}
+	reader := &cacheReader{data: body, offset: len(cacheMagic)}
+	if version := reader.uvarint(); version != cacheVersion {
+		return cacheHeader{}, nil, errCacheVersion
+	}
+
+	var header cacheHeader
+	header.Root = reader.string()
+	header.ShowHidden = reader.bool()
+	header.SizeMode = domain.SizeMode(reader.string())
+	header.OneFileSystem = reader.bool()
+	header.FollowSymlinks = reader.bool()
+	if count := reader.count(); count > 0 {
+		header.Exclude = make([]string, count)
+		for position := range header.Exclude {
+			header.Exclude[position] = reader.string()
+		}
+	}
+	header.MaxDepth = int(reader.varint())
+	header.SniffTypes = reader.bool()
+	header.Created = timeFrom(reader.varint())
+
+	count := reader.count()
+	list := make([]cacheEntry, 0, count)
+	parents := make([]int, 0, count)
+	for position := 0; position < count && reader.err == nil; position++ {
+		var entry cacheEntry
+		parent := int(reader.uvarint())
+		if parent > position {
+			return cacheHeader{}, nil, errCacheCorrupt
+		}
+		if parent > 0 {
+			entry.ParentID = list[parent-1].Path
+			entry.Name = reader.string()
+			entry.Path = entry.ParentID + string(filepath.Separator) + entry.Name
+			if entry.ParentID == string(filepath.Separator) {
+				entry.Path = entry.ParentID + entry.Name
+			}
+		} else {
+			entry.Path = reader.string()
+			entry.Name = reader.string()
+			entry.ParentID = reader.string()
+		}
+		entry.Type = domain.NodeType(reader.byte())
+		flags := reader.byte()
+		entry.Shared = flags&entryShared != 0
+		entry.Incomplete = flags&entryIncomplete != 0
+		entry.BrokenLink = flags&entryBrokenLink != 0
+		entry.Skipped = domain.SkipReason(reader.string())
+		entry.FSType = reader.string()
+		entry.ExcludedBy = reader.string()
+		entry.ReadError = reader.string()
+		entry.ErrorKind = domain.ErrorKind(reader.string())
+		entry.Category = domain.FileCategory(reader.string())
+		entry.LinkTarget = reader.string()
+		entry.ModTime = reader.varint()
+		entry.AccessTime = reader.varint()
+		entry.SizeBytes = reader.varint()
+		entry.AccumBytes = reader.varint()
+		entry.SharedBytes = reader.varint()
+		entry.Mode = uint32(reader.uvarint())
+		entry.UID = uint32(reader.uvarint())
+		entry.GID = uint32(reader.uvarint())
+		entry.Device = reader.uvarint()
+		entry.Inode = reader.uvarint()
+		entry.Links = int(reader.uvarint())
+		entry.FileCount = int(reader.uvarint())
+		entry.DirCount = int(reader.uvarint())
+		entry.ChildCount = int(reader.uvarint())
+		entry.IgnoreModTime = reader.varint()
+		entry.IgnoreSize = reader.varint()
+		list = append(list, entry)
+		parents = append(parents, parent-1)
+	}
+	if reader.err != nil || reader.offset != len(body) {
+		return cacheHeader{}, nil, errCacheCorrupt
+	}
+	for position, parent := range parents {
+		if parent >= 0 {
+			list[parent].Children = append(list[parent].Children, list[position].Path)
+		}
+	}
+	entries := make(map[string]cacheEntry, len(list))
+	for _, entry := range list {
+		entries[entry.Path] = entry
+	}
+	for position, parent := range parents {
+		entry := list[position]
+		if parent >= 0 || entry.ParentID == "" {
+			continue
+		}
+		if owner, ok := entries[entry.ParentID]; ok {
+			owner.Children = append(owner.Children, entry.Path)
+			entries[entry.ParentID] = owner
+		}
+	}
+	return header, entries, nil
+}
+
+type cacheReader struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (reader *cacheReader) uvarint() uint64 {
+	if reader.err != nil {
+		return 0
+	}
+	value, size := binary.Uvarint(reader.data[reader.offset:])
+	if size <= 0 {
+		reader.err = errCacheCorrupt
+		return 0
+	}
+	reader.offset += size
+	return value
+}
+
+func (reader *cacheReader) varint() int64 {
+	if reader.err != nil {
+		return 0
+	}
+	value, size := binary.Varint(reader.data[reader.offset:])
+	if size <= 0 {
+		reader.err = errCacheCorrupt
+		return 0
+	}
+	reader.offset += size
+	return value
+}
+
+func (reader *cacheReader) count() int {
+	value := reader.uvarint()
+	if value > uint64(len(reader.data)) {
+		reader.err = errCacheCorrupt
+		return 0
+	}
+	return int(value)
+}
+
+func (reader *cacheReader) byte() byte {
+	if reader.err != nil || reader.offset >= len(reader.data) {
+		reader.err = errCacheCorrupt
+		return 0
+	}
+	value := reader.data[reader.offset]
+	reader.offset++
+	return value
+}
+
+func (reader *cacheReader) bool() bool {
+	return reader.byte() != 0
+}
+
+func (reader *cacheReader) string() string {
+	length := reader.count()
+	if reader.err != nil || reader.offset+length > len(reader.data) {
+		reader.err = errCacheCorrupt
+		return ""
+	}
+	value := string(reader.data[reader.offset : reader.offset+length])
+	reader.offset += length
+	return value
+}
+
+func appendString(out []byte, value string) []byte {
+	out = binary.AppendUvarint(out, uint64(len(value)))
+	return append(out, value...)
+}
+
+func appendBool(out []byte, value bool) []byte {
+	if value {
+		return append(out, 1)
+	}
+	return append(out, 0)
+}
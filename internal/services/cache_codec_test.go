@@ -0,0 +1,143 @@
+package services
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"sweepfs/internal/domain"
+)
+
+func testCacheEntries() map[string]cacheEntry {
+	root := filepath.Join(string(filepath.Separator), "data")
+	child := func(parent, name string) string {
+		return filepath.Join(parent, name)
+	}
+	src := child(root, "src")
+	return map[string]cacheEntry{
+		root: {
+			Path: root, Name: "data", Type: domain.NodeDir, Mode: uint32(fs.ModeDir | 0o755),
+			ModTime:    time.Date(2024, 3, 1, 12, 0, 0, 123456789, time.UTC).UnixNano(),
+			AccumBytes: 12345, SharedBytes: 4096, FileCount: 3, DirCount: 2, ChildCount: 3,
+			Children: []string{child(root, "link"), child(root, "mnt"), src},
+		},
+		src: {
+			Path: src, Name: "src", ParentID: root, Type: domain.NodeDir, ReadError: "permission denied",
+			ErrorKind: domain.ErrorPermission, Incomplete: true, ChildCount: 1,
+			IgnoreModTime: time.Date(2024, 2, 1, 8, 0, 0, 0, time.UTC).UnixNano(), IgnoreSize: 14,
+			Children: []string{child(src, "héllo wörld.txt")},
+		},
+		child(src, "héllo wörld.txt"): {
+			Path: child(src, "héllo wörld.txt"), Name: "héllo wörld.txt", ParentID: src, Type: domain.NodeFile,
+			SizeBytes: 8192, AccumBytes: 8192, Shared: true, Links: 3, Device: 1 << 40, Inode: 1<<63 + 5,
+			UID: 1000, GID: 100, Category: domain.CategoryOf("héllo wörld.txt"),
+			ModTime: -86400 * 1e9, AccessTime: 1,
+		},
+		child(root, "link"): {
+			Path: child(root, "link"), Name: "link", ParentID: root, Type: domain.NodeSymlink,
+			LinkTarget: "../missing", BrokenLink: true,
+		},
+		child(root, "mnt"): {
+			Path: child(root, "mnt"), Name: "mnt", ParentID: root, Type: domain.NodeDir,
+			Skipped: domain.SkipMount, FSType: "nfs",
+		},
+		// Kept from an earlier scan of a sibling root: stored with its full path.
+		filepath.Join(string(filepath.Separator), "other", "x"): {
+			Path: filepath.Join(string(filepath.Separator), "other", "x"), Name: "x",
+			ParentID: filepath.Join(string(filepath.Separator), "other"), Type: domain.NodeDir,
+			Skipped: domain.SkipExcluded, ExcludedBy: "config: x",
+		},
+	}
+}
+
+func TestCacheCodecRoundTrip(t *testing.T) {
+	header := cacheHeader{
+		Root:           filepath.Join(string(filepath.Separator), "data"),
+		ShowHidden:     true,
+		SizeMode:       domain.SizeDisk,
+		OneFileSystem:  true,
+		FollowSymlinks: true,
+		Exclude:        []string{"node_modules", "!keep", "*.log"},
+		MaxDepth:       -1,
+		SniffTypes:     true,
+		Created:        time.Unix(1700000000, 42),
+	}
+	entries := testCacheEntries()
+	gotHeader, gotEntries, err := decodeCache(encodeCache(header, entries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gotHeader.Created.Equal(header.Created) {
+		t.Errorf("created %v, want %v", gotHeader.Created, header.Created)
+	}
+	gotHeader.Created = header.Created
+	if !reflect.DeepEqual(gotHeader, header) {
+		t.Errorf("header %+v, want %+v", gotHeader, header)
+	}
+	if len(gotEntries) != len(entries) {
+		t.Errorf("decoded %d entries, want %d", len(gotEntries), len(entries))
+	}
+	for path, want := range entries {
+		if got := gotEntries[path]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s:\n got %+v\nwant %+v", path, got, want)
+		}
+	}
+
+	empty := cacheHeader{Root: string(filepath.Separator)}
+	gotHeader, gotEntries, err = decodeCache(encodeCache(empty, nil))
+	if err != nil || len(gotEntries) != 0 || gotHeader.Root != empty.Root || gotHeader.Exclude != nil {
+		t.Errorf("empty cache: %+v, %d entries, %v", gotHeader, len(gotEntries), err)
+	}
+}
+
+// resealed replaces the checksum of an encoded cache after body was edited.
+func resealed(body []byte) []byte {
+	out := append([]byte{}, body...)
+	return binary.LittleEndian.AppendUint32(out, crc32.ChecksumIEEE(out))
+}
+
+func TestDecodeCacheRejectsMalformedInput(t *testing.T) {
+	valid := encodeCache(cacheHeader{Root: "/data", Created: time.Now()}, testCacheEntries())
+	body := valid[:len(valid)-4]
+	flipped := append([]byte{}, valid...)
+	flipped[len(flipped)/2] ^= 0xff
+	wrongVersion := append([]byte{}, body...)
+	wrongVersion[len(cacheMagic)] = cacheVersion + 1
+	// A header with root "/" and every other field zero, then two entries the
+	// first of which names a parent that would come after it.
+	forwardParent := []byte(cacheMagic)
+	forwardParent = binary.AppendUvarint(forwardParent, cacheVersion)
+	forwardParent = append(forwardParent, 1, '/', 0, 0, 0, 0, 0, 0, 0, 0)
+	forwardParent = binary.AppendUvarint(forwardParent, 2)
+	forwardParent = binary.AppendUvarint(forwardParent, 5)
+	hugeCount := []byte(cacheMagic)
+	hugeCount = binary.AppendUvarint(hugeCount, cacheVersion)
+	hugeCount = binary.AppendUvarint(hugeCount, 1<<40)
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, errCacheCorrupt},
+		{"magic only", []byte(cacheMagic), errCacheCorrupt},
+		{"bad magic", append([]byte("NOPE"), valid[4:]...), errCacheCorrupt},
+		{"flipped byte", flipped, errCacheCorrupt},
+		{"truncated", valid[:len(valid)-9], errCacheCorrupt},
+		{"truncated and resealed", resealed(body[:len(body)-9]), errCacheCorrupt},
+		{"trailing bytes", resealed(append(append([]byte{}, body...), 0)), errCacheCorrupt},
+		{"other version", resealed(wrongVersion), errCacheVersion},
+		{"forward parent", resealed(forwardParent), errCacheCorrupt},
+		{"huge count", resealed(hugeCount), errCacheCorrupt},
+	}
+	for _, test := range tests {
+		if _, _, err := decodeCache(test.data); !errors.Is(err, test.want) {
+			t.Errorf("%s: %v, want %v", test.name, err, test.want)
+		}
+	}
+}
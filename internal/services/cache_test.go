@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sweepfs/internal/domain"
+)
+
+func newTestScanner(t *testing.T, cacheDir string) *FSScanner {
+	t.Helper()
+	return &FSScanner{
+		cache:       make(map[string]*domain.Node),
+		scannedDirs: make(map[string]bool),
+		cacheDir:    filepath.Join(cacheDir, "roots"),
+		historyDir:  filepath.Join(cacheDir, "history"),
+		stale:       make(map[string]bool),
+		scanErrors:  make(map[string]ScanError),
+		hashes:      newHashCache(""),
+		updates:     make(chan TreeUpdate, 1),
+	}
+}
+
+func scanTotal(t *testing.T, scanner *FSScanner, req ScanRequest) int64 {
+	t.Helper()
+	result, err := scanner.Scan(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scanner.Snapshot().Nodes[result.RootPath].AccumBytes
+}
+
+// Neither a file growing in place nor a file added two levels down changes
+// the mtime of the folders above, so a rescan must not reuse them blindly.
+func TestRescanNoticesChangesBelowUnchangedFolders(t *testing.T) {
+	cacheDir := t.TempDir()
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a", "b", "f"), 100)
+	req := ScanRequest{RootPath: root, Concurrency: 1}
+	if got := scanTotal(t, newTestScanner(t, cacheDir), req); got != 100 {
+		t.Fatalf("first scan: %d bytes, want 100", got)
+	}
+
+	rootInfo, err := os.Stat(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aInfo, err := os.Stat(filepath.Join(root, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(root, "a", "b", "g"), 4000)
+	writeFile(t, filepath.Join(root, "a", "b", "f"), 10000)
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(filepath.Join(root, "a", "b", "f"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []struct {
+		path string
+		info os.FileInfo
+	}{{root, rootInfo}, {filepath.Join(root, "a"), aInfo}} {
+		if err := os.Chtimes(dir.path, dir.info.ModTime(), dir.info.ModTime()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, workers := range []int{1, 4} {
+		req.Concurrency = workers
+		if got := scanTotal(t, newTestScanner(t, cacheDir), req); got != 14000 {
+			t.Errorf("rescan with %d workers: %d bytes, want 14000", workers, got)
+		}
+	}
+}
+
+// Hardlinks are counted once per scan root, so a folder scanned on its own
+// from the cache of its parent must own the links it holds.
+func TestAncestorCacheRecountsHardlinks(t *testing.T) {
+	cacheDir := t.TempDir()
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a", "f"), 1000)
+	if err := os.Mkdir(filepath.Join(root, "b"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(root, "a", "f"), filepath.Join(root, "b", "f")); err != nil {
+		t.Skipf("hardlinks unavailable: %v", err)
+	}
+	if got := scanTotal(t, newTestScanner(t, cacheDir), ScanRequest{RootPath: root}); got != 1000 {
+		t.Fatalf("root: %d bytes, want 1000", got)
+	}
+	if got := scanTotal(t, newTestScanner(t, cacheDir), ScanRequest{RootPath: filepath.Join(root, "b")}); got != 1000 {
+		t.Errorf("b from the root cache: %d bytes, want 1000", got)
+	}
+}
+
+// The cached tree is checked against the filesystem once per load; later
+// lookups read the result instead of walking the subtree again.
+func TestCacheIsCheckedOncePerLoad(t *testing.T) {
+	cacheDir := t.TempDir()
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a", "f"), 100)
+	writeFile(t, filepath.Join(root, "b", "g"), 100)
+	req := ScanRequest{RootPath: root, SizeMode: normalizeSizeMode(""), Concurrency: 1}
+	scanTotal(t, newTestScanner(t, cacheDir), req)
+
+	writeFile(t, filepath.Join(root, "b", "g"), 200)
+	scanner := newTestScanner(t, cacheDir)
+	if err := scanner.loadCache(root, req); err != nil {
+		t.Fatal(err)
+	}
+	a, b := filepath.Join(root, "a"), filepath.Join(root, "b")
+	if scanner.canReuseRoot(root, req) || scanner.canReuseDir(b, req) {
+		t.Error("folders above a grown file are reused")
+	}
+	if !scanner.canReuseDir(a, req) {
+		t.Error("an unchanged folder is not reused")
+	}
+	if len(scanner.unchangedDirs()) != 3 {
+		t.Errorf("checked %d folders, want 3", len(scanner.unchangedDirs()))
+	}
+	writeFile(t, filepath.Join(root, "a", "f"), 300)
+	if !scanner.canReuseDir(a, req) {
+		t.Error("the check ran again for the same cache")
+	}
+}
+
+// Editing an ignore file in place changes neither its folder's mtime nor
+// anything the tree shows, as it is hidden and what it excludes is only a
+// placeholder.
+func TestRescanNoticesEditedIgnoreFile(t *testing.T) {
+	cacheDir := t.TempDir()
+	root := t.TempDir()
+	writeText(t, filepath.Join(root, "a", ignoreFileName), "x.log\n")
+	writeFile(t, filepath.Join(root, "a", "b", "x.log"), 100)
+	writeFile(t, filepath.Join(root, "a", "b", "y.log"), 10)
+	req := ScanRequest{RootPath: root, Concurrency: 1}
+	if got := scanTotal(t, newTestScanner(t, cacheDir), req); got != 10 {
+		t.Fatalf("first scan: %d bytes, want 10", got)
+	}
+
+	// Same size, so only the mtime tells.
+	writeText(t, filepath.Join(root, "a", ignoreFileName), "y.log\n")
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(filepath.Join(root, "a", ignoreFileName), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got := scanTotal(t, newTestScanner(t, cacheDir), req); got != 100 {
+		t.Errorf("rescan: %d bytes, want 100 under the edited rules", got)
+	}
+}
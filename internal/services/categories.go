@@ -0,0 +1,104 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"sweepfs/internal/domain"
+)
+
+// sniffSize is how much of a file content sniffing reads, the same amount
+// http.DetectContentType looks at.
+const sniffSize = 512
+
+var executableMagic = [][]byte{
+	[]byte("\x7fELF"),
+	[]byte("MZ"),
+	{0xfe, 0xed, 0xfa, 0xce},
+	{0xfe, 0xed, 0xfa, 0xcf},
+	{0xce, 0xfa, 0xed, 0xfe},
+	{0xcf, 0xfa, 0xed, 0xfe},
+	{0xca, 0xfe, 0xba, 0xbe},
+}
+
+var archiveMagic = [][]byte{
+	[]byte("PK\x03\x04"),
+	{0x1f, 0x8b},
+	[]byte("BZh"),
+	{0xfd, '7', 'z', 'X', 'Z', 0x00},
+	{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c},
+	{0x28, 0xb5, 0x2f, 0xfd},
+	[]byte("Rar!\x1a\x07"),
+}
+
+// fileCategory classifies a file by name and, when sniff is set and the
+// extension says nothing, by its first bytes.
+func fileCategory(path, name string, info os.FileInfo, sniff bool) domain.FileCategory {
+	category := domain.CategoryOf(name)
+	if category != domain.CategoryOther || !sniff || info == nil || !info.Mode().IsRegular() || info.Size() == 0 {
+		return category
+	}
+	return sniffCategory(path)
+}
+
+func sniffCategory(path string) domain.FileCategory {
+	file, err := os.Open(path)
+	if err != nil {
+		return domain.CategoryOther
+	}
+	defer file.Close()
+	head := make([]byte, sniffSize)
+	count, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return domain.CategoryOther
+	}
+	head = head[:count]
+	for _, magic := range executableMagic {
+		if bytes.HasPrefix(head, magic) {
+			return domain.CategoryExecutable
+		}
+	}
+	for _, magic := range archiveMagic {
+		if bytes.HasPrefix(head, magic) {
+			return domain.CategoryArchive
+		}
+	}
+	if bytes.HasPrefix(head, []byte("#!")) {
+		return domain.CategoryCode
+	}
+	if bytes.HasPrefix(head, []byte("SQLite format 3\x00")) {
+		return domain.CategoryData
+	}
+	contentType := http.DetectContentType(head)
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		return domain.CategoryImage
+	case strings.HasPrefix(contentType, "video/"):
+		return domain.CategoryVideo
+	case strings.HasPrefix(contentType, "audio/"), contentType == "application/ogg":
+		return domain.CategoryAudio
+	case contentType == "application/pdf", contentType == "application/postscript":
+		return domain.CategoryDocument
+	case strings.HasPrefix(contentType, "text/html"), strings.HasPrefix(contentType, "text/xml"):
+		return domain.CategoryData
+	}
+	return domain.CategoryOther
+}
+
+// categoryTotals is what node contributes to the breakdown of its ancestors.
+func categoryTotals(node *domain.Node) map[domain.FileCategory]domain.UsageTotal {
+	if node == nil {
+		return nil
+	}
+	if node.Type != domain.NodeDir {
+		category := node.Category
+		if category == "" {
+			category = domain.CategoryOf(node.Name)
+		}
+		return map[domain.FileCategory]domain.UsageTotal{category: {Bytes: node.AccumBytes, Files: 1}}
+	}
+	return node.Categories
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"sweepfs/internal/domain"
+	"sweepfs/internal/fsinfo"
+)
+
+type CleanupCandidate struct {
+	Path    string
+	Rule    string
+	Type    domain.NodeType
+	Bytes   int64
+	ModTime time.Time
+}
+
+// CleanupReport lists the nodes below Root that a cleanup rule matched,
+// largest first. A matched folder is not searched any further. Unevaluated
+// names the rules that only match hidden entries when the scan left hidden
+// entries out.
+type CleanupReport struct {
+	Root        string
+	Candidates  []CleanupCandidate
+	TotalBytes  int64
+	RuleBytes   map[string]int64
+	Unevaluated []string
+}
+
+// FindCleanupCandidates evaluates rules against the scanned tree below root.
+// Markers are looked up among the scanned siblings first and on disk when
+// the scan left them out, for example as hidden files. Folders the scan
+// excluded are matched too, and sized on disk when they are.
+func FindCleanupCandidates(tree domain.TreeIndex, root string, rules []domain.CleanupRule, showHidden bool, now time.Time) CleanupReport {
+	report := CleanupReport{Root: root, RuleBytes: make(map[string]int64)}
+	start, ok := tree.Nodes[root]
+	if !ok || len(rules) == 0 {
+		return report
+	}
+	if !showHidden {
+		for _, rule := range rules {
+			if isHidden(rule.Pattern) {
+				report.Unevaluated = append(report.Unevaluated, rule.Name)
+			}
+		}
+	}
+	stack := append([]string{}, start.ChildrenIDs...)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		node, ok := tree.Nodes[id]
+		if !ok {
+			continue
+		}
+		if rule, bytes, matched := matchCleanupRule(tree, node, rules, now); matched {
+			candidate := CleanupCandidate{Path: node.Path, Rule: rule.Name, Type: node.Type, Bytes: bytes, ModTime: newestMod(node)}
+			report.Candidates = append(report.Candidates, candidate)
+			report.TotalBytes += candidate.Bytes
+			report.RuleBytes[rule.Name] += candidate.Bytes
+			continue
+		}
+		if node.Type == domain.NodeDir {
+			stack = append(stack, node.ChildrenIDs...)
+		}
+	}
+	sort.Slice(report.Candidates, func(i, j int) bool {
+		if report.Candidates[i].Bytes != report.Candidates[j].Bytes {
+			return report.Candidates[i].Bytes > report.Candidates[j].Bytes
+		}
+		return report.Candidates[i].Path < report.Candidates[j].Path
+	})
+	return report
+}
+
+// matchCleanupRule returns the first rule node matches and the bytes it
+// holds. An excluded folder is only a placeholder in the tree, so it is
+// sized on disk once a rule names it.
+func matchCleanupRule(tree domain.TreeIndex, node *domain.Node, rules []domain.CleanupRule, now time.Time) (domain.CleanupRule, int64, bool) {
+	if (node.Skipped != domain.SkipNone && node.Skipped != domain.SkipExcluded) || node.Archive != "" {
+		return domain.CleanupRule{}, 0, false
+	}
+	bytes, sized := node.AccumBytes, node.Skipped == domain.SkipNone
+	for _, rule := range rules {
+		if (rule.Type == domain.RuleTypeDir && node.Type != domain.NodeDir) || (rule.Type == domain.RuleTypeFile && node.Type != domain.NodeFile) {
+			continue
+		}
+		if matched, err := filepath.Match(rule.Pattern, node.Name); err != nil || !matched {
+			continue
+		}
+		if rule.MinBytes > 0 && !sized {
+			bytes, sized = excludedSize(node.Path, node.SizeMode), true
+		}
+		if rule.MinBytes > 0 && bytes < rule.MinBytes {
+			continue
+		}
+		if rule.MinAgeDays > 0 {
+			modTime := newestMod(node)
+			if modTime.IsZero() || domain.DaysSince(modTime, now) < rule.MinAgeDays {
+				continue
+			}
+		}
+		if rule.Marker != "" && !hasSiblingMarker(tree, node, rule.Marker) {
+			continue
+		}
+		if !sized {
+			bytes = excludedSize(node.Path, node.SizeMode)
+		}
+		return rule, bytes, true
+	}
+	return domain.CleanupRule{}, 0, false
+}
+
+// excludedSize adds up the files below an excluded folder. Folders it cannot
+// read count as empty.
+func excludedSize(path string, mode domain.SizeMode) int64 {
+	var total int64
+	_ = filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			total += fsinfo.Size(info, mode)
+		}
+		return nil
+	})
+	return total
+}
+
+func hasSiblingMarker(tree domain.TreeIndex, node *domain.Node, marker string) bool {
+	if parent, ok := tree.Nodes[node.ParentID]; ok {
+		for _, id := range parent.ChildrenIDs {
+			sibling, ok := tree.Nodes[id]
+			if !ok || sibling.Type != domain.NodeFile {
+				continue
+			}
+			if matched, _ := filepath.Match(marker, sibling.Name); matched {
+				return true
+			}
+		}
+	}
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(node.Path), marker))
+	if err != nil {
+		return false
+	}
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && !info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// newestMod is the mtime of a file or the newest mtime below a directory.
+func newestMod(node *domain.Node) time.Time {
+	if node.Type == domain.NodeDir && !node.NewestMod.IsZero() {
+		return node.NewestMod
+	}
+	return node.ModTime
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"sweepfs/internal/domain"
+)
+
+func TestFindCleanupCandidates(t *testing.T) {
+	root := t.TempDir()
+	writeText(t, filepath.Join(root, "web", "package.json"), "{}\n")
+	writeFile(t, filepath.Join(root, "web", "node_modules", "left-pad", "index.js"), 5000)
+	writeFile(t, filepath.Join(root, "loose", "node_modules", "index.js"), 700)
+	writeText(t, filepath.Join(root, "rust", "Cargo.toml"), "[package]\n")
+	writeFile(t, filepath.Join(root, "rust", "target", "app"), 300)
+	writeFile(t, filepath.Join(root, "rust", "target", "__pycache__", "m.pyc"), 20)
+	writeFile(t, filepath.Join(root, "py", "__pycache__", "m.pyc"), 40)
+	writeFile(t, filepath.Join(root, "logs", "old.log"), 50)
+	writeFile(t, filepath.Join(root, "logs", "new.log"), 60)
+	writeText(t, filepath.Join(root, "py", "tox.ini"), "[tox]\n")
+	writeFile(t, filepath.Join(root, "py", ".tox", "env"), 80)
+	old := time.Now().AddDate(0, 0, -60)
+	if err := os.Chtimes(filepath.Join(root, "logs", "old.log"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	req := ScanRequest{RootPath: root, SizeMode: domain.SizeApparent, Exclude: []string{"node_modules"}}
+	tree := domain.TreeIndex{Nodes: walkTree(t, req, 1), RootID: root}
+
+	report := FindCleanupCandidates(tree, root, domain.BuiltinCleanupRules, false, time.Now())
+	want := []CleanupCandidate{
+		{Path: filepath.Join(root, "web", "node_modules"), Rule: "npm dependencies", Bytes: 5000},
+		{Path: filepath.Join(root, "rust", "target"), Rule: "Rust build output", Bytes: 320},
+		{Path: filepath.Join(root, "logs", "old.log"), Rule: "old logs", Bytes: 50},
+		{Path: filepath.Join(root, "py", "__pycache__"), Rule: "Python bytecode", Bytes: 40},
+	}
+	if len(report.Candidates) != len(want) {
+		t.Fatalf("found %+v, want %+v", report.Candidates, want)
+	}
+	for index, candidate := range report.Candidates {
+		if candidate.Path != want[index].Path || candidate.Rule != want[index].Rule || candidate.Bytes != want[index].Bytes {
+			t.Errorf("candidate %d: %s by %q with %d bytes, want %s by %q with %d", index, candidate.Path, candidate.Rule, candidate.Bytes, want[index].Path, want[index].Rule, want[index].Bytes)
+		}
+	}
+	if report.TotalBytes != 5410 || report.RuleBytes["npm dependencies"] != 5000 {
+		t.Errorf("total %d, npm %d, want 5410 and 5000", report.TotalBytes, report.RuleBytes["npm dependencies"])
+	}
+	hidden := []string{"Gradle cache", "Python tool caches", "tox environments", "Next.js build cache", "Parcel cache"}
+	if !reflect.DeepEqual(report.Unevaluated, hidden) {
+		t.Errorf("unevaluated %q, want %q", report.Unevaluated, hidden)
+	}
+
+	req.ShowHidden = true
+	tree = domain.TreeIndex{Nodes: walkTree(t, req, 1), RootID: root}
+	report = FindCleanupCandidates(tree, filepath.Join(root, "py"), domain.BuiltinCleanupRules, true, time.Now())
+	if len(report.Unevaluated) != 0 || len(report.Candidates) != 2 || report.RuleBytes["tox environments"] != 80 {
+		t.Errorf("with hidden files: %+v", report)
+	}
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"sweepfs/internal/domain"
+	"sweepfs/internal/fsinfo"
+)
+
+var (
+	errReflinkUnsupported = errors.New("reflinks are not supported here")
+	errNotIdentical       = errors.New("content differs from the kept file")
+	errAlreadyLinked      = errors.New("already linked")
+)
+
+// dedupePaths replaces every source with a copy-on-write clone of keeper, or
+// a hardlink to it when cloning is not supported and both are on the same
+// device. Sources are compared byte for byte with keeper first.
+func (actions *FSActions) dedupePaths(ctx context.Context, progress chan<- ActionProgress, paths []string, keeper string) ActionResult {
+	result := ActionResult{Type: ActionDedupe}
+	keeper = filepath.Clean(keeper)
+	keeperInfo, err := os.Lstat(keeper)
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		result.Message = "dedupe failed"
+		return result
+	}
+	if !keeperInfo.Mode().IsRegular() {
+		result.Errors = append(result.Errors, fmt.Sprintf("not a regular file: %s", keeper))
+		result.Message = "dedupe failed"
+		return result
+	}
+	for _, source := range paths {
+		if ctx.Err() != nil {
+			result.Message = "dedupe cancelled"
+			return result
+		}
+		if source == keeper {
+			continue
+		}
+		reclaimed, err := dedupeFile(ctx, source, keeper, keeperInfo)
+		if errors.Is(err, errAlreadyLinked) {
+			result.Skipped++
+			continue
+		}
+		if err != nil {
+			result.FailureCount++
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", source, err))
+			continue
+		}
+		result.SuccessCount++
+		result.BytesReclaimed += reclaimed
+		result.Replaced = append(result.Replaced, source)
+		actionProgressNonBlocking(progress, ActionProgress{Type: ActionDedupe, Current: source, Processed: result.SuccessCount + result.FailureCount})
+	}
+	result.Message = fmt.Sprintf("dedupe complete, %d bytes reclaimed", result.BytesReclaimed)
+	return result
+}
+
+func dedupeFile(ctx context.Context, source, keeper string, keeperInfo os.FileInfo) (int64, error) {
+	info, err := os.Lstat(source)
+	if err != nil {
+		return 0, err
+	}
+	if err := dedupeCandidate(info, keeperInfo); err != nil {
+		return 0, err
+	}
+	if err := compareFiles(ctx, source, keeper); err != nil {
+		return 0, err
+	}
+	current, err := os.Lstat(source)
+	if err != nil {
+		return 0, err
+	}
+	if current.Size() != info.Size() || !current.ModTime().Equal(info.ModTime()) {
+		return 0, fmt.Errorf("changed while comparing")
+	}
+	currentKeeper, err := os.Lstat(keeper)
+	if err != nil {
+		return 0, err
+	}
+	if currentKeeper.Size() != keeperInfo.Size() || !currentKeeper.ModTime().Equal(keeperInfo.ModTime()) || !os.SameFile(currentKeeper, keeperInfo) {
+		return 0, fmt.Errorf("kept file changed while comparing")
+	}
+
+	reclaimed := int64(0)
+	if stat, ok := fsinfo.Of(info); !ok || stat.Nlink <= 1 {
+		reclaimed = fsinfo.Size(info, domain.SizeDisk)
+	}
+	err = replaceWithClone(source, keeper, info)
+	if errors.Is(err, errReflinkUnsupported) {
+		if !sameDevice(info, keeperInfo) {
+			return 0, fmt.Errorf("on another filesystem and reflinks are not supported")
+		}
+		err = replaceWithHardlink(source, keeper)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return reclaimed, nil
+}
+
+// dedupeCandidate reports why source cannot be replaced by keeper.
+func dedupeCandidate(info, keeperInfo os.FileInfo) error {
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("not a regular file")
+	}
+	if info.Size() != keeperInfo.Size() {
+		return errNotIdentical
+	}
+	if os.SameFile(info, keeperInfo) {
+		return errAlreadyLinked
+	}
+	return nil
+}
+
+func sameDevice(left, right os.FileInfo) bool {
+	leftStat, leftOK := fsinfo.Of(left)
+	rightStat, rightOK := fsinfo.Of(right)
+	return leftOK && rightOK && leftStat.Dev == rightStat.Dev
+}
+
+func compareFiles(ctx context.Context, left, right string) error {
+	leftFile, err := os.Open(left)
+	if err != nil {
+		return err
+	}
+	defer leftFile.Close()
+	rightFile, err := os.Open(right)
+	if err != nil {
+		return err
+	}
+	defer rightFile.Close()
+	leftBuffer := make([]byte, 1<<20)
+	rightBuffer := make([]byte, 1<<20)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		leftCount, leftErr := io.ReadFull(leftFile, leftBuffer)
+		rightCount, rightErr := io.ReadFull(rightFile, rightBuffer)
+		if leftCount != rightCount || !bytes.Equal(leftBuffer[:leftCount], rightBuffer[:rightCount]) {
+			return errNotIdentical
+		}
+		leftDone := leftErr == io.EOF || leftErr == io.ErrUnexpectedEOF
+		rightDone := rightErr == io.EOF || rightErr == io.ErrUnexpectedEOF
+		if leftErr != nil && !leftDone {
+			return leftErr
+		}
+		if rightErr != nil && !rightDone {
+			return rightErr
+		}
+		if leftDone || rightDone {
+			if leftDone != rightDone {
+				return errNotIdentical
+			}
+			return nil
+		}
+	}
+}
+
+// replaceWithClone clones keeper into a temporary file next to source, gives
+// it the mode, owner and times of source and renames it over source.
+func replaceWithClone(source, keeper string, info os.FileInfo) error {
+	input, err := os.Open(keeper)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	temp, err := os.CreateTemp(filepath.Dir(source), "."+filepath.Base(source)+".sweepfs-*")
+	if err != nil {
+		return err
+	}
+	tempPath := temp.Name()
+	if err := cloneFile(temp, input); err != nil {
+		_ = temp.Close()
+		_ = os.Remove(tempPath)
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		_ = os.Remove(tempPath)
+		return err
+	}
+	_ = os.Chmod(tempPath, info.Mode().Perm())
+	if stat, ok := fsinfo.Of(info); ok {
+		_ = os.Lchown(tempPath, int(stat.UID), int(stat.GID))
+	}
+	_ = os.Chtimes(tempPath, time.Now(), info.ModTime())
+	if err := os.Rename(tempPath, source); err != nil {
+		_ = os.Remove(tempPath)
+		return err
+	}
+	return nil
+}
+
+// replaceWithHardlink links keeper under a temporary name next to source and
+// renames the link over source, so source never goes missing.
+func replaceWithHardlink(source, keeper string) error {
+	tempPath := filepath.Join(filepath.Dir(source), fmt.Sprintf(".%s.sweepfs-%d", filepath.Base(source), time.Now().UnixNano()))
+	if err := os.Link(keeper, tempPath); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, source); err != nil {
+		_ = os.Remove(tempPath)
+		return err
+	}
+	return nil
+}
+
+// dedupeWarnings lists the sources a dedupe will skip or may fail on. The
+// content itself is only compared when the action runs.
+func dedupeWarnings(paths []string, keeper string) []string {
+	keeperInfo, err := os.Lstat(keeper)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	warnings := []string{fmt.Sprintf("Keeping %s", keeper)}
+	otherDevice, linkable := 0, 0
+	for _, path := range paths {
+		info, err := os.Lstat(path)
+		if err != nil {
+			continue
+		}
+		if err := dedupeCandidate(info, keeperInfo); err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		if !sameDevice(info, keeperInfo) {
+			otherDevice++
+		} else {
+			linkable++
+		}
+	}
+	if otherDevice > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d files on another filesystem need reflink support", otherDevice))
+	}
+	if linkable > 0 && probeReflink(keeper) != nil {
+		warnings = append(warnings, "Without reflinks, copies become hardlinks and share mode and owner")
+	}
+	return warnings
+}
+
+// probeReflink clones keeper into a temporary file next to it to find out
+// whether its filesystem supports reflinks. A clone shares every block, so
+// no data is copied. Any error leaves the support unknown.
+func probeReflink(keeper string) error {
+	input, err := os.Open(keeper)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	temp, err := os.CreateTemp(filepath.Dir(keeper), ".sweepfs-probe-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+	return cloneFile(temp, input)
+}
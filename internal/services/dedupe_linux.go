@@ -0,0 +1,18 @@
+//go:build linux
+
+package services
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func cloneFile(target, source *os.File) error {
+	err := unix.IoctlFileClone(int(target.Fd()), int(source.Fd()))
+	if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.ENOTTY) || errors.Is(err, unix.EXDEV) || errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOSYS) {
+		return errReflinkUnsupported
+	}
+	return err
+}
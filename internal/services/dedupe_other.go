@@ -0,0 +1,9 @@
+//go:build !linux
+
+package services
+
+import "os"
+
+func cloneFile(target, source *os.File) error {
+	return errReflinkUnsupported
+}
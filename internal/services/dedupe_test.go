@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDedupeRefusesDifferentContent(t *testing.T) {
+	dir := t.TempDir()
+	keeper, source := filepath.Join(dir, "keep"), filepath.Join(dir, "copy")
+	writeText(t, keeper, "same length, first\n")
+	writeText(t, source, "same length, other\n")
+	keeperInfo, err := os.Lstat(keeper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dedupeFile(context.Background(), source, keeper, keeperInfo); !errors.Is(err, errNotIdentical) {
+		t.Fatalf("deduped different content: %v", err)
+	}
+	if data, _ := os.ReadFile(source); string(data) != "same length, other\n" {
+		t.Errorf("source was rewritten to %q", data)
+	}
+}
+
+func TestDedupeRechecksKeeper(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, keeper string)
+	}{
+		{"touched", func(t *testing.T, keeper string) {
+			later := time.Now().Add(time.Hour)
+			if err := os.Chtimes(keeper, later, later); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"replaced", func(t *testing.T, keeper string) {
+			info, err := os.Lstat(keeper)
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeText(t, keeper+".new", "shared content\n")
+			if err := os.Chtimes(keeper+".new", info.ModTime(), info.ModTime()); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Rename(keeper+".new", keeper); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			keeper, source := filepath.Join(dir, "keep"), filepath.Join(dir, "copy")
+			writeText(t, keeper, "shared content\n")
+			writeText(t, source, "shared content\n")
+			keeperInfo, err := os.Lstat(keeper)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.change(t, keeper)
+			_, err = dedupeFile(context.Background(), source, keeper, keeperInfo)
+			if err == nil || !strings.Contains(err.Error(), "kept file changed") {
+				t.Fatalf("deduped against a changed keeper: %v", err)
+			}
+			sourceInfo, err := os.Lstat(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if current, _ := os.Lstat(keeper); os.SameFile(sourceInfo, current) {
+				t.Error("source was linked to the changed keeper")
+			}
+		})
+	}
+}
+
+// Whether the temporary directory supports reflinks decides which way the
+// copy is replaced, so the probe picks the expectation.
+func TestDedupeClonesOrFallsBackToHardlink(t *testing.T) {
+	dir := t.TempDir()
+	keeper, source := filepath.Join(dir, "keep"), filepath.Join(dir, "copy")
+	writeText(t, keeper, "shared content\n")
+	writeText(t, source, "shared content\n")
+	if err := os.Chmod(source, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keeperInfo, err := os.Lstat(keeper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reflinks := probeReflink(keeper) == nil
+	warned := false
+	for _, warning := range dedupeWarnings([]string{source}, keeper) {
+		warned = warned || strings.HasPrefix(warning, "Without reflinks")
+	}
+	if warned == reflinks {
+		t.Errorf("hardlink warning shown %v with reflinks supported %v", warned, reflinks)
+	}
+
+	if _, err := dedupeFile(context.Background(), source, keeper, keeperInfo); err != nil {
+		t.Fatal(err)
+	}
+	sourceInfo, err := os.Lstat(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	currentKeeper, err := os.Lstat(keeper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflinks {
+		if os.SameFile(sourceInfo, currentKeeper) || sourceInfo.Mode().Perm() != 0o600 {
+			t.Errorf("clone: linked %v with mode %v, want a separate file with mode 0600", os.SameFile(sourceInfo, currentKeeper), sourceInfo.Mode().Perm())
+		}
+	} else if !os.SameFile(sourceInfo, currentKeeper) {
+		t.Error("without reflinks the copy was not hardlinked to the keeper")
+	}
+	if data, _ := os.ReadFile(source); string(data) != "shared content\n" {
+		t.Errorf("source holds %q", data)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, ".*")); len(leftovers) != 0 {
+		t.Errorf("temporary files left: %q", leftovers)
+	}
+	if _, err := dedupeFile(context.Background(), source, keeper, currentKeeper); !reflinks && !errors.Is(err, errAlreadyLinked) {
+		t.Errorf("deduping the hardlink again: %v, want it skipped", err)
+	}
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"sweepfs/internal/domain"
+)
+
+// partialHashSize is how much of a file the first hashing pass reads. Files
+// no larger than this are fully hashed by that pass.
+const partialHashSize = 64 * 1024
+
+type DuplicateRequest struct {
+	Tree        domain.TreeIndex
+	RootPath    string
+	MinSize     int64
+	Concurrency int
+}
+
+// DuplicateGroup is a set of files with identical content. Hardlinks to the
+// same inode are listed once.
+type DuplicateGroup struct {
+	Size  int64
+	Hash  string
+	Paths []string
+}
+
+// Reclaimable is what keeping a single copy would free.
+func (group DuplicateGroup) Reclaimable() int64 {
+	return group.Size * int64(len(group.Paths)-1)
+}
+
+type DuplicateProgress struct {
+	Phase      string
+	Done       int
+	Total      int
+	Current    string
+	Completed  bool
+	ErrMessage string
+}
+
+type DuplicateFinder interface {
+	FindDuplicates(ctx context.Context, req DuplicateRequest) ([]DuplicateGroup, error)
+	DuplicateProgress() <-chan DuplicateProgress
+}
+
+type dupeCandidate struct {
+	path    string
+	size    int64
+	partial string
+	full    string
+	dropped bool
+}
+
+func (scanner *FSScanner) DuplicateProgress() <-chan DuplicateProgress {
+	scanner.mu.RLock()
+	defer scanner.mu.RUnlock()
+	return scanner.dupeProgress
+}
+
+// FindDuplicates groups the files below req.RootPath by size, then by a hash
+// of their first partialHashSize bytes, then by a hash of the whole file.
+// Hashes are cached by path and only reused while mtime and size match.
+func (scanner *FSScanner) FindDuplicates(ctx context.Context, req DuplicateRequest) ([]DuplicateGroup, error) {
+	progress := make(chan DuplicateProgress, 64)
+	scanner.mu.Lock()
+	scanner.dupeProgress = progress
+	hashes := scanner.hashes
+	scanner.mu.Unlock()
+	defer close(progress)
+
+	root := cleanPath(req.RootPath)
+	if root == "" {
+		root = req.Tree.RootID
+	}
+	hashes.load()
+	workers := minInt(scanConcurrency(req.Concurrency), 8)
+
+	sized := duplicateCandidates(req.Tree, root, req.MinSize)
+	partials := make([]*dupeCandidate, 0)
+	for _, group := range sized {
+		partials = append(partials, group...)
+	}
+	if err := hashCandidates(ctx, "partial", partials, false, workers, hashes, progress); err != nil {
+		return nil, err
+	}
+
+	byPartial := groupCandidates(partials, func(candidate *dupeCandidate) string {
+		return candidate.partial
+	})
+	fulls := make([]*dupeCandidate, 0)
+	for _, group := range byPartial {
+		fulls = append(fulls, group...)
+	}
+	if err := hashCandidates(ctx, "full", fulls, true, workers, hashes, progress); err != nil {
+		return nil, err
+	}
+
+	groups := []DuplicateGroup{}
+	for _, group := range groupCandidates(fulls, func(candidate *dupeCandidate) string {
+		return candidate.full
+	}) {
+		paths := make([]string, 0, len(group))
+		for _, candidate := range group {
+			paths = append(paths, candidate.path)
+		}
+		sort.Strings(paths)
+		groups = append(groups, DuplicateGroup{Size: group[0].size, Hash: group[0].full, Paths: paths})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Reclaimable() != groups[j].Reclaimable() {
+			return groups[i].Reclaimable() > groups[j].Reclaimable()
+		}
+		return groups[i].Paths[0] < groups[j].Paths[0]
+	})
+
+	if err := hashes.save(root); err != nil {
+		dupeProgressNonBlocking(progress, DuplicateProgress{ErrMessage: "hash cache: " + err.Error()})
+	}
+	dupeProgressNonBlocking(progress, DuplicateProgress{Phase: "done", Done: len(fulls), Total: len(fulls), Completed: true})
+	return groups, nil
+}
+
+// duplicateCandidates returns the files below root grouped by size, leaving
+// out sizes only one file has. Extra links to an inode are skipped.
+func duplicateCandidates(tree domain.TreeIndex, root string, minSize int64) map[int64][]*dupeCandidate {
+	if minSize < 1 {
+		minSize = 1
+	}
+	bySize := make(map[int64][]*dupeCandidate)
+	inodes := make(map[inodeKey]bool)
+	paths := make([]string, 0, len(tree.Nodes))
+	for path, node := range tree.Nodes {
+		if node.Type == domain.NodeFile && node.Skipped == domain.SkipNone && node.ReadError == "" && node.Archive == "" && isWithin(root, path) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		node := tree.Nodes[path]
+		if node.Inode != 0 {
+			key := inodeKey{dev: node.Device, ino: node.Inode}
+			if inodes[key] {
+				continue
+			}
+			inodes[key] = true
+		}
+		size := node.SizeBytes
+		if node.SizeMode != domain.SizeApparent {
+			info, err := os.Lstat(path)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			size = info.Size()
+		}
+		if size < minSize {
+			continue
+		}
+		bySize[size] = append(bySize[size], &dupeCandidate{path: path, size: size})
+	}
+	for size, group := range bySize {
+		if len(group) < 2 {
+			delete(bySize, size)
+		}
+	}
+	return bySize
+}
+
+// groupCandidates groups by size and key and keeps groups of two or more.
+func groupCandidates(candidates []*dupeCandidate, key func(*dupeCandidate) string) [][]*dupeCandidate {
+	type groupKey struct {
+		size int64
+		hash string
+	}
+	byKey := make(map[groupKey][]*dupeCandidate)
+	order := []groupKey{}
+	for _, candidate := range candidates {
+		if candidate.dropped {
+			continue
+		}
+		id := groupKey{size: candidate.size, hash: key(candidate)}
+		if _, ok := byKey[id]; !ok {
+			order = append(order, id)
+		}
+		byKey[id] = append(byKey[id], candidate)
+	}
+	groups := make([][]*dupeCandidate, 0, len(order))
+	for _, id := range order {
+		if len(byKey[id]) > 1 {
+			groups = append(groups, byKey[id])
+		}
+	}
+	return groups
+}
+
+// hashCandidates fills in the partial or full hash of every candidate on a
+// pool of workers. Files that changed size or can no longer be read are
+// dropped.
+func hashCandidates(ctx context.Context, phase string, candidates []*dupeCandidate, full bool, workers int, hashes *hashCache, progress chan<- DuplicateProgress) error {
+	jobs := make(chan *dupeCandidate)
+	var done int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for candidate := range jobs {
+				if err := hashCandidate(ctx, candidate, full, hashes); err != nil {
+					candidate.dropped = true
+					if ctx.Err() == nil {
+						dupeProgressNonBlocking(progress, DuplicateProgress{Phase: phase, Current: candidate.path, ErrMessage: err.Error()})
+					}
+				}
+				mu.Lock()
+				done++
+				update := DuplicateProgress{Phase: phase, Done: done, Total: len(candidates), Current: candidate.path}
+				mu.Unlock()
+				dupeProgressNonBlocking(progress, update)
+			}
+		}()
+	}
+	for _, candidate := range candidates {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- candidate
+	}
+	close(jobs)
+	wg.Wait()
+	return ctx.Err()
+}
+
+func hashCandidate(ctx context.Context, candidate *dupeCandidate, full bool, hashes *hashCache) error {
+	info, err := os.Lstat(candidate.path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() || info.Size() != candidate.size {
+		candidate.dropped = true
+		return nil
+	}
+	entry := hashes.lookup(candidate.path, info.ModTime().UnixNano(), info.Size())
+	if entry.Partial == "" {
+		if entry.Partial, err = hashFile(ctx, candidate.path, partialHashSize); err != nil {
+			return err
+		}
+	}
+	if full && entry.Full == "" {
+		if info.Size() <= partialHashSize {
+			entry.Full = entry.Partial
+		} else if entry.Full, err = hashFile(ctx, candidate.path, -1); err != nil {
+			return err
+		}
+	}
+	hashes.store(candidate.path, entry)
+	candidate.partial = entry.Partial
+	candidate.full = entry.Full
+	return nil
+}
+
+// hashFile returns the SHA-256 of the first limit bytes of path, or of the
+// whole file when limit is negative.
+func hashFile(ctx context.Context, path string, limit int64) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	if limit >= 0 {
+		reader = io.LimitReader(file, limit)
+	}
+	hash := sha256.New()
+	buffer := make([]byte, 1<<20)
+	for {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		count, err := reader.Read(buffer)
+		hash.Write(buffer[:count])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return string(hash.Sum(nil)), nil
+}
+
+func hashCachePath() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "sweepfs", hashCacheName), nil
+}
+
+func dupeProgressNonBlocking(ch chan<- DuplicateProgress, msg DuplicateProgress) {
+	select {
+	case ch <- msg:
+	default:
+	}
+}
@@ -47,6 +47,14 @@ func (actions *FSActions) Preview(ctx context.Context, req ActionRequest) (Actio
 		Samples:     []string{},
 	}
 
+	if req.Type == ActionExtract {
+		if err := previewExtract(ctx, &preview, paths); err != nil {
+			return ActionPreview{}, err
+		}
+		return preview, nil
+	}
+
+	workTrees := []string{}
 	for _, path := range paths {
 		select {
 		case <-ctx.Done():
@@ -65,6 +73,9 @@ func (actions *FSActions) Preview(ctx context.Context, req ActionRequest) (Actio
 					preview.Warnings = append(preview.Warnings, walkErr.Error())
 					return nil
 				}
+				if entry.Name() == ".git" {
+					workTrees = append(workTrees, filepath.Dir(child))
+				}
 				if entry.IsDir() {
 					if child != path {
 						preview.TotalDirs++
@@ -92,6 +103,16 @@ func (actions *FSActions) Preview(ctx context.Context, req ActionRequest) (Actio
 			}
 		}
 	}
+	if req.Type == ActionDedupe {
+		preview.Warnings = append(preview.Warnings, dedupeWarnings(paths, req.Destination)...)
+	}
+	if destructiveGitAction(req.Type) {
+		preview.Git = gitPreview(ctx, paths, workTrees)
+		for _, status := range preview.Git {
+			preview.Warnings = append(preview.Warnings, status.Warnings()...)
+		}
+		preview.Blocked = req.SafeMode && !req.AllowDirtyGit && len(preview.Git) > 0
+	}
 
 	return preview, nil
 }
@@ -108,6 +129,9 @@ func (actions *FSActions) Execute(ctx context.Context, req ActionRequest) (Actio
 	if err := requireConfirmation(req, paths); err != nil {
 		return ActionResult{Type: req.Type}, err
 	}
+	if err := requireCleanGit(ctx, req, paths); err != nil {
+		return ActionResult{Type: req.Type}, err
+	}
 
 	progress := make(chan ActionProgress, 64)
 	actions.setProgress(progress)
@@ -124,6 +148,10 @@ func (actions *FSActions) Execute(ctx context.Context, req ActionRequest) (Actio
 		result = actions.copyPaths(ctx, progress, paths, req.Destination)
 	case ActionBackup:
 		result = actions.backupPaths(ctx, progress, paths, req.Destination)
+	case ActionDedupe:
+		result = actions.dedupePaths(ctx, progress, paths, req.Destination)
+	case ActionExtract:
+		result = actions.extractPaths(ctx, progress, paths, req.Destination)
 	default:
 		return ActionResult{Type: req.Type}, fmt.Errorf("unsupported action")
 	}
@@ -267,9 +295,12 @@ func validateRequest(req ActionRequest, paths []string) error {
 	if len(paths) == 0 {
 		return fmt.Errorf("no sources provided")
 	}
-	if (req.Type == ActionMove || req.Type == ActionCopy || req.Type == ActionBackup) && req.Destination == "" {
+	if (req.Type == ActionMove || req.Type == ActionCopy || req.Type == ActionBackup || req.Type == ActionExtract) && req.Destination == "" {
 		return fmt.Errorf("destination required")
 	}
+	if req.Type == ActionDedupe && req.Destination == "" {
+		return fmt.Errorf("file to keep required")
+	}
 	if req.SafeMode && req.Type == ActionDelete {
 		for _, path := range paths {
 			if isCriticalPath(path) {
@@ -281,7 +312,7 @@ func validateRequest(req ActionRequest, paths []string) error {
 }
 
 func requireConfirmation(req ActionRequest, paths []string) error {
-	if req.Type != ActionDelete && req.Type != ActionMove {
+	if req.Type != ActionDelete && req.Type != ActionMove && req.Type != ActionDedupe {
 		return nil
 	}
 	if req.ConfirmToken == "confirm" {
@@ -304,6 +335,23 @@ func requireConfirmation(req ActionRequest, paths []string) error {
 	return fmt.Errorf("confirmation required")
 }
 
+// requireCleanGit refuses to delete or move git work trees with work that
+// exists nowhere else, unless safe mode is off or the request overrides it.
+func requireCleanGit(ctx context.Context, req ActionRequest, paths []string) error {
+	if !req.SafeMode || req.AllowDirtyGit || !destructiveGitAction(req.Type) {
+		return nil
+	}
+	statuses := gitPreview(ctx, paths, findGitWorkTrees(ctx, paths))
+	if len(statuses) == 0 {
+		return nil
+	}
+	return fmt.Errorf("blocked: uncommitted or unpushed git work in %s", statuses[0].WorkTree)
+}
+
+func destructiveGitAction(actionType ActionType) bool {
+	return actionType == ActionDelete || actionType == ActionMove
+}
+
 func normalizePaths(paths []string) ([]string, error) {
 	seen := make(map[string]struct{})
 	result := make([]string, 0, len(paths))
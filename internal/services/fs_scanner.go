@@ -6,27 +6,39 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
-	"runtime"
 	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"sweepfs/internal/domain"
+	"sweepfs/internal/fsinfo"
 )
 
 type FSScanner struct {
-	mu          sync.RWMutex
-	cache       map[string]*domain.Node
-	scannedDirs map[string]bool
-	progress    chan ScanProgress
-	exclusions  map[string]struct{}
-	maxDepth    int
-	root        string
-	cacheEntries map[string]cacheEntry
-	cacheLoaded  bool
-	cachePath    string
+	mu              sync.RWMutex
+	cache           map[string]*domain.Node
+	scannedDirs     map[string]bool
+	progress        chan ScanProgress
+	root            string
+	cacheEntries    map[string]cacheEntry
+	cacheCheck      *cacheValidity
+	cacheKey        string
+	cacheDir        string
+	historyDir      string
+	stale           map[string]bool
+	scanErrors      map[string]ScanError
+	hashes          *hashCache
+	dupeProgress    chan DuplicateProgress
 	cacheHiddenFlag bool
+	cacheSizeMode   domain.SizeMode
+	cacheOneFS      bool
+	cacheFollow     bool
+	cacheExclude    []string
+	cacheMaxDepth   int
+	cacheSniff      bool
+	updates         chan TreeUpdate
 }
 
 type fileJob struct {
@@ -35,25 +47,37 @@ type fileJob struct {
 
 type fileResult struct {
 	path string
-	size int64
+	info os.FileInfo
 	err  error
 }
 
+type inodeKey struct {
+	dev uint64
+	ino uint64
+}
+
 func NewFSScanner() *FSScanner {
-	cachePath, err := cacheFilePath()
+	cacheDir, err := cacheDirPath()
 	if err != nil {
-		cachePath = ""
+		cacheDir = ""
+	}
+	historyDir, err := historyDirPath()
+	if err != nil {
+		historyDir = ""
+	}
+	hashPath, err := hashCachePath()
+	if err != nil {
+		hashPath = ""
 	}
 	return &FSScanner{
 		cache:       make(map[string]*domain.Node),
 		scannedDirs: make(map[string]bool),
-		exclusions: map[string]struct{}{
-			".git":         {},
-			"node_modules": {},
-			".cache":       {},
-		},
-		maxDepth: 0,
-		cachePath: cachePath,
+		cacheDir:    cacheDir,
+		historyDir:  historyDir,
+		stale:       make(map[string]bool),
+		scanErrors:  make(map[string]ScanError),
+		hashes:      newHashCache(hashPath),
+		updates:     make(chan TreeUpdate, 1),
 	}
 }
 
@@ -67,14 +91,7 @@ func (scanner *FSScanner) Snapshot() domain.TreeIndex {
 	scanner.mu.RLock()
 	defer scanner.mu.RUnlock()
 
-	copyMap := make(map[string]*domain.Node, len(scanner.cache))
-	for id, node := range scanner.cache {
-		clone := *node
-		if node.ChildrenIDs != nil {
-			clone.ChildrenIDs = append([]string{}, node.ChildrenIDs...)
-		}
-		copyMap[id] = &clone
-	}
+	copyMap := cloneNodes(scanner.cache)
 
 	rootID := scanner.root
 	if rootID == "" {
@@ -98,22 +115,29 @@ func (scanner *FSScanner) Invalidate(path string) {
 	scanner.mu.Lock()
 	defer scanner.mu.Unlock()
 
-	for key := range scanner.cache {
-		if isWithin(root, key) {
-			delete(scanner.cache, key)
-		}
-	}
 	for key := range scanner.scannedDirs {
 		if isWithin(root, key) {
 			delete(scanner.scannedDirs, key)
 		}
 	}
+	scanner.stale[root] = true
+	if scanner.cacheEntries != nil {
+		entries := make(map[string]cacheEntry, len(scanner.cacheEntries))
+		for key, entry := range scanner.cacheEntries {
+			if !isWithin(root, key) {
+				entries[key] = entry
+			}
+		}
+		scanner.cacheEntries = entries
+		scanner.cacheCheck = &cacheValidity{}
+	}
 }
 
 func (scanner *FSScanner) Scan(ctx context.Context, req ScanRequest) (ScanResult, error) {
 	start := time.Now()
 	root := cleanPath(req.RootPath)
-	if err := scanner.loadCache(); err != nil {
+	req.SizeMode = normalizeSizeMode(req.SizeMode)
+	if err := scanner.loadCache(root, req); err != nil {
 		progressNonBlocking(scanner.progress, ScanProgress{Path: root, ErrMessage: err.Error()})
 	}
 	progress := make(chan ScanProgress, 64)
@@ -122,157 +146,94 @@ func (scanner *FSScanner) Scan(ctx context.Context, req ScanRequest) (ScanResult
 	}
 	defer close(progress)
 
-	if scanner.canReuseRoot(root, req.ShowHidden) {
+	if scanner.canReuseRoot(root, req) {
+		// The entries may come from the cache of an ancestor, whose totals
+		// counted hardlinks once across that wider root.
 		nodes := scanner.cachedTree(root)
+		applyHardlinks(nodes)
+		applyAccumulation(nodes)
+		applyFileCounts(nodes)
+		applyDirCounts(nodes)
+		applyUsage(nodes)
+		applyAges(nodes, time.Now())
 		scanner.replaceCache(root, nodes)
+		scanner.snapshotLoaded(req)
+		if req.IndexArchives {
+			scanner.indexArchives(ctx, root, progress)
+		}
 		progressNonBlocking(progress, ScanProgress{Path: root, Scanned: 0, Completed: true})
-		return ScanResult{RootPath: root, Duration: time.Since(start)}, nil
+		return ScanResult{RootPath: root, Duration: time.Since(start), Errors: scanner.errorsWithin(root)}, nil
 	}
 
 	if scanner.isCached(root) {
 		scanner.mu.Lock()
 		scanner.root = root
 		scanner.mu.Unlock()
-		progressNonBlocking(progress, ScanProgress{Path: root, Scanned: 0, Completed: true})
-		return ScanResult{RootPath: root, Duration: time.Since(start)}, nil
-	}
-
-	nodes := make(map[string]*domain.Node)
-	rootNode := &domain.Node{
-		ID:      root,
-		Name:    filepath.Base(root),
-		Path:    root,
-		Type:    domain.NodeDir,
-		Scanned: true,
-	}
-	if rootNode.Name == "." || rootNode.Name == string(filepath.Separator) {
-		rootNode.Name = root
-	}
-	rootNode.ParentID = ""
-	nodes[root] = rootNode
-
-	workerCount := maxInt(2, runtime.NumCPU())
-	jobs := make(chan fileJob, workerCount*8)
-	results := make(chan fileResult, workerCount*8)
-	var wg sync.WaitGroup
-	var nodesMu sync.Mutex
-	resultsDone := make(chan struct{})
-	for i := 0; i < workerCount; i++ {
-		wg.Add(1)
-		go worker(ctx, jobs, results, &wg)
-	}
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
-	go func() {
-		defer close(resultsDone)
-		var processed int64
-		for result := range results {
-			processed++
-			nodesMu.Lock()
-			node, ok := nodes[result.path]
-			if ok && result.err == nil {
-				node.SizeBytes = result.size
-				node.AccumBytes = result.size
-			}
-			nodesMu.Unlock()
-			if processed%200 == 0 {
-				progressNonBlocking(progress, ScanProgress{Path: root, Scanned: processed, Current: result.path})
-			}
-		}
-	}()
-
-	var scannedCount int64
-	walkErr := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
-		if err != nil {
-			if isPermissionErr(err) {
-				progressNonBlocking(progress, ScanProgress{Path: path, Scanned: scannedCount, ErrMessage: err.Error()})
-				return nil
-			}
-			return err
-		}
-
-		if ctx.Err() != nil {
-			return ctx.Err()
-		}
-
-		if path != root {
-			if !req.ShowHidden && isHidden(entry.Name()) {
-				if entry.IsDir() {
-					return filepath.SkipDir
-				}
-				return nil
-			}
-			if !req.ShowHidden && scanner.isExcluded(entry.Name()) {
-				if entry.IsDir() {
-					return filepath.SkipDir
-				}
-				return nil
-			}
-			if scanner.maxDepth > 0 && depthFrom(root, path) > scanner.maxDepth {
-				if entry.IsDir() {
-					return filepath.SkipDir
-				}
-				return nil
-			}
-		}
-
-		if entry.IsDir() {
-			if scanner.canReuseDir(path, entry, req.ShowHidden) {
-				scanner.mergeCachedSubtree(path, nodes, &nodesMu)
-				progressNonBlocking(progress, ScanProgress{Path: path, Scanned: scannedCount, Current: path})
-				return filepath.SkipDir
-			}
-			nodesMu.Lock()
-			nodes[path] = &domain.Node{
-				ID:       path,
-				Name:     entry.Name(),
-				Path:     path,
-				Type:     domain.NodeDir,
-				ParentID: parentPath(root, path),
-				Scanned:  true,
-			}
-			nodesMu.Unlock()
-		} else {
-			nodesMu.Lock()
-			nodes[path] = &domain.Node{
-				ID:       path,
-				Name:     entry.Name(),
-				Path:     path,
-				Type:     domain.NodeFile,
-				ParentID: parentPath(root, path),
-			}
-			nodesMu.Unlock()
-			jobs <- fileJob{path: path}
-		}
-
-		scannedCount++
-		if scannedCount%50 == 0 {
-			progressNonBlocking(progress, ScanProgress{Path: path, Scanned: scannedCount, Current: path})
+		if req.IndexArchives {
+			scanner.indexArchives(ctx, root, progress)
 		}
+		progressNonBlocking(progress, ScanProgress{Path: root, Scanned: 0, Completed: true})
+		return ScanResult{RootPath: root, Duration: time.Since(start), Errors: scanner.errorsWithin(root)}, nil
+	}
 
-		return nil
-	})
-	close(jobs)
-	<-resultsDone
+	walk := newScanWalk(ctx, scanner, req, root, progress)
+	walkErr := walk.run(scanConcurrency(req.Concurrency))
 
 	if walkErr != nil {
 		return ScanResult{RootPath: root, Duration: time.Since(start)}, walkErr
 	}
 
-	nodesMu.Lock()
+	nodes := walk.nodes
 	applyHierarchy(nodes)
+	applyHardlinks(nodes)
 	applyAccumulation(nodes)
 	applyFileCounts(nodes)
 	applyDirCounts(nodes)
-	nodesMu.Unlock()
+	applyUsage(nodes)
+	applyAges(nodes, time.Now())
+	applyIncomplete(nodes)
 
-	scanner.replaceCache(root, nodes)
-	scanner.saveCache(nodes, req.ShowHidden)
-	progress <- ScanProgress{Path: root, Scanned: scannedCount, Completed: true}
+	scanner.setErrors(root, walk.scanErrors())
+	if merged := scanner.replaceCache(root, nodes); merged {
+		scanner.snapshotLoaded(req)
+	} else {
+		scanner.saveCache(root, nodes, req)
+	}
+	if req.IndexArchives {
+		scanner.indexArchives(ctx, root, progress)
+	}
+	progress <- ScanProgress{Path: root, Scanned: walk.scanned, Completed: true}
 
-	return ScanResult{RootPath: root, Duration: time.Since(start)}, nil
+	return ScanResult{RootPath: root, Duration: time.Since(start), Errors: scanner.errorsWithin(root)}, nil
+}
+
+// setErrors replaces the recorded errors below root with those of a new walk.
+func (scanner *FSScanner) setErrors(root string, scanErrors []ScanError) {
+	scanner.mu.Lock()
+	defer scanner.mu.Unlock()
+	for path := range scanner.scanErrors {
+		if isWithin(root, path) {
+			delete(scanner.scanErrors, path)
+		}
+	}
+	for _, scanErr := range scanErrors {
+		scanner.scanErrors[scanErr.Path] = scanErr
+	}
+}
+
+func (scanner *FSScanner) errorsWithin(root string) []ScanError {
+	scanner.mu.RLock()
+	defer scanner.mu.RUnlock()
+	list := []ScanError{}
+	for path, scanErr := range scanner.scanErrors {
+		if isWithin(root, path) {
+			list = append(list, scanErr)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Path < list[j].Path
+	})
+	return list
 }
 
 func worker(ctx context.Context, jobs <-chan fileJob, results chan<- fileResult, wg *sync.WaitGroup) {
@@ -282,11 +243,7 @@ func worker(ctx context.Context, jobs <-chan fileJob, results chan<- fileResult,
 			return
 		}
 		info, err := os.Lstat(job.path)
-		if err != nil {
-			results <- fileResult{path: job.path, err: err}
-			continue
-		}
-		results <- fileResult{path: job.path, size: info.Size()}
+		results <- fileResult{path: job.path, info: info, err: err}
 	}
 }
 
@@ -303,9 +260,20 @@ func (scanner *FSScanner) isCached(root string) bool {
 	return scanner.scannedDirs[root]
 }
 
-func (scanner *FSScanner) replaceCache(root string, nodes map[string]*domain.Node) {
+// replaceCache swaps the cached subtree at root for nodes. When root lies
+// inside the tree that is already loaded, the subtree is merged in place and
+// the totals of its ancestors are adjusted; it reports whether that happened.
+func (scanner *FSScanner) replaceCache(root string, nodes map[string]*domain.Node) bool {
 	scanner.mu.Lock()
 	defer scanner.mu.Unlock()
+	parent := filepath.Dir(root)
+	_, hasParent := scanner.cache[parent]
+	merging := scanner.root != "" && scanner.root != root && isWithin(scanner.root, root) && hasParent
+	var previous *domain.Node
+	if node, ok := scanner.cache[root]; ok {
+		clone := *node
+		previous = &clone
+	}
 	for key := range scanner.cache {
 		if isWithin(root, key) {
 			delete(scanner.cache, key)
@@ -313,11 +281,10 @@ func (scanner *FSScanner) replaceCache(root string, nodes map[string]*domain.Nod
 	}
 	for key, node := range nodes {
 		scanner.cache[key] = node
-		if node.Type == domain.NodeDir {
+		if node.Type == domain.NodeDir && node.Scanned {
 			scanner.scannedDirs[key] = true
 		}
 	}
-	parent := filepath.Dir(root)
 	if parent != root {
 		if parentNode, ok := scanner.cache[parent]; ok {
 			if !containsID(parentNode.ChildrenIDs, root) {
@@ -326,12 +293,93 @@ func (scanner *FSScanner) replaceCache(root string, nodes map[string]*domain.Nod
 			}
 		}
 	}
+	if merging {
+		if rootNode, ok := scanner.cache[root]; ok {
+			rootNode.ParentID = parent
+			scanner.propagateLocked(parent, rootNode, previous)
+		}
+		return true
+	}
 	scanner.root = root
+	return false
 }
 
-func (scanner *FSScanner) isExcluded(name string) bool {
-	_, excluded := scanner.exclusions[name]
-	return excluded
+// propagateLocked applies the difference between previous and current to
+// every ancestor starting at parentID. previous is nil for a new node and
+// current is nil for a removed one.
+func (scanner *FSScanner) propagateLocked(parentID string, current, previous *domain.Node) {
+	var before, after domain.Node
+	if previous != nil {
+		before = *previous
+	}
+	if current != nil {
+		after = *current
+	}
+	deltaBytes := after.AccumBytes - before.AccumBytes
+	deltaShared := after.SharedBytes - before.SharedBytes
+	deltaFiles := after.FileCount - before.FileCount
+	deltaDirs := after.DirCount - before.DirCount
+	addedTypes, removedTypes := categoryTotals(current), categoryTotals(previous)
+	addedOwners, removedOwners := ownerTotals(current), ownerTotals(previous)
+	now := time.Now()
+	addedAges := ageHistogram(current, now)
+	removedAges := ageHistogram(previous, now)
+	if previous == nil && after.Type == domain.NodeDir {
+		deltaDirs++
+	}
+	if current == nil && before.Type == domain.NodeDir {
+		deltaDirs--
+	}
+	for id := parentID; id != ""; {
+		node, ok := scanner.cache[id]
+		if !ok {
+			return
+		}
+		node.AccumBytes += deltaBytes
+		node.SharedBytes += deltaShared
+		node.FileCount += deltaFiles
+		node.DirCount += deltaDirs
+		node.Categories = addUsage(addUsage(node.Categories, addedTypes, 1), removedTypes, -1)
+		node.Owners = addUsage(addUsage(node.Owners, addedOwners, 1), removedOwners, -1)
+		node.ModAges = node.ModAges.Add(addedAges, 1).Add(removedAges, -1)
+		if current != nil {
+			applyNewest(node, current)
+		}
+		if after.Incomplete {
+			node.Incomplete = true
+		}
+		id = node.ParentID
+	}
+}
+
+func cloneNodes(nodes map[string]*domain.Node) map[string]*domain.Node {
+	copyMap := make(map[string]*domain.Node, len(nodes))
+	for id, node := range nodes {
+		clone := *node
+		if node.ChildrenIDs != nil {
+			clone.ChildrenIDs = append([]string{}, node.ChildrenIDs...)
+		}
+		clone.Categories = cloneUsage(node.Categories)
+		clone.Owners = cloneUsage(node.Owners)
+		copyMap[id] = &clone
+	}
+	return copyMap
+}
+
+func skippedNode(root, path string, entry fs.DirEntry, req ScanRequest, reason domain.SkipReason) *domain.Node {
+	node := &domain.Node{
+		ID:       path,
+		Name:     entry.Name(),
+		Path:     path,
+		Type:     domain.NodeDir,
+		SizeMode: req.SizeMode,
+		ParentID: parentPath(root, path),
+		Skipped:  reason,
+	}
+	if info, err := entry.Info(); err == nil {
+		fsinfo.Apply(node, info)
+	}
+	return node
 }
 
 func applyHierarchy(nodes map[string]*domain.Node) {
@@ -350,6 +398,45 @@ func applyHierarchy(nodes map[string]*domain.Node) {
 	}
 }
 
+// applyHardlinks counts every hardlinked inode once per scan, including files
+// reached through followed symlinks. The first path in lexical order carries
+// the bytes, preferring a real path over a symlink; the other links keep
+// their SizeBytes but contribute nothing to their ancestors.
+func applyHardlinks(nodes map[string]*domain.Node) {
+	linked := make(map[inodeKey]bool)
+	for _, node := range nodes {
+		if node.Type == domain.NodeFile && node.LinkTarget != "" && node.Inode != 0 {
+			linked[inodeKey{dev: node.Device, ino: node.Inode}] = true
+		}
+	}
+	groups := make(map[inodeKey][]*domain.Node)
+	for _, node := range nodes {
+		if node.Type != domain.NodeFile || node.Inode == 0 {
+			continue
+		}
+		key := inodeKey{dev: node.Device, ino: node.Inode}
+		if !node.Shared && !linked[key] {
+			continue
+		}
+		groups[key] = append(groups[key], node)
+	}
+	for _, group := range groups {
+		sort.Slice(group, func(i, j int) bool {
+			if (group[i].LinkTarget == "") != (group[j].LinkTarget == "") {
+				return group[i].LinkTarget == ""
+			}
+			return group[i].Path < group[j].Path
+		})
+		for index, node := range group {
+			if index == 0 {
+				node.AccumBytes = node.SizeBytes
+				continue
+			}
+			node.AccumBytes = 0
+		}
+	}
+}
+
 func applyAccumulation(nodes map[string]*domain.Node) {
 	paths := make([]string, 0, len(nodes))
 	for path := range nodes {
@@ -361,19 +448,25 @@ func applyAccumulation(nodes map[string]*domain.Node) {
 
 	for _, path := range paths {
 		node := nodes[path]
-		if node.Type == domain.NodeFile {
-			if node.AccumBytes == 0 {
+		if node.Type != domain.NodeDir {
+			if node.AccumBytes == 0 && !node.Shared {
 				node.AccumBytes = node.SizeBytes
 			}
+			node.SharedBytes = 0
+			if node.Shared {
+				node.SharedBytes = node.AccumBytes
+			}
 			continue
 		}
-		var total int64
+		var total, shared int64
 		for _, childID := range node.ChildrenIDs {
 			if child, ok := nodes[childID]; ok {
 				total += child.AccumBytes
+				shared += child.SharedBytes
 			}
 		}
 		node.AccumBytes = total
+		node.SharedBytes = shared
 	}
 }
 
@@ -388,7 +481,7 @@ func applyFileCounts(nodes map[string]*domain.Node) {
 
 	for _, path := range paths {
 		node := nodes[path]
-		if node.Type == domain.NodeFile {
+		if node.Type != domain.NodeDir {
 			node.FileCount = 1
 			continue
 		}
@@ -413,7 +506,7 @@ func applyDirCounts(nodes map[string]*domain.Node) {
 
 	for _, path := range paths {
 		node := nodes[path]
-		if node.Type == domain.NodeFile {
+		if node.Type != domain.NodeDir {
 			node.DirCount = 0
 			continue
 		}
@@ -430,6 +523,25 @@ func applyDirCounts(nodes map[string]*domain.Node) {
 	}
 }
 
+func deviceOf(path string) (uint64, bool) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0, false
+	}
+	stat, ok := fsinfo.Of(info)
+	if !ok {
+		return 0, false
+	}
+	return stat.Dev, true
+}
+
+func normalizeSizeMode(mode domain.SizeMode) domain.SizeMode {
+	if mode == domain.SizeDisk {
+		return domain.SizeDisk
+	}
+	return domain.SizeApparent
+}
+
 func progressNonBlocking(ch chan<- ScanProgress, msg ScanProgress) {
 	select {
 	case ch <- msg:
@@ -445,7 +557,7 @@ func isWithin(root, path string) bool {
 	if root == path {
 		return true
 	}
-	rootWithSep := root + string(filepath.Separator)
+	rootWithSep := strings.TrimSuffix(root, string(filepath.Separator)) + string(filepath.Separator)
 	return strings.HasPrefix(path, rootWithSep)
 }
 
@@ -478,8 +590,31 @@ func depthFrom(root, path string) int {
 	return pathDepth - rootDepth
 }
 
-func isPermissionErr(err error) bool {
-	return errors.Is(err, os.ErrPermission)
+func errorKind(err error) domain.ErrorKind {
+	var errno syscall.Errno
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return domain.ErrorPermission
+	case errors.Is(err, fs.ErrNotExist):
+		return domain.ErrorVanished
+	case errors.As(err, &errno):
+		return domain.ErrorIO
+	default:
+		return domain.ErrorOther
+	}
+}
+
+// applyIncomplete marks unreadable nodes and all of their ancestors, whose
+// totals are missing whatever could not be read.
+func applyIncomplete(nodes map[string]*domain.Node) {
+	for _, node := range nodes {
+		if node.ReadError == "" {
+			continue
+		}
+		for current := node; current != nil && !current.Incomplete; current = nodes[current.ParentID] {
+			current.Incomplete = true
+		}
+	}
 }
 
 func containsID(ids []string, target string) bool {
@@ -497,3 +632,10 @@ func maxInt(a, b int) int {
 	}
 	return b
 }
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
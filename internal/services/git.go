@@ -0,0 +1,809 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// gitWalkLimit bounds how many commits the unpushed check reads per branch.
+const gitWalkLimit = 20000
+
+const gitSampleLimit = 5
+
+// GitStatus is what would be lost with a git working tree: changes not
+// committed, files git does not track and commits no remote has. It is read
+// from .git directly, without running git or contacting a remote. Scope
+// limits the file checks to a path inside the work tree; commits are only
+// checked when the whole work tree is in scope.
+type GitStatus struct {
+	WorkTree  string
+	Scope     string
+	GitDir    string
+	Branch    string
+	GitBytes  int64
+	Modified  int
+	Untracked int
+	Conflicts int
+	Samples   []string
+	Unpushed  []string
+	Stashed   bool
+	Operation string
+	Error     string
+}
+
+func (status GitStatus) Dirty() bool {
+	return status.Modified > 0 || status.Untracked > 0 || status.Conflicts > 0 || len(status.Unpushed) > 0 ||
+		status.Stashed || status.Operation != "" || status.Error != ""
+}
+
+// Warnings describes the dirty state, one line per kind of loss.
+func (status GitStatus) Warnings() []string {
+	where := status.WorkTree
+	if status.Scope != "" && status.Scope != status.WorkTree {
+		where = status.Scope
+	}
+	warnings := []string{}
+	if status.Error != "" {
+		warnings = append(warnings, fmt.Sprintf("git %s: cannot read status: %s", where, status.Error))
+	}
+	if status.Modified > 0 || status.Untracked > 0 || status.Conflicts > 0 {
+		warnings = append(warnings, fmt.Sprintf("git %s: %d modified, %d untracked, %d conflicted files", where, status.Modified, status.Untracked, status.Conflicts))
+	}
+	for _, line := range status.Unpushed {
+		warnings = append(warnings, fmt.Sprintf("git %s: %s", where, line))
+	}
+	if status.Stashed {
+		warnings = append(warnings, fmt.Sprintf("git %s: stash is not empty", where))
+	}
+	if status.Operation != "" {
+		warnings = append(warnings, fmt.Sprintf("git %s: %s in progress", where, status.Operation))
+	}
+	return warnings
+}
+
+func (status *GitStatus) sample(line string) {
+	if len(status.Samples) < gitSampleLimit {
+		status.Samples = append(status.Samples, line)
+	}
+}
+
+type gitRepo struct {
+	workTree    string
+	gitDir      string
+	commonDir   string
+	hashSize    int
+	config      map[string]string
+	packedRefs  map[string]string
+	packs       []*gitPack
+	packsLoaded bool
+	commits     map[string]gitCommit
+}
+
+type gitIndexEntry struct {
+	name         string
+	mode         uint32
+	size         uint32
+	mtimeSec     uint32
+	mtimeNsec    uint32
+	hash         []byte
+	stage        int
+	skipWorktree bool
+}
+
+// InspectGitRepo reads the full state of the work tree at workTree.
+func InspectGitRepo(ctx context.Context, workTree string) (GitStatus, error) {
+	return inspectGit(ctx, workTree, workTree)
+}
+
+func inspectGit(ctx context.Context, workTree, scope string) (GitStatus, error) {
+	status := GitStatus{WorkTree: workTree, Scope: scope}
+	repo, err := openGitRepo(workTree)
+	if err != nil {
+		return status, err
+	}
+	defer repo.close()
+	status.GitDir = repo.gitDir
+
+	entries, err := repo.readIndex()
+	if err != nil {
+		return status, err
+	}
+	prefix := ""
+	if scope != workTree {
+		rel, err := filepath.Rel(workTree, scope)
+		if err != nil {
+			return status, err
+		}
+		prefix = filepath.ToSlash(rel)
+	}
+	tracked := make(map[string]struct{}, len(entries))
+	conflicted := make(map[string]struct{})
+	for _, entry := range entries {
+		tracked[entry.name] = struct{}{}
+		if prefix != "" && entry.name != prefix && !strings.HasPrefix(entry.name, prefix+"/") {
+			continue
+		}
+		if ctx.Err() != nil {
+			return status, ctx.Err()
+		}
+		if entry.stage != 0 {
+			if _, ok := conflicted[entry.name]; !ok {
+				conflicted[entry.name] = struct{}{}
+				status.sample("U " + entry.name)
+			}
+			continue
+		}
+		if !entry.skipWorktree && repo.changed(entry) {
+			status.Modified++
+			status.sample("M " + entry.name)
+		}
+	}
+	status.Conflicts = len(conflicted)
+	err = repo.untracked(ctx, scope, tracked, func(rel string) {
+		status.Untracked++
+		status.sample("? " + rel)
+	})
+	if err != nil {
+		return status, err
+	}
+	if scope != workTree {
+		return status, nil
+	}
+
+	status.Branch = repo.branch()
+	status.Unpushed = repo.unpushed()
+	_, err = repo.resolveRef("refs/stash")
+	status.Stashed = err == nil
+	status.Operation = repo.operation()
+	status.GitBytes = treeBytes(repo.gitDir)
+	return status, nil
+}
+
+// findGitWorkTree returns the closest directory above path that holds a .git
+// entry.
+func findGitWorkTree(path string) (string, bool) {
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Lstat(filepath.Join(dir, ".git")); err == nil {
+			return dir, true
+		}
+		if dir == filepath.Dir(dir) {
+			return "", false
+		}
+	}
+}
+
+// gitPreview inspects the work trees an action would touch: those found at or
+// below the sources, and the enclosing work tree of each source, limited to
+// that source. Only dirty work trees are returned.
+func gitPreview(ctx context.Context, paths, workTrees []string) []GitStatus {
+	full := make(map[string]struct{}, len(workTrees))
+	for _, workTree := range workTrees {
+		full[workTree] = struct{}{}
+	}
+	type check struct{ workTree, scope string }
+	checks := []check{}
+	for _, workTree := range workTrees {
+		checks = append(checks, check{workTree, workTree})
+	}
+	for _, path := range paths {
+		workTree, ok := findGitWorkTree(path)
+		if !ok {
+			continue
+		}
+		if _, ok := full[workTree]; ok {
+			continue
+		}
+		checks = append(checks, check{workTree, path})
+	}
+	statuses := []GitStatus{}
+	for _, item := range checks {
+		status, err := inspectGit(ctx, item.workTree, item.scope)
+		if err != nil {
+			if ctx.Err() != nil {
+				return statuses
+			}
+			status.Error = err.Error()
+		}
+		if status.Dirty() {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+// findGitWorkTrees lists the work trees at or below paths. A selected .git
+// directory counts as its whole work tree.
+func findGitWorkTrees(ctx context.Context, paths []string) []string {
+	seen := make(map[string]struct{})
+	workTrees := []string{}
+	for _, path := range paths {
+		_ = filepath.WalkDir(path, func(child string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if entry.Name() != ".git" {
+				return nil
+			}
+			workTree := filepath.Dir(child)
+			if _, ok := seen[workTree]; !ok {
+				seen[workTree] = struct{}{}
+				workTrees = append(workTrees, workTree)
+			}
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+	}
+	return workTrees
+}
+
+func openGitRepo(workTree string) (*gitRepo, error) {
+	dotGit := filepath.Join(workTree, ".git")
+	info, err := os.Lstat(dotGit)
+	if err != nil {
+		return nil, err
+	}
+	gitDir := dotGit
+	if !info.IsDir() {
+		data, err := os.ReadFile(dotGit)
+		if err != nil {
+			return nil, err
+		}
+		line := strings.TrimSpace(string(data))
+		if !strings.HasPrefix(line, "gitdir:") {
+			return nil, fmt.Errorf("%s: not a gitdir file", dotGit)
+		}
+		gitDir = resolveGitPath(workTree, strings.TrimSpace(strings.TrimPrefix(line, "gitdir:")))
+	}
+	commonDir := gitDir
+	if data, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir = resolveGitPath(gitDir, strings.TrimSpace(string(data)))
+	}
+	repo := &gitRepo{
+		workTree:  workTree,
+		gitDir:    gitDir,
+		commonDir: commonDir,
+		hashSize:  sha1.Size,
+		config:    readGitConfig(filepath.Join(commonDir, "config")),
+		commits:   make(map[string]gitCommit),
+	}
+	if strings.EqualFold(repo.config["extensions.objectformat"], "sha256") {
+		repo.hashSize = sha256.Size
+	}
+	return repo, nil
+}
+
+func resolveGitPath(base, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(base, path)
+}
+
+func (repo *gitRepo) close() {
+	for _, pack := range repo.packs {
+		pack.close()
+	}
+}
+
+// readGitConfig flattens a git config file into "section.subsection.key"
+// names. Section and key names are lower-cased, subsections are not.
+func readGitConfig(path string) map[string]string {
+	values := make(map[string]string)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return values
+	}
+	section := ""
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			end := strings.Index(line, "]")
+			if end < 0 {
+				continue
+			}
+			name, sub, found := strings.Cut(line[1:end], " ")
+			section = strings.ToLower(strings.TrimSpace(name))
+			if found {
+				section += "." + strings.Trim(strings.TrimSpace(sub), `"`)
+			}
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		values[section+"."+strings.ToLower(strings.TrimSpace(key))] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return values
+}
+
+func (repo *gitRepo) readIndex() ([]gitIndexEntry, error) {
+	path := filepath.Join(repo.gitDir, "index")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(data) < 12 || string(data[:4]) != "DIRC" {
+		return nil, fmt.Errorf("%s: not a git index", path)
+	}
+	version := binary.BigEndian.Uint32(data[4:8])
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("%s: unsupported index version %d", path, version)
+	}
+	count := int(binary.BigEndian.Uint32(data[8:12]))
+	truncated := fmt.Errorf("%s: truncated index", path)
+	fixed := 40 + repo.hashSize + 2
+	entries := make([]gitIndexEntry, 0, count)
+	offset := 12
+	previous := ""
+	for index := 0; index < count; index++ {
+		start := offset
+		if start+fixed > len(data) {
+			return nil, truncated
+		}
+		field := func(number int) uint32 {
+			return binary.BigEndian.Uint32(data[start+number*4:])
+		}
+		entry := gitIndexEntry{mtimeSec: field(2), mtimeNsec: field(3), mode: field(6), size: field(9)}
+		entry.hash = data[start+40 : start+40+repo.hashSize]
+		flags := binary.BigEndian.Uint16(data[start+40+repo.hashSize:])
+		entry.stage = int(flags>>12) & 3
+		offset = start + fixed
+		if version >= 3 && flags&0x4000 != 0 {
+			if offset+2 > len(data) {
+				return nil, truncated
+			}
+			entry.skipWorktree = binary.BigEndian.Uint16(data[offset:])&0x4000 != 0
+			offset += 2
+		}
+		if version == 4 {
+			strip, err := readOffsetVarint(bytes.NewReader(data[offset:]))
+			if err != nil || int(strip) > len(previous) {
+				return nil, truncated
+			}
+			for data[offset]&0x80 != 0 {
+				offset++
+			}
+			offset++
+			end := bytes.IndexByte(data[offset:], 0)
+			if end < 0 {
+				return nil, truncated
+			}
+			entry.name = previous[:len(previous)-int(strip)] + string(data[offset:offset+end])
+			offset += end + 1
+		} else {
+			end := bytes.IndexByte(data[offset:], 0)
+			if end < 0 {
+				return nil, truncated
+			}
+			entry.name = string(data[offset : offset+end])
+			offset = start + (offset-start+end+8)&^7
+		}
+		previous = entry.name
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// changed compares a tracked file with its index entry: by size and mtime
+// first, and by content when only the mtime differs. Content filters such as
+// line-ending conversion are not applied, so such files may read as changed.
+func (repo *gitRepo) changed(entry gitIndexEntry) bool {
+	if entry.mode&0o170000 == 0o160000 {
+		return false
+	}
+	path := filepath.Join(repo.workTree, filepath.FromSlash(entry.name))
+	info, err := os.Lstat(path)
+	if err != nil {
+		return true
+	}
+	symlink := entry.mode&0o170000 == 0o120000
+	if symlink != (info.Mode()&os.ModeSymlink != 0) || (!symlink && !info.Mode().IsRegular()) {
+		return true
+	}
+	if uint32(info.Size()) != entry.size {
+		return true
+	}
+	modTime := info.ModTime()
+	if uint32(modTime.Unix()) == entry.mtimeSec && uint32(modTime.Nanosecond()) == entry.mtimeNsec {
+		return false
+	}
+	sum, err := repo.blobHash(path, info, symlink)
+	return err != nil || !bytes.Equal(sum, entry.hash)
+}
+
+func (repo *gitRepo) blobHash(path string, info os.FileInfo, symlink bool) ([]byte, error) {
+	var hasher hash.Hash = sha1.New()
+	if repo.hashSize == sha256.Size {
+		hasher = sha256.New()
+	}
+	if symlink {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(hasher, "blob %d\x00%s", len(target), target)
+		return hasher.Sum(nil), nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	fmt.Fprintf(hasher, "blob %d\x00", info.Size())
+	if _, err := io.Copy(hasher, file); err != nil {
+		return nil, err
+	}
+	return hasher.Sum(nil), nil
+}
+
+// untracked reports files below scope that are neither tracked nor ignored.
+// Nested work trees are left to their own inspection, and the .git file of a
+// linked work tree is not a file of the tree.
+func (repo *gitRepo) untracked(ctx context.Context, scope string, tracked map[string]struct{}, report func(rel string)) error {
+	patterns := readLines(repo.excludesFile())
+	patterns = append(patterns, readLines(filepath.Join(repo.commonDir, "info", "exclude"))...)
+	ignores := newIgnoreTree(repo.workTree, patterns)
+	ignores.fileName = ".gitignore"
+	for _, dir := range ancestorsBelow(repo.workTree, scope) {
+		_, _ = ignores.load(dir)
+	}
+	err := filepath.WalkDir(scope, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if entry.Name() == ".git" {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			if path != repo.workTree {
+				if _, err := os.Lstat(filepath.Join(path, ".git")); err == nil {
+					return filepath.SkipDir
+				}
+				if _, ignored := ignores.match(path, true); ignored {
+					return filepath.SkipDir
+				}
+			}
+			_, _ = ignores.load(path)
+			return nil
+		}
+		rel, err := filepath.Rel(repo.workTree, path)
+		if err != nil {
+			return nil
+		}
+		if _, ok := tracked[filepath.ToSlash(rel)]; ok {
+			return nil
+		}
+		if _, ignored := ignores.match(path, false); ignored {
+			return nil
+		}
+		report(filepath.ToSlash(rel))
+		return nil
+	})
+	return err
+}
+
+// excludesFile is the user's ignore file: core.excludesFile from the
+// repository or global config, or git's default $XDG_CONFIG_HOME/git/ignore.
+func (repo *gitRepo) excludesFile() string {
+	home, _ := os.UserHomeDir()
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" && home != "" {
+		configHome = filepath.Join(home, ".config")
+	}
+	path, ok := repo.config["core.excludesfile"]
+	globals := []string{}
+	if home != "" {
+		globals = append(globals, filepath.Join(home, ".gitconfig"))
+	}
+	if configHome != "" {
+		globals = append(globals, filepath.Join(configHome, "git", "config"))
+	}
+	for _, global := range globals {
+		if ok {
+			break
+		}
+		path, ok = readGitConfig(global)["core.excludesfile"]
+	}
+	if !ok {
+		if configHome == "" {
+			return ""
+		}
+		return filepath.Join(configHome, "git", "ignore")
+	}
+	if rest, found := strings.CutPrefix(path, "~/"); found && home != "" {
+		return filepath.Join(home, rest)
+	}
+	return path
+}
+
+func readLines(path string) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	lines := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+// resolveRef follows symbolic refs to an object name. HEAD belongs to the
+// work tree's git dir, other refs to the common dir.
+func (repo *gitRepo) resolveRef(name string) (string, error) {
+	for depth := 0; depth < 8; depth++ {
+		dir := repo.commonDir
+		if name == "HEAD" {
+			dir = repo.gitDir
+		}
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			if value, ok := repo.readPackedRefs()[name]; ok {
+				return value, nil
+			}
+			return "", err
+		}
+		value := strings.TrimSpace(string(data))
+		if !strings.HasPrefix(value, "ref:") {
+			return value, nil
+		}
+		name = strings.TrimSpace(strings.TrimPrefix(value, "ref:"))
+	}
+	return "", fmt.Errorf("%s: too many symbolic refs", name)
+}
+
+func (repo *gitRepo) readPackedRefs() map[string]string {
+	if repo.packedRefs != nil {
+		return repo.packedRefs
+	}
+	repo.packedRefs = make(map[string]string)
+	for _, line := range readLines(filepath.Join(repo.commonDir, "packed-refs")) {
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+		value, name, ok := strings.Cut(line, " ")
+		if ok {
+			repo.packedRefs[name] = value
+		}
+	}
+	return repo.packedRefs
+}
+
+// refs lists the refs below prefix, such as "refs/heads/", with loose refs
+// taking precedence over packed ones.
+func (repo *gitRepo) refs(prefix string) []string {
+	names := make(map[string]struct{})
+	for name := range repo.readPackedRefs() {
+		if strings.HasPrefix(name, prefix) {
+			names[name] = struct{}{}
+		}
+	}
+	root := filepath.Join(repo.commonDir, filepath.FromSlash(prefix))
+	_ = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(repo.commonDir, path)
+		if err == nil {
+			names[filepath.ToSlash(rel)] = struct{}{}
+		}
+		return nil
+	})
+	result := make([]string, 0, len(names))
+	for name := range names {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// branch is the checked-out branch, or "" for a detached HEAD.
+func (repo *gitRepo) branch() string {
+	data, err := os.ReadFile(filepath.Join(repo.gitDir, "HEAD"))
+	if err != nil {
+		return ""
+	}
+	value := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(value, "ref:") {
+		return ""
+	}
+	return strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(value, "ref:")), "refs/heads/")
+}
+
+func (repo *gitRepo) operation() string {
+	markers := []struct{ name, operation string }{
+		{"MERGE_HEAD", "merge"},
+		{"rebase-merge", "rebase"},
+		{"rebase-apply", "rebase"},
+		{"CHERRY_PICK_HEAD", "cherry-pick"},
+		{"REVERT_HEAD", "revert"},
+		{"BISECT_LOG", "bisect"},
+	}
+	for _, marker := range markers {
+		if _, err := os.Lstat(filepath.Join(repo.gitDir, marker.name)); err == nil {
+			return marker.operation
+		}
+	}
+	return ""
+}
+
+// unpushed describes local branches with commits that their upstream, or
+// any remote-tracking branch when there is no upstream, does not have.
+func (repo *gitRepo) unpushed() []string {
+	remoteRefs := repo.refs("refs/remotes/")
+	remoteTips := []string{}
+	for _, name := range remoteRefs {
+		if tip, err := repo.resolveRef(name); err == nil {
+			remoteTips = append(remoteTips, tip)
+		}
+	}
+	branches := repo.refs("refs/heads/")
+	if len(remoteTips) == 0 {
+		if len(branches) == 0 {
+			return nil
+		}
+		return []string{"no remote, history exists only here"}
+	}
+	lines := []string{}
+	check := func(label, tip string, against []string, target string) {
+		count, complete := repo.commitsNotIn(tip, against)
+		switch {
+		case !complete:
+			lines = append(lines, fmt.Sprintf("%s may have commits not on %s", label, target))
+		case count > 0:
+			lines = append(lines, fmt.Sprintf("%s has %d commits not on %s", label, count, target))
+		}
+	}
+	for _, name := range branches {
+		tip, err := repo.resolveRef(name)
+		if err != nil {
+			continue
+		}
+		branch := strings.TrimPrefix(name, "refs/heads/")
+		if upstream := repo.upstream(branch); upstream != "" {
+			if upstreamTip, err := repo.resolveRef(upstream); err == nil {
+				check(branch, tip, []string{upstreamTip}, strings.TrimPrefix(upstream, "refs/remotes/"))
+				continue
+			}
+		}
+		check(branch, tip, remoteTips, "any remote")
+	}
+	if repo.branch() == "" {
+		if tip, err := repo.resolveRef("HEAD"); err == nil {
+			check("detached HEAD", tip, remoteTips, "any remote")
+		}
+	}
+	return lines
+}
+
+func (repo *gitRepo) upstream(branch string) string {
+	remote := repo.config["branch."+branch+".remote"]
+	merge := repo.config["branch."+branch+".merge"]
+	if remote == "" || remote == "." || merge == "" {
+		return ""
+	}
+	return "refs/remotes/" + remote + "/" + strings.TrimPrefix(merge, "refs/heads/")
+}
+
+const (
+	gitFromLocal uint8 = 1 << iota
+	gitFromRemote
+)
+
+// commitsNotIn counts the commits reachable from tip but from none of others.
+// It walks both sides newest first and stops once every pending commit is
+// reachable from others. The bool is false when the walk hit its limit or
+// could not read tip.
+func (repo *gitRepo) commitsNotIn(tip string, others []string) (int, bool) {
+	if _, err := repo.commit(tip); err != nil {
+		return 0, false
+	}
+	flags := make(map[string]uint8)
+	queue := &commitQueue{}
+	push := func(hash string, flag uint8) {
+		if flags[hash]&flag == flag {
+			return
+		}
+		flags[hash] |= flag
+		if commit, err := repo.commit(hash); err == nil {
+			heap.Push(queue, commitItem{hash: hash, time: commit.time})
+		}
+	}
+	push(tip, gitFromLocal)
+	for _, other := range others {
+		push(other, gitFromRemote)
+	}
+	for steps := 0; queue.Len() > 0 && !queue.settled(flags); steps++ {
+		if steps >= gitWalkLimit {
+			return 0, false
+		}
+		item := heap.Pop(queue).(commitItem)
+		for _, parent := range repo.commits[item.hash].parents {
+			push(parent, flags[item.hash])
+		}
+	}
+	count := 0
+	for hash, flag := range flags {
+		if _, ok := repo.commits[hash]; ok && flag == gitFromLocal {
+			count++
+		}
+	}
+	return count, true
+}
+
+type commitItem struct {
+	hash string
+	time int64
+}
+
+// commitQueue is a max-heap on commit time.
+type commitQueue []commitItem
+
+func (queue commitQueue) Len() int           { return len(queue) }
+func (queue commitQueue) Less(i, j int) bool { return queue[i].time > queue[j].time }
+func (queue commitQueue) Swap(i, j int)      { queue[i], queue[j] = queue[j], queue[i] }
+
+func (queue *commitQueue) Push(value any) {
+	*queue = append(*queue, value.(commitItem))
+}
+
+func (queue *commitQueue) Pop() any {
+	old := *queue
+	item := old[len(old)-1]
+	*queue = old[:len(old)-1]
+	return item
+}
+
+func (queue commitQueue) settled(flags map[string]uint8) bool {
+	for _, item := range queue {
+		if flags[item.hash]&gitFromRemote == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// treeBytes is the apparent size of everything below root.
+func treeBytes(root string) int64 {
+	var total int64
+	_ = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
@@ -0,0 +1,346 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// gitDeltaDepth bounds delta chains in packs; git itself stops at 50.
+const gitDeltaDepth = 64
+
+var errGitObjectMissing = errors.New("git object not found")
+
+var gitObjectTypes = map[byte]string{1: "commit", 2: "tree", 3: "blob", 4: "tag"}
+
+type gitCommit struct {
+	parents []string
+	time    int64
+}
+
+// gitPack is one pack file and its version 2 index.
+type gitPack struct {
+	path    string
+	file    *os.File
+	hashes  []byte
+	offsets []int64
+}
+
+// object reads an object from the loose object store or a pack.
+func (repo *gitRepo) object(hash string) (string, []byte, error) {
+	if len(hash) != repo.hashSize*2 {
+		return "", nil, fmt.Errorf("invalid object name %q", hash)
+	}
+	if data, err := os.ReadFile(filepath.Join(repo.commonDir, "objects", hash[:2], hash[2:])); err == nil {
+		return parseLooseObject(data)
+	}
+	raw, err := hex.DecodeString(hash)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, pack := range repo.loadPacks() {
+		if offset, ok := pack.find(raw, repo.hashSize); ok {
+			return pack.object(repo, offset, 0)
+		}
+	}
+	return "", nil, fmt.Errorf("%w: %s", errGitObjectMissing, hash)
+}
+
+// commit returns the parents and committer time of a commit, peeling tags.
+func (repo *gitRepo) commit(hash string) (gitCommit, error) {
+	if commit, ok := repo.commits[hash]; ok {
+		return commit, nil
+	}
+	target := hash
+	for depth := 0; depth < 8; depth++ {
+		kind, data, err := repo.object(target)
+		if err != nil {
+			return gitCommit{}, err
+		}
+		if kind == "tag" {
+			target = objectHeader(data, "object")
+			continue
+		}
+		if kind != "commit" {
+			return gitCommit{}, fmt.Errorf("%s is a %s, not a commit", hash, kind)
+		}
+		commit := parseCommit(data)
+		repo.commits[hash] = commit
+		return commit, nil
+	}
+	return gitCommit{}, fmt.Errorf("%s: too many nested tags", hash)
+}
+
+func parseCommit(data []byte) gitCommit {
+	commit := gitCommit{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			break
+		}
+		switch {
+		case strings.HasPrefix(line, "parent "):
+			commit.parents = append(commit.parents, strings.TrimPrefix(line, "parent "))
+		case strings.HasPrefix(line, "committer "):
+			fields := strings.Fields(line)
+			if len(fields) >= 2 {
+				commit.time, _ = strconv.ParseInt(fields[len(fields)-2], 10, 64)
+			}
+		}
+	}
+	return commit
+}
+
+func objectHeader(data []byte, name string) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, name+" ") {
+			return strings.TrimPrefix(line, name+" ")
+		}
+	}
+	return ""
+}
+
+func parseLooseObject(data []byte) (string, []byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", nil, err
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return "", nil, err
+	}
+	header, body, ok := bytes.Cut(content, []byte{0})
+	if !ok {
+		return "", nil, fmt.Errorf("malformed loose object")
+	}
+	kind, _, _ := strings.Cut(string(header), " ")
+	return kind, body, nil
+}
+
+// loadPacks opens the index of every pack once. Packs whose index cannot be
+// read are left out, so their objects read as missing.
+func (repo *gitRepo) loadPacks() []*gitPack {
+	if repo.packsLoaded {
+		return repo.packs
+	}
+	repo.packsLoaded = true
+	indexes, _ := filepath.Glob(filepath.Join(repo.commonDir, "objects", "pack", "*.idx"))
+	for _, indexPath := range indexes {
+		pack, err := readPackIndex(indexPath, repo.hashSize)
+		if err != nil {
+			continue
+		}
+		repo.packs = append(repo.packs, pack)
+	}
+	return repo.packs
+}
+
+func readPackIndex(path string, hashSize int) (*gitPack, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8+256*4 || !bytes.Equal(data[:4], []byte("\xfftOc")) || binary.BigEndian.Uint32(data[4:8]) != 2 {
+		return nil, fmt.Errorf("%s: unsupported pack index", path)
+	}
+	count := int(binary.BigEndian.Uint32(data[8+255*4:]))
+	hashStart := 8 + 256*4
+	offsetStart := hashStart + count*hashSize + count*4
+	largeStart := offsetStart + count*4
+	if len(data) < largeStart {
+		return nil, fmt.Errorf("%s: truncated pack index", path)
+	}
+	pack := &gitPack{
+		path:    strings.TrimSuffix(path, ".idx") + ".pack",
+		hashes:  data[hashStart : hashStart+count*hashSize],
+		offsets: make([]int64, count),
+	}
+	for index := range pack.offsets {
+		offset := binary.BigEndian.Uint32(data[offsetStart+index*4:])
+		if offset&0x80000000 == 0 {
+			pack.offsets[index] = int64(offset)
+			continue
+		}
+		large := largeStart + int(offset&0x7fffffff)*8
+		if len(data) < large+8 {
+			return nil, fmt.Errorf("%s: truncated pack index", path)
+		}
+		pack.offsets[index] = int64(binary.BigEndian.Uint64(data[large:]))
+	}
+	return pack, nil
+}
+
+func (pack *gitPack) find(hash []byte, hashSize int) (int64, bool) {
+	count := len(pack.offsets)
+	index := sort.Search(count, func(i int) bool {
+		return bytes.Compare(pack.hashes[i*hashSize:(i+1)*hashSize], hash) >= 0
+	})
+	if index < count && bytes.Equal(pack.hashes[index*hashSize:(index+1)*hashSize], hash) {
+		return pack.offsets[index], true
+	}
+	return 0, false
+}
+
+func (pack *gitPack) object(repo *gitRepo, offset int64, depth int) (string, []byte, error) {
+	if depth > gitDeltaDepth {
+		return "", nil, fmt.Errorf("%s: delta chain too deep", pack.path)
+	}
+	if pack.file == nil {
+		file, err := os.Open(pack.path)
+		if err != nil {
+			return "", nil, err
+		}
+		pack.file = file
+	}
+	reader := bufio.NewReader(io.NewSectionReader(pack.file, offset, 1<<62))
+	first, err := reader.ReadByte()
+	if err != nil {
+		return "", nil, err
+	}
+	kind := (first >> 4) & 7
+	for current := first; current&0x80 != 0; {
+		if current, err = reader.ReadByte(); err != nil {
+			return "", nil, err
+		}
+	}
+	switch kind {
+	case 6:
+		back, err := readOffsetVarint(reader)
+		if err != nil {
+			return "", nil, err
+		}
+		delta, err := inflate(reader)
+		if err != nil {
+			return "", nil, err
+		}
+		baseKind, base, err := pack.object(repo, offset-back, depth+1)
+		if err != nil {
+			return "", nil, err
+		}
+		data, err := applyDelta(base, delta)
+		return baseKind, data, err
+	case 7:
+		ref := make([]byte, repo.hashSize)
+		if _, err := io.ReadFull(reader, ref); err != nil {
+			return "", nil, err
+		}
+		delta, err := inflate(reader)
+		if err != nil {
+			return "", nil, err
+		}
+		baseKind, base, err := repo.object(hex.EncodeToString(ref))
+		if err != nil {
+			return "", nil, err
+		}
+		data, err := applyDelta(base, delta)
+		return baseKind, data, err
+	}
+	name, ok := gitObjectTypes[kind]
+	if !ok {
+		return "", nil, fmt.Errorf("%s: unknown object type %d", pack.path, kind)
+	}
+	data, err := inflate(reader)
+	return name, data, err
+}
+
+func (pack *gitPack) close() {
+	if pack.file != nil {
+		_ = pack.file.Close()
+		pack.file = nil
+	}
+}
+
+func inflate(reader io.Reader) ([]byte, error) {
+	inflater, err := zlib.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	defer inflater.Close()
+	return io.ReadAll(inflater)
+}
+
+// readOffsetVarint reads the base distance of an offset delta, which adds one
+// before each shift unlike a plain varint.
+func readOffsetVarint(reader io.ByteReader) (int64, error) {
+	current, err := reader.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	value := int64(current & 0x7f)
+	for current&0x80 != 0 {
+		if current, err = reader.ReadByte(); err != nil {
+			return 0, err
+		}
+		value = ((value + 1) << 7) | int64(current&0x7f)
+	}
+	return value, nil
+}
+
+func applyDelta(base, delta []byte) ([]byte, error) {
+	position := 0
+	readSize := func() int {
+		size, shift := 0, 0
+		for position < len(delta) {
+			current := delta[position]
+			position++
+			size |= int(current&0x7f) << shift
+			shift += 7
+			if current&0x80 == 0 {
+				break
+			}
+		}
+		return size
+	}
+	if readSize() != len(base) {
+		return nil, fmt.Errorf("delta base size mismatch")
+	}
+	result := make([]byte, 0, readSize())
+	for position < len(delta) {
+		op := delta[position]
+		position++
+		if op&0x80 == 0 {
+			if op == 0 || position+int(op) > len(delta) {
+				return nil, fmt.Errorf("malformed delta")
+			}
+			result = append(result, delta[position:position+int(op)]...)
+			position += int(op)
+			continue
+		}
+		offset, size := 0, 0
+		for bit := 0; bit < 7; bit++ {
+			if op&(1<<bit) == 0 {
+				continue
+			}
+			if position >= len(delta) {
+				return nil, fmt.Errorf("malformed delta")
+			}
+			if bit < 4 {
+				offset |= int(delta[position]) << (8 * bit)
+			} else {
+				size |= int(delta[position]) << (8 * (bit - 4))
+			}
+			position++
+		}
+		if size == 0 {
+			size = 0x10000
+		}
+		if offset+size > len(base) {
+			return nil, fmt.Errorf("malformed delta")
+		}
+		result = append(result, base[offset:offset+size]...)
+	}
+	return result, nil
+}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newGitHome points git and the inspection at an empty home, so the user's
+// own config does not leak into the fixtures.
+func newGitHome(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	return home
+}
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+// newGitRepo creates a work tree on main with commits commits, each touching
+// a long shared file so that packing stores most of them as deltas.
+func newGitRepo(t *testing.T, commits int) string {
+	t.Helper()
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q", "-b", "main")
+	writeText(t, filepath.Join(dir, "dir", "sub", "alpha.txt"), "alpha\n")
+	writeText(t, filepath.Join(dir, "dir", "sub", "beta.txt"), "beta\n")
+	body := strings.Repeat("the same paragraph in every revision of the file\n", 80)
+	for index := 0; index < commits; index++ {
+		writeText(t, filepath.Join(dir, "notes.txt"), body+strings.Repeat("x", index)+"\n")
+		runGit(t, dir, "add", "-A")
+		message := "change notes\n\n" + body + strings.Repeat("y", index)
+		runGit(t, dir, "commit", "-q", "-m", message)
+	}
+	return dir
+}
+
+func writeText(t *testing.T, path, text string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// porcelain counts the files git itself reports as changed in the work tree
+// and as untracked, without refreshing the index.
+func porcelain(t *testing.T, dir string) (modified, untracked int) {
+	t.Helper()
+	out := runGit(t, dir, "--no-optional-locks", "status", "--porcelain", "--untracked-files=all")
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case len(line) < 2:
+		case line[:2] == "??":
+			untracked++
+		case line[1] != ' ':
+			modified++
+		}
+	}
+	return modified, untracked
+}
+
+func inspect(t *testing.T, dir string) GitStatus {
+	t.Helper()
+	status, err := InspectGitRepo(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+// trackUpstream makes origin/main the upstream of main at behind commits
+// below HEAD.
+func trackUpstream(t *testing.T, dir string, behind int) {
+	t.Helper()
+	runGit(t, dir, "update-ref", "refs/remotes/origin/main", "HEAD~"+strconv.Itoa(behind))
+	runGit(t, dir, "config", "branch.main.remote", "origin")
+	runGit(t, dir, "config", "branch.main.merge", "refs/heads/main")
+}
+
+func TestGitUnpushedCommits(t *testing.T) {
+	tests := []struct {
+		name   string
+		pack   []string
+		deltas string
+	}{
+		{name: "loose objects"},
+		{name: "ofs deltas", pack: []string{"repack", "-adf", "--depth=10"}, deltas: "ofs"},
+		{name: "ref deltas", pack: []string{"-c", "repack.useDeltaBaseOffset=false", "repack", "-adf", "--depth=10"}, deltas: "ref"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newGitHome(t)
+			dir := newGitRepo(t, 6)
+			trackUpstream(t, dir, 4)
+			if test.pack != nil {
+				runGit(t, dir, test.pack...)
+				runGit(t, dir, "prune-packed")
+				loose := runGit(t, dir, "count-objects")
+				if !strings.HasPrefix(loose, "0 objects") {
+					t.Fatalf("objects left loose: %s", loose)
+				}
+				if !packHasCommitDeltas(t, dir) {
+					t.Fatal("the pack stores no commit as a delta")
+				}
+			}
+			status := inspect(t, dir)
+			want := "main has 4 commits not on origin/main"
+			if len(status.Unpushed) != 1 || status.Unpushed[0] != want {
+				t.Errorf("unpushed %q, want %q", status.Unpushed, want)
+			}
+			if status.Branch != "main" {
+				t.Errorf("branch %q, want main", status.Branch)
+			}
+		})
+	}
+}
+
+// packHasCommitDeltas reports whether verify-pack lists a commit with a
+// delta base.
+func packHasCommitDeltas(t *testing.T, dir string) bool {
+	t.Helper()
+	packs, err := filepath.Glob(filepath.Join(dir, ".git", "objects", "pack", "*.idx"))
+	if err != nil || len(packs) == 0 {
+		t.Fatalf("no pack index: %v", err)
+	}
+	out := runGit(t, dir, "verify-pack", "-v", packs[0])
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 7 && fields[1] == "commit" {
+			return true
+		}
+	}
+	return false
+}
+
+func TestGitIndexVersions(t *testing.T) {
+	for _, version := range []string{"2", "3", "4"} {
+		t.Run("v"+version, func(t *testing.T) {
+			newGitHome(t)
+			dir := newGitRepo(t, 1)
+			if version == "3" {
+				runGit(t, dir, "update-index", "--skip-worktree", "dir/sub/beta.txt")
+			} else {
+				runGit(t, dir, "update-index", "--index-version", version)
+			}
+			index, err := os.ReadFile(filepath.Join(dir, ".git", "index"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := index[7]; got != version[0]-'0' {
+				t.Fatalf("index version %d, want %s", got, version)
+			}
+
+			// Same size, new content and mtime: only a content check finds it.
+			writeText(t, filepath.Join(dir, "dir", "sub", "alpha.txt"), "ALPHA\n")
+			later := time.Now().Add(time.Hour)
+			if err := os.Chtimes(filepath.Join(dir, "dir", "sub", "alpha.txt"), later, later); err != nil {
+				t.Fatal(err)
+			}
+			writeText(t, filepath.Join(dir, "dir", "sub", "beta.txt"), "changed\n")
+			writeText(t, filepath.Join(dir, "dir", "sub", "gamma.txt"), "new\n")
+
+			status := inspect(t, dir)
+			modified, untracked := porcelain(t, dir)
+			if status.Modified != modified || status.Untracked != untracked {
+				t.Errorf("read %d modified, %d untracked; git reports %d, %d", status.Modified, status.Untracked, modified, untracked)
+			}
+		})
+	}
+}
+
+func TestGitLinkedWorkTree(t *testing.T) {
+	newGitHome(t)
+	dir := newGitRepo(t, 3)
+	trackUpstream(t, dir, 1)
+	linked := filepath.Join(t.TempDir(), "feature")
+	runGit(t, dir, "worktree", "add", "-q", "-b", "feature", linked)
+	runGit(t, dir, "repack", "-adq")
+	runGit(t, dir, "prune-packed")
+	if info, err := os.Lstat(filepath.Join(linked, ".git")); err != nil || info.IsDir() {
+		t.Fatalf("linked work tree has no .git file: %v", err)
+	}
+	writeText(t, filepath.Join(linked, "notes.txt"), "rewritten\n")
+	writeText(t, filepath.Join(linked, "todo.txt"), "new\n")
+
+	status := inspect(t, linked)
+	if status.Branch != "feature" {
+		t.Errorf("branch %q, want feature", status.Branch)
+	}
+	modified, untracked := porcelain(t, linked)
+	if status.Modified != modified || status.Untracked != untracked {
+		t.Errorf("read %d modified, %d untracked; git reports %d, %d", status.Modified, status.Untracked, modified, untracked)
+	}
+	want := []string{"feature has 1 commits not on any remote", "main has 1 commits not on origin/main"}
+	if strings.Join(status.Unpushed, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unpushed %q, want %q", status.Unpushed, want)
+	}
+}
+
+func TestGitGlobalExcludes(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, home string)
+	}{
+		{
+			name: "default ignore file",
+			setup: func(t *testing.T, home string) {
+				writeText(t, filepath.Join(home, ".config", "git", "ignore"), "*.log\n")
+			},
+		},
+		{
+			name: "core.excludesFile in ~/.gitconfig",
+			setup: func(t *testing.T, home string) {
+				writeText(t, filepath.Join(home, ".gitconfig"), "[core]\n\texcludesFile = ~/ignores\n")
+				writeText(t, filepath.Join(home, "ignores"), "*.log\n")
+				writeText(t, filepath.Join(home, ".config", "git", "ignore"), "*.txt\n")
+			},
+		},
+		{
+			name: "core.excludesFile in the XDG config",
+			setup: func(t *testing.T, home string) {
+				writeText(t, filepath.Join(home, ".config", "git", "config"), "[core]\n\texcludesfile = "+filepath.Join(home, "ignores")+"\n")
+				writeText(t, filepath.Join(home, "ignores"), "*.log\n")
+			},
+		},
+		{
+			name: "info/exclude takes precedence",
+			setup: func(t *testing.T, home string) {
+				writeText(t, filepath.Join(home, ".config", "git", "ignore"), "*.log\n*.tmp\n")
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			home := newGitHome(t)
+			dir := newGitRepo(t, 1)
+			test.setup(t, home)
+			writeText(t, filepath.Join(dir, ".git", "info", "exclude"), "!keep.tmp\n")
+			writeText(t, filepath.Join(dir, "build.log"), "log\n")
+			writeText(t, filepath.Join(dir, "dir", "trace.log"), "log\n")
+			writeText(t, filepath.Join(dir, "keep.tmp"), "tmp\n")
+			writeText(t, filepath.Join(dir, "todo.txt"), "new\n")
+
+			status := inspect(t, dir)
+			_, untracked := porcelain(t, dir)
+			if status.Untracked != untracked {
+				t.Errorf("read %d untracked (%q); git reports %d", status.Untracked, status.Samples, untracked)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// The hash cache is one file next to the scan caches. Entries are keyed by
+// path and only trusted while the file's mtime and size are unchanged. The
+// layout follows the scan cache: magic, version, varint fields, CRC32.
+const (
+	hashCacheMagic   = "SWFH"
+	hashCacheVersion = 1
+	hashCacheName    = "hashes.bin"
+)
+
+type hashEntry struct {
+	ModTime int64
+	Size    int64
+	Partial string
+	Full    string
+}
+
+type hashCache struct {
+	mu      sync.Mutex
+	path    string
+	loaded  bool
+	entries map[string]hashEntry
+	seen    map[string]bool
+}
+
+func newHashCache(path string) *hashCache {
+	return &hashCache{path: path, entries: make(map[string]hashEntry), seen: make(map[string]bool)}
+}
+
+func (cache *hashCache) load() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.loaded || cache.path == "" {
+		cache.loaded = true
+		return
+	}
+	cache.loaded = true
+	data, err := os.ReadFile(cache.path)
+	if err != nil {
+		return
+	}
+	entries, err := decodeHashCache(data)
+	if err != nil {
+		_ = os.Remove(cache.path)
+		return
+	}
+	cache.entries = entries
+}
+
+// lookup returns the cached entry for path if it still matches the file.
+func (cache *hashCache) lookup(path string, modTime, size int64) hashEntry {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.seen[path] = true
+	entry, ok := cache.entries[path]
+	if !ok || entry.ModTime != modTime || entry.Size != size {
+		return hashEntry{ModTime: modTime, Size: size}
+	}
+	return entry
+}
+
+func (cache *hashCache) store(path string, entry hashEntry) {
+	cache.mu.Lock()
+	cache.entries[path] = entry
+	cache.mu.Unlock()
+}
+
+// save writes the cache, dropping entries below root that this run did not
+// look at since those files are gone or no longer duplicate candidates.
+func (cache *hashCache) save(root string) error {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	for path := range cache.entries {
+		if isWithin(root, path) && !cache.seen[path] {
+			delete(cache.entries, path)
+		}
+	}
+	cache.seen = make(map[string]bool)
+	if cache.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(cache.path), 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(cache.path, encodeHashCache(cache.entries))
+}
+
+func encodeHashCache(entries map[string]hashEntry) []byte {
+	paths := make([]string, 0, len(entries))
+	for path := range entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	out := make([]byte, 0, 16+len(paths)*96)
+	out = append(out, hashCacheMagic...)
+	out = binary.AppendUvarint(out, hashCacheVersion)
+	out = binary.AppendUvarint(out, uint64(len(paths)))
+	for _, path := range paths {
+		entry := entries[path]
+		out = appendString(out, path)
+		out = binary.AppendVarint(out, entry.ModTime)
+		out = binary.AppendVarint(out, entry.Size)
+		out = appendString(out, entry.Partial)
+		out = appendString(out, entry.Full)
+	}
+	return binary.LittleEndian.AppendUint32(out, crc32.ChecksumIEEE(out))
+}
+
+func decodeHashCache(data []byte) (map[string]hashEntry, error) {
+	if len(data) < len(hashCacheMagic)+4 || string(data[:len(hashCacheMagic)]) != hashCacheMagic {
+		return nil, errCacheCorrupt
+	}
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(data[len(data)-4:]) {
+		return nil, errCacheCorrupt
+	}
+	reader := &cacheReader{data: body, offset: len(hashCacheMagic)}
+	if version := reader.uvarint(); version != hashCacheVersion {
+		return nil, errCacheVersion
+	}
+	count := reader.count()
+	entries := make(map[string]hashEntry, count)
+	for index := 0; index < count && reader.err == nil; index++ {
+		path := reader.string()
+		entries[path] = hashEntry{
+			ModTime: reader.varint(),
+			Size:    reader.varint(),
+			Partial: reader.string(),
+			Full:    reader.string(),
+		}
+	}
+	if reader.err != nil || reader.offset != len(body) {
+		return nil, errCacheCorrupt
+	}
+	return entries, nil
+}
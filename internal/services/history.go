@@ -0,0 +1,178 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"sweepfs/internal/domain"
+)
+
+const (
+	maxSnapshots    = 30
+	maxHistoryBytes = 512 << 20
+)
+
+type SnapshotInfo struct {
+	Root    string
+	Created time.Time
+	Path    string
+}
+
+type HistoryProvider interface {
+	Snapshots(req ScanRequest) ([]SnapshotInfo, error)
+	LoadSnapshot(info SnapshotInfo) (domain.TreeIndex, error)
+}
+
+func historyDirPath() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "sweepfs", "history"), nil
+}
+
+// saveSnapshot stores an encoded scan under the root and option key, named
+// by its creation time, and keeps the newest maxSnapshots per key. The oldest
+// snapshots of any key go first once the history outgrows maxHistoryBytes.
+func (scanner *FSScanner) saveSnapshot(root string, req ScanRequest, created time.Time, data []byte) {
+	if scanner.historyDir == "" {
+		return
+	}
+	dir := filepath.Join(scanner.historyDir, cacheKey(root, req))
+	name := strconv.FormatInt(created.UnixNano(), 10) + ".bin"
+	if err := writeFileAtomic(filepath.Join(dir, name), data); err != nil {
+		return
+	}
+	snapshots, err := listSnapshots(dir, root)
+	if err != nil {
+		return
+	}
+	for index := maxSnapshots; index < len(snapshots); index++ {
+		_ = os.Remove(snapshots[index].Path)
+	}
+	evictHistory(scanner.historyDir, maxHistoryBytes)
+}
+
+// snapshotLoaded saves the loaded tree after a scan that did not write a
+// cache file: one served from the cache or one merged into the loaded tree.
+func (scanner *FSScanner) snapshotLoaded(req ScanRequest) {
+	if scanner.historyDir == "" {
+		return
+	}
+	scanner.mu.RLock()
+	root := scanner.root
+	entries := make(map[string]cacheEntry, len(scanner.cache))
+	for path, node := range scanner.cache {
+		if isWithin(root, path) {
+			entries[path] = newCacheEntry(node)
+		}
+	}
+	scanner.mu.RUnlock()
+	if root == "" {
+		return
+	}
+	req.RootPath = root
+	header := newCacheHeader(root, req)
+	scanner.saveSnapshot(root, req, header.Created, encodeCache(header, entries))
+}
+
+// evictHistory removes the oldest snapshots across every key until the
+// history fits in maxBytes, and drops key folders left empty.
+func evictHistory(dir string, maxBytes int64) {
+	keys, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	type snapshotFile struct {
+		path    string
+		size    int64
+		created time.Time
+	}
+	files := []snapshotFile{}
+	for _, key := range keys {
+		if !key.IsDir() {
+			continue
+		}
+		keyDir := filepath.Join(dir, key.Name())
+		snapshots, err := listSnapshots(keyDir, "")
+		if err != nil {
+			continue
+		}
+		for _, snapshot := range snapshots {
+			if info, err := os.Stat(snapshot.Path); err == nil {
+				files = append(files, snapshotFile{path: snapshot.Path, size: info.Size(), created: snapshot.Created})
+			}
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].created.After(files[j].created)
+	})
+	var total int64
+	for _, file := range files {
+		total += file.size
+		if total <= maxBytes {
+			continue
+		}
+		_ = os.Remove(file.path)
+		_ = os.Remove(filepath.Dir(file.path))
+	}
+}
+
+// Snapshots lists the saved scans of req.RootPath with the same options,
+// newest first.
+func (scanner *FSScanner) Snapshots(req ScanRequest) ([]SnapshotInfo, error) {
+	if scanner.historyDir == "" {
+		return nil, nil
+	}
+	root := cleanPath(req.RootPath)
+	req.SizeMode = normalizeSizeMode(req.SizeMode)
+	snapshots, err := listSnapshots(filepath.Join(scanner.historyDir, cacheKey(root, req)), root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return snapshots, err
+}
+
+func (scanner *FSScanner) LoadSnapshot(info SnapshotInfo) (domain.TreeIndex, error) {
+	header, entries, err := readCacheFile(info.Path)
+	if err != nil {
+		return domain.TreeIndex{}, err
+	}
+	mode := normalizeSizeMode(header.SizeMode)
+	nodes := make(map[string]*domain.Node, len(entries))
+	for path, entry := range entries {
+		nodes[path] = entry.toNode(mode)
+	}
+	return domain.TreeIndex{Nodes: nodes, RootID: header.Root}, nil
+}
+
+func listSnapshots(dir, root string) ([]SnapshotInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make([]SnapshotInfo, 0, len(entries))
+	for _, entry := range entries {
+		stamp, ok := strings.CutSuffix(entry.Name(), ".bin")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		nanos, err := strconv.ParseInt(stamp, 10, 64)
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, SnapshotInfo{
+			Root:    root,
+			Created: time.Unix(0, nanos),
+			Path:    filepath.Join(dir, entry.Name()),
+		})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Created.After(snapshots[j].Created)
+	})
+	return snapshots, nil
+}
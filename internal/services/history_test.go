@@ -0,0 +1,79 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEveryCompletedScanIsSnapshotted(t *testing.T) {
+	cacheDir := t.TempDir()
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a", "f"), 100)
+	req := ScanRequest{RootPath: root, MaxDepth: 1}
+	count := func() int {
+		t.Helper()
+		snapshots, err := newTestScanner(t, cacheDir).Snapshots(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(snapshots)
+	}
+
+	scanTotal(t, newTestScanner(t, cacheDir), req)
+	if got := count(); got != 1 {
+		t.Fatalf("after a walk: %d snapshots, want 1", got)
+	}
+	scanner := newTestScanner(t, cacheDir)
+	scanTotal(t, scanner, req)
+	if got := count(); got != 2 {
+		t.Fatalf("after a scan from the cache: %d snapshots, want 2", got)
+	}
+	deeper := req
+	deeper.RootPath = filepath.Join(root, "a")
+	scanTotal(t, scanner, deeper)
+	snapshots, err := scanner.Snapshots(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 3 {
+		t.Fatalf("after a merged scan: %d snapshots, want 3", len(snapshots))
+	}
+	tree, err := scanner.LoadSnapshot(snapshots[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.RootID != root || tree.Nodes[root].AccumBytes != 100 {
+		t.Errorf("merged snapshot: root %q with %d bytes, want %q with 100", tree.RootID, tree.Nodes[root].AccumBytes, root)
+	}
+}
+
+func TestEvictHistoryDropsOldestAcrossKeys(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Now()
+	write := func(key string, age int) string {
+		t.Helper()
+		name := strconv.FormatInt(base.Add(-time.Duration(age)*time.Hour).UnixNano(), 10) + ".bin"
+		path := filepath.Join(dir, key, name)
+		writeFile(t, path, 100)
+		return path
+	}
+	newest := write("one", 0)
+	newer := write("two", 1)
+	older := write("one", 2)
+	oldest := write("two", 3)
+
+	evictHistory(dir, 250)
+	for _, path := range []string{newest, newer} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s was evicted: %v", path, err)
+		}
+	}
+	for _, path := range []string{older, oldest} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was kept", path)
+		}
+	}
+}
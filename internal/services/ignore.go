@@ -0,0 +1,231 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const ignoreFileName = ".sweepfsignore"
+
+type ignoreRule struct {
+	pattern  string
+	source   string
+	base     string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+	parts    []string
+}
+
+type ignoreSet struct {
+	rules []ignoreRule
+}
+
+// ignoreTree combines the configured rules with the .sweepfsignore files found
+// while walking. Rules from deeper directories are evaluated last, so they win.
+type ignoreTree struct {
+	mu       sync.RWMutex
+	root     string
+	fileName string
+	global   *ignoreSet
+	dirs     map[string]*ignoreSet
+}
+
+// parseIgnoreRule parses one gitignore-style line. Patterns without a slash
+// match a name at any depth; patterns with a slash are relative to base.
+func parseIgnoreRule(line, base, source string) (ignoreRule, bool) {
+	text := strings.TrimSpace(line)
+	if text == "" || strings.HasPrefix(text, "#") {
+		return ignoreRule{}, false
+	}
+	rule := ignoreRule{pattern: text, source: source, base: base}
+	if strings.HasPrefix(text, "!") {
+		rule.negate = true
+		text = text[1:]
+	}
+	text = strings.TrimPrefix(text, "\\")
+	if strings.HasSuffix(text, "/") {
+		rule.dirOnly = true
+		text = strings.TrimRight(text, "/")
+	}
+	if strings.Contains(text, "/") {
+		rule.anchored = true
+		text = strings.TrimPrefix(text, "/")
+	}
+	if text == "" {
+		return ignoreRule{}, false
+	}
+	rule.parts = strings.Split(text, "/")
+	return rule, true
+}
+
+func newIgnoreSet(patterns []string, base, source string) *ignoreSet {
+	set := &ignoreSet{}
+	for _, pattern := range patterns {
+		set.add(pattern, base, source)
+	}
+	return set
+}
+
+func (set *ignoreSet) add(line, base, source string) {
+	if rule, ok := parseIgnoreRule(line, base, source); ok {
+		set.rules = append(set.rules, rule)
+	}
+}
+
+func (set *ignoreSet) empty() bool {
+	return set == nil || len(set.rules) == 0
+}
+
+// match reports the last rule that matches target. The returned bool is
+// false when no rule matched or the last match was a negation.
+func (set *ignoreSet) match(target string, isDir bool) (ignoreRule, bool) {
+	if set.empty() {
+		return ignoreRule{}, false
+	}
+	matched, hit := set.lastMatch(target, isDir)
+	return matched, hit && !matched.negate
+}
+
+func (rule ignoreRule) matches(target string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	rel, err := filepath.Rel(rule.base, target)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	segments := strings.Split(filepath.ToSlash(rel), "/")
+	if !rule.anchored {
+		if len(rule.parts) != 1 {
+			return false
+		}
+		ok, _ := path.Match(rule.parts[0], segments[len(segments)-1])
+		return ok
+	}
+	return matchSegments(rule.parts, segments)
+}
+
+func (rule ignoreRule) String() string {
+	if rule.source == "" {
+		return rule.pattern
+	}
+	return fmt.Sprintf("%s: %s", rule.source, rule.pattern)
+}
+
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for skip := 0; skip <= len(segments); skip++ {
+			if matchSegments(pattern[1:], segments[skip:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	ok, err := path.Match(pattern[0], segments[0])
+	if err != nil || !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
+
+func newIgnoreTree(root string, patterns []string) *ignoreTree {
+	return &ignoreTree{
+		root:     root,
+		fileName: ignoreFileName,
+		global:   newIgnoreSet(patterns, root, "config"),
+		dirs:     make(map[string]*ignoreSet),
+	}
+}
+
+// load reads the ignore file in dir, if any, and applies it to the subtree
+// below dir. It returns the file's info, or nil when dir has none.
+func (tree *ignoreTree) load(dir string) (os.FileInfo, error) {
+	filePath := filepath.Join(dir, tree.fileName)
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	set := &ignoreSet{}
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		set.add(lines.Text(), dir, filePath)
+	}
+	if err := lines.Err(); err != nil {
+		return nil, err
+	}
+	if set.empty() {
+		return info, nil
+	}
+	tree.mu.Lock()
+	tree.dirs[dir] = set
+	tree.mu.Unlock()
+	return info, nil
+}
+
+func (tree *ignoreTree) match(target string, isDir bool) (ignoreRule, bool) {
+	matched, excluded := tree.global.match(target, isDir)
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	if len(tree.dirs) == 0 {
+		return matched, excluded
+	}
+	for _, dir := range ancestorsBelow(tree.root, target) {
+		set, ok := tree.dirs[dir]
+		if !ok {
+			continue
+		}
+		if rule, hit := set.lastMatch(target, isDir); hit {
+			matched = rule
+			excluded = !rule.negate
+		}
+	}
+	return matched, excluded
+}
+
+func (set *ignoreSet) lastMatch(target string, isDir bool) (ignoreRule, bool) {
+	var matched ignoreRule
+	hit := false
+	for _, rule := range set.rules {
+		if rule.matches(target, isDir) {
+			matched = rule
+			hit = true
+		}
+	}
+	return matched, hit
+}
+
+// ancestorsBelow lists the directories from root down to the parent of target.
+func ancestorsBelow(root, target string) []string {
+	dirs := []string{}
+	for dir := filepath.Dir(target); isWithin(root, dir); dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == root || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	for left, right := 0, len(dirs)-1; left < right; left, right = left+1, right-1 {
+		dirs[left], dirs[right] = dirs[right], dirs[left]
+	}
+	return dirs
+}
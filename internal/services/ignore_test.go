@@ -0,0 +1,119 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreSetMatch(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "scan")
+	tests := []struct {
+		patterns []string
+		target   string
+		isDir    bool
+		want     bool
+	}{
+		{[]string{"node_modules"}, "node_modules", true, true},
+		{[]string{"node_modules"}, "web/app/node_modules", true, true},
+		{[]string{"node_modules"}, "node_modules_old", true, false},
+		{[]string{"*.log"}, "var/build.log", false, true},
+		{[]string{"*.log"}, "var/build.log.gz", false, false},
+		{[]string{"cache/"}, "cache", true, true},
+		{[]string{"cache/"}, "cache", false, false},
+		{[]string{"/build"}, "build", true, true},
+		{[]string{"/build"}, "src/build", true, false},
+		{[]string{"src/*.tmp"}, "src/a.tmp", false, true},
+		{[]string{"src/*.tmp"}, "src/deep/a.tmp", false, false},
+		{[]string{"a/**/z"}, "a/z", true, true},
+		{[]string{"a/**/z"}, "a/b/c/z", true, true},
+		{[]string{"a/**/z"}, "b/a/z", true, false},
+		{[]string{"**/z"}, "b/c/z", false, true},
+		{[]string{"file-?.txt"}, "file-1.txt", false, true},
+		{[]string{"[ab]*"}, "beta", false, true},
+		{[]string{"*.log", "!keep.log"}, "keep.log", false, false},
+		{[]string{"!keep.log", "*.log"}, "keep.log", false, true},
+		{[]string{`\!bang`}, "!bang", false, true},
+		{[]string{`\#hash`}, "#hash", false, true},
+		{[]string{"#hash"}, "#hash", false, false},
+		{[]string{"  spaced  "}, "spaced", false, true},
+		{[]string{"*"}, ".", true, false},
+	}
+	for _, test := range tests {
+		set := newIgnoreSet(test.patterns, root, "config")
+		target := filepath.Join(root, filepath.FromSlash(test.target))
+		if _, got := set.match(target, test.isDir); got != test.want {
+			t.Errorf("%q against %s (dir %v): %v, want %v", test.patterns, test.target, test.isDir, got, test.want)
+		}
+	}
+}
+
+func TestIgnoreSetSkipsMalformedPatterns(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "scan")
+	set := newIgnoreSet([]string{"", "   ", "# comment", "!", "/", "//", "[", "a/[", "[z-a]"}, root, "config")
+	if got := len(set.rules); got != 3 {
+		t.Errorf("kept %d rules, want the 3 with a bad glob", got)
+	}
+	for _, target := range []string{"[", "a/[", "a", "z"} {
+		if _, ignored := set.match(filepath.Join(root, target), false); ignored {
+			t.Errorf("%s matched a malformed pattern", target)
+		}
+	}
+	if _, ignored := set.match(filepath.Join(string(filepath.Separator), "elsewhere"), true); ignored {
+		t.Error("a path outside the base matched")
+	}
+}
+
+func TestIgnoreTreeDeeperFilesWin(t *testing.T) {
+	root := t.TempDir()
+	writeText(t, filepath.Join(root, ignoreFileName), "*.bin\n# keep notes\nnotes/\n")
+	writeText(t, filepath.Join(root, "a", ignoreFileName), "!*.bin\n/local\n")
+	writeText(t, filepath.Join(root, "a", "b", ignoreFileName), "*.bin\n")
+	tree := newIgnoreTree(root, []string{"*.tmp", "!keep.tmp"})
+	for _, dir := range []string{root, filepath.Join(root, "a"), filepath.Join(root, "a", "b"), filepath.Join(root, "missing")} {
+		if _, err := tree.load(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		target string
+		isDir  bool
+		want   bool
+		rule   string
+	}{
+		{"x.bin", false, true, filepath.Join(root, ignoreFileName) + ": *.bin"},
+		{"a/x.bin", false, false, ""},
+		{"a/b/x.bin", false, true, filepath.Join(root, "a", "b", ignoreFileName) + ": *.bin"},
+		{"a/local", true, true, ""},
+		{"local", true, false, ""},
+		{"a/b/local", true, false, ""},
+		{"a/notes", true, true, ""},
+		{"a/b/x.tmp", false, true, "config: *.tmp"},
+		{"a/keep.tmp", false, false, ""},
+	}
+	for _, test := range tests {
+		rule, got := tree.match(filepath.Join(root, filepath.FromSlash(test.target)), test.isDir)
+		if got != test.want {
+			t.Errorf("%s: ignored %v, want %v", test.target, got, test.want)
+		}
+		if test.rule != "" && rule.String() != test.rule {
+			t.Errorf("%s: matched %q, want %q", test.target, rule.String(), test.rule)
+		}
+	}
+}
+
+func TestAncestorsBelow(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "scan")
+	got := ancestorsBelow(root, filepath.Join(root, "a", "b", "file"))
+	want := []string{root, filepath.Join(root, "a"), filepath.Join(root, "a", "b")}
+	if len(got) != len(want) {
+		t.Fatalf("%q, want %q", got, want)
+	}
+	for index := range want {
+		if got[index] != want[index] {
+			t.Fatalf("%q, want %q", got, want)
+		}
+	}
+	if got := ancestorsBelow(root, filepath.Join(string(filepath.Separator), "other", "file")); len(got) != 0 {
+		t.Errorf("outside the root: %q, want none", got)
+	}
+}
@@ -0,0 +1,485 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"sweepfs/internal/domain"
+)
+
+// The ncdu export format is documented at https://dev.yorhel.nl/ncdu/jsonfmt.
+// A directory is an array holding its own info object followed by its
+// children; files are plain objects.
+const (
+	ncduMajor       = 1
+	ncduMinor       = 2
+	ncduProgVersion = "0.1.0"
+)
+
+var errNcduFormat = errors.New("not an ncdu export")
+
+// ncduEntry holds the ncdu fields SweepFS reads and writes. The sweepfs_
+// counts are an extension other readers ignore.
+type ncduEntry struct {
+	Name      string `json:"name"`
+	Asize     int64  `json:"asize,omitempty"`
+	Dsize     int64  `json:"dsize,omitempty"`
+	Dev       uint64 `json:"dev,omitempty"`
+	Ino       uint64 `json:"ino,omitempty"`
+	Hlnkc     bool   `json:"hlnkc,omitempty"`
+	Nlink     int    `json:"nlink,omitempty"`
+	Excluded  string `json:"excluded,omitempty"`
+	ReadError bool   `json:"read_error,omitempty"`
+	UID       uint32 `json:"uid,omitempty"`
+	GID       uint32 `json:"gid,omitempty"`
+	Mode      uint32 `json:"mode,omitempty"`
+	Mtime     int64  `json:"mtime,omitempty"`
+	Files     int    `json:"sweepfs_files,omitempty"`
+	Dirs      int    `json:"sweepfs_dirs,omitempty"`
+}
+
+// ExportNcdu writes tree in the ncdu JSON dump format. Sizes go to asize or
+// dsize depending on the size mode the tree was scanned with.
+func ExportNcdu(w io.Writer, tree domain.TreeIndex) error {
+	root, ok := tree.Nodes[tree.RootID]
+	if !ok {
+		return fmt.Errorf("nothing to export")
+	}
+	out := bufio.NewWriter(w)
+	meta, err := json.Marshal(map[string]interface{}{
+		"progname":  "sweepfs",
+		"progver":   ncduProgVersion,
+		"timestamp": time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "[%d,%d,%s,\n", ncduMajor, ncduMinor, meta)
+	if err := writeNcduDir(out, tree, root, 0, true); err != nil {
+		return err
+	}
+	out.WriteString("]\n")
+	return out.Flush()
+}
+
+func writeNcduDir(out *bufio.Writer, tree domain.TreeIndex, node *domain.Node, parentDev uint64, isRoot bool) error {
+	out.WriteString("[")
+	if err := writeNcduEntry(out, node, parentDev, isRoot); err != nil {
+		return err
+	}
+	children := make([]*domain.Node, 0, len(node.ChildrenIDs))
+	for _, id := range node.ChildrenIDs {
+		if child, ok := tree.Nodes[id]; ok {
+			children = append(children, child)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Name < children[j].Name
+	})
+	for _, child := range children {
+		out.WriteString(",\n")
+		if child.Type == domain.NodeDir && child.Skipped == domain.SkipNone {
+			if err := writeNcduDir(out, tree, child, node.Device, false); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := writeNcduEntry(out, child, node.Device, false); err != nil {
+			return err
+		}
+	}
+	out.WriteString("]")
+	return nil
+}
+
+func writeNcduEntry(out *bufio.Writer, node *domain.Node, parentDev uint64, isRoot bool) error {
+	entry := ncduEntry{
+		Name:  node.Name,
+		Ino:   node.Inode,
+		UID:   node.UID,
+		GID:   node.GID,
+		Mtime: unixSeconds(node.ModTime),
+	}
+	if node.Mode != 0 {
+		entry.Mode = uint32(node.Mode.Perm()) | 0o100000
+		switch node.Type {
+		case domain.NodeDir:
+			entry.Mode = uint32(node.Mode.Perm()) | 0o040000
+		case domain.NodeSymlink:
+			entry.Mode = uint32(node.Mode.Perm()) | 0o120000
+		}
+	}
+	if isRoot {
+		entry.Name = node.Path
+	}
+	if isRoot || node.Device != parentDev {
+		entry.Dev = node.Device
+	}
+	if node.SizeMode == domain.SizeDisk {
+		entry.Dsize = node.SizeBytes
+	} else {
+		entry.Asize = node.SizeBytes
+	}
+	if node.Type == domain.NodeFile && node.Shared {
+		entry.Hlnkc = true
+		entry.Nlink = node.Links
+	}
+	if node.Type == domain.NodeDir && node.Scanned {
+		entry.Files = node.FileCount
+		entry.Dirs = node.DirCount
+	}
+	entry.ReadError = node.ReadError != ""
+	switch node.Skipped {
+	case domain.SkipExcluded:
+		entry.Excluded = "pattern"
+	case domain.SkipMount:
+		entry.Excluded = "otherfs"
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// ReadNcdu loads an ncdu JSON dump. mode selects whether file sizes come from
+// asize or dsize; the other field is used when the preferred one is missing.
+func ReadNcdu(r io.Reader, mode domain.SizeMode) (domain.TreeIndex, error) {
+	mode = normalizeSizeMode(mode)
+	reader := &ncduReader{
+		decoder: json.NewDecoder(bufio.NewReaderSize(r, 256*1024)),
+		mode:    mode,
+		nodes:   make(map[string]*domain.Node),
+	}
+	reader.decoder.UseNumber()
+	if err := reader.expectDelim('['); err != nil {
+		return domain.TreeIndex{}, err
+	}
+	var major, minor int
+	var meta json.RawMessage
+	if err := reader.decoder.Decode(&major); err != nil || major != ncduMajor {
+		return domain.TreeIndex{}, errNcduFormat
+	}
+	if err := reader.decoder.Decode(&minor); err != nil {
+		return domain.TreeIndex{}, errNcduFormat
+	}
+	if err := reader.decoder.Decode(&meta); err != nil {
+		return domain.TreeIndex{}, errNcduFormat
+	}
+	if err := reader.expectDelim('['); err != nil {
+		return domain.TreeIndex{}, err
+	}
+	root, err := reader.readDir("", 0)
+	if err != nil {
+		return domain.TreeIndex{}, err
+	}
+	nodes := reader.nodes
+	applyHierarchy(nodes)
+	applyHardlinks(nodes)
+	applyAccumulation(nodes)
+	applyFileCounts(nodes)
+	applyDirCounts(nodes)
+	applyUsage(nodes)
+	applyAges(nodes, time.Now())
+	applyIncomplete(nodes)
+	return domain.TreeIndex{Nodes: nodes, RootID: root}, nil
+}
+
+type ncduReader struct {
+	decoder *json.Decoder
+	mode    domain.SizeMode
+	nodes   map[string]*domain.Node
+}
+
+// readDir reads a directory array whose opening bracket was already consumed
+// and returns the path of the directory.
+func (reader *ncduReader) readDir(parent string, parentDev uint64) (string, error) {
+	if err := reader.expectDelim('{'); err != nil {
+		return "", err
+	}
+	entry, err := reader.readEntry()
+	if err != nil {
+		return "", err
+	}
+	node := reader.addNode(parent, parentDev, entry, domain.NodeDir)
+	node.Scanned = node.Skipped == domain.SkipNone
+	for reader.decoder.More() {
+		token, err := reader.decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		switch token {
+		case json.Delim('['):
+			if _, err := reader.readDir(node.Path, node.Device); err != nil {
+				return "", err
+			}
+		case json.Delim('{'):
+			child, err := reader.readEntry()
+			if err != nil {
+				return "", err
+			}
+			reader.addNode(node.Path, node.Device, child, ncduType(child.Mode, domain.NodeFile))
+		default:
+			return "", errNcduFormat
+		}
+	}
+	if err := reader.expectDelim(']'); err != nil {
+		return "", err
+	}
+	return node.Path, nil
+}
+
+func (reader *ncduReader) addNode(parent string, parentDev uint64, entry ncduEntry, nodeType domain.NodeType) *domain.Node {
+	path := entry.Name
+	if parent != "" {
+		path = filepath.Join(parent, entry.Name)
+	}
+	node := &domain.Node{
+		ID:       path,
+		Name:     entry.Name,
+		Path:     path,
+		Type:     nodeType,
+		SizeMode: reader.mode,
+		Device:   entry.Dev,
+		Inode:    entry.Ino,
+		UID:      entry.UID,
+		GID:      entry.GID,
+		Mode:     fs.FileMode(entry.Mode & 0o777),
+	}
+	if parent == "" {
+		node.Name = filepath.Base(path)
+	} else {
+		node.ParentID = parent
+	}
+	if node.Device == 0 {
+		node.Device = parentDev
+	}
+	if entry.Mtime > 0 {
+		node.ModTime = time.Unix(entry.Mtime, 0)
+	}
+	node.SizeBytes = entry.Asize
+	if reader.mode == domain.SizeDisk || entry.Asize == 0 {
+		node.SizeBytes = entry.Dsize
+	}
+	if reader.mode == domain.SizeDisk && entry.Dsize == 0 {
+		node.SizeBytes = entry.Asize
+	}
+	switch nodeType {
+	case domain.NodeDir:
+		node.SizeBytes = 0
+		node.Mode |= fs.ModeDir
+	case domain.NodeSymlink:
+		node.Mode |= fs.ModeSymlink
+	}
+	if nodeType != domain.NodeDir {
+		node.AccumBytes = node.SizeBytes
+		node.Links = entry.Nlink
+		node.Shared = entry.Hlnkc
+		if node.Shared && node.Links < 2 {
+			node.Links = 2
+		}
+	}
+	if entry.ReadError {
+		node.ReadError = "could not be read when the export was made"
+		node.ErrorKind = domain.ErrorOther
+	}
+	switch entry.Excluded {
+	case "":
+	case "otherfs", "othfs", "kernfs":
+		node.Skipped = domain.SkipMount
+		node.FSType = entry.Excluded
+		node.AccumBytes = 0
+	default:
+		node.Skipped = domain.SkipExcluded
+		node.ExcludedBy = "ncdu: " + entry.Excluded
+		node.AccumBytes = 0
+	}
+	reader.nodes[path] = node
+	return node
+}
+
+// readEntry reads the fields of an object whose opening brace was already
+// consumed. Unknown fields are skipped.
+func (reader *ncduReader) readEntry() (ncduEntry, error) {
+	var entry ncduEntry
+	for reader.decoder.More() {
+		token, err := reader.decoder.Token()
+		if err != nil {
+			return entry, err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return entry, errNcduFormat
+		}
+		var value interface{}
+		if err := reader.decoder.Decode(&value); err != nil {
+			return entry, err
+		}
+		switch key {
+		case "name":
+			entry.Name, _ = value.(string)
+		case "asize":
+			entry.Asize = ncduInt(value)
+		case "dsize":
+			entry.Dsize = ncduInt(value)
+		case "dev":
+			entry.Dev = uint64(ncduInt(value))
+		case "ino":
+			entry.Ino = uint64(ncduInt(value))
+		case "hlnkc":
+			entry.Hlnkc, _ = value.(bool)
+		case "nlink":
+			entry.Nlink = int(ncduInt(value))
+		case "excluded":
+			entry.Excluded, _ = value.(string)
+		case "read_error":
+			entry.ReadError, _ = value.(bool)
+		case "uid":
+			entry.UID = uint32(ncduInt(value))
+		case "gid":
+			entry.GID = uint32(ncduInt(value))
+		case "mode":
+			entry.Mode = uint32(ncduInt(value))
+		case "mtime":
+			entry.Mtime = ncduInt(value)
+		}
+	}
+	if err := reader.expectDelim('}'); err != nil {
+		return entry, err
+	}
+	if entry.Name == "" {
+		return entry, errNcduFormat
+	}
+	return entry, nil
+}
+
+// ncduType takes the type of an entry from the mode bits of an extended
+// export and falls back to the type its place in the dump implies.
+func ncduType(mode uint32, fallback domain.NodeType) domain.NodeType {
+	switch mode & 0o170000 {
+	case 0o040000:
+		return domain.NodeDir
+	case 0o120000:
+		return domain.NodeSymlink
+	case 0o100000:
+		return domain.NodeFile
+	}
+	return fallback
+}
+
+func (reader *ncduReader) expectDelim(delim json.Delim) error {
+	token, err := reader.decoder.Token()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return errNcduFormat
+		}
+		return err
+	}
+	if token != delim {
+		return errNcduFormat
+	}
+	return nil
+}
+
+func ncduInt(value interface{}) int64 {
+	number, ok := value.(json.Number)
+	if !ok {
+		return 0
+	}
+	if parsed, err := number.Int64(); err == nil {
+		return parsed
+	}
+	parsed, _ := strconv.ParseFloat(string(number), 64)
+	return int64(parsed)
+}
+
+func unixSeconds(value time.Time) int64 {
+	if value.IsZero() {
+		return 0
+	}
+	return value.Unix()
+}
+
+// ImportScanner serves a tree read from an ncdu export instead of scanning
+// the local filesystem. Scans return the imported tree, re-reading the file
+// when the size mode changes.
+type ImportScanner struct {
+	mu   sync.RWMutex
+	path string
+	mode domain.SizeMode
+	tree domain.TreeIndex
+}
+
+func NewImportScanner(path string, mode domain.SizeMode) (*ImportScanner, error) {
+	scanner := &ImportScanner{path: path}
+	if err := scanner.load(normalizeSizeMode(mode)); err != nil {
+		return nil, err
+	}
+	return scanner, nil
+}
+
+func (scanner *ImportScanner) load(mode domain.SizeMode) error {
+	file, err := os.Open(scanner.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	tree, err := ReadNcdu(file, mode)
+	if err != nil {
+		return fmt.Errorf("%s: %w", scanner.path, err)
+	}
+	scanner.mu.Lock()
+	scanner.mode = mode
+	scanner.tree = tree
+	scanner.mu.Unlock()
+	return nil
+}
+
+func (scanner *ImportScanner) Scan(ctx context.Context, req ScanRequest) (ScanResult, error) {
+	start := time.Now()
+	scanner.mu.RLock()
+	mode := scanner.mode
+	scanner.mu.RUnlock()
+	if normalizeSizeMode(req.SizeMode) != mode {
+		if err := scanner.load(normalizeSizeMode(req.SizeMode)); err != nil {
+			return ScanResult{}, err
+		}
+	}
+	scanner.mu.RLock()
+	defer scanner.mu.RUnlock()
+	scanErrors := []ScanError{}
+	for path, node := range scanner.tree.Nodes {
+		if node.ReadError != "" {
+			scanErrors = append(scanErrors, ScanError{Path: path, Kind: node.ErrorKind, Message: node.ReadError})
+		}
+	}
+	sort.Slice(scanErrors, func(i, j int) bool {
+		return scanErrors[i].Path < scanErrors[j].Path
+	})
+	return ScanResult{RootPath: scanner.tree.RootID, Duration: time.Since(start), Errors: scanErrors}, nil
+}
+
+func (scanner *ImportScanner) Snapshot() domain.TreeIndex {
+	scanner.mu.RLock()
+	defer scanner.mu.RUnlock()
+	return domain.TreeIndex{
+		Nodes:  cloneNodes(scanner.tree.Nodes),
+		RootID: scanner.tree.RootID,
+	}
+}
+
+func (scanner *ImportScanner) ImportedFrom() string {
+	return scanner.path
+}
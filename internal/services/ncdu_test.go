@@ -0,0 +1,150 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sweepfs/internal/domain"
+)
+
+// testdata/ncdu-1.15.1.json is an extended (-e) export as written by ncdu
+// 1.15.1, trimmed to a few entries of every kind.
+func TestReadNcduOneDotX(t *testing.T) {
+	file, err := os.Open(filepath.Join("testdata", "ncdu-1.15.1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	tree, err := ReadNcdu(file, domain.SizeDisk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.RootID != "/srv/data" {
+		t.Fatalf("root %q, want /srv/data", tree.RootID)
+	}
+	node := func(path string) *domain.Node {
+		t.Helper()
+		found, ok := tree.Nodes[filepath.Join(tree.RootID, path)]
+		if !ok {
+			t.Fatalf("%s is missing", path)
+		}
+		return found
+	}
+
+	for _, want := range []struct {
+		path    string
+		typ     domain.NodeType
+		skipped domain.SkipReason
+	}{
+		{"docs", domain.NodeDir, domain.SkipNone},
+		{"docs/notes.txt", domain.NodeFile, domain.SkipNone},
+		{"latest", domain.NodeSymlink, domain.SkipNone},
+		{"node_modules", domain.NodeFile, domain.SkipExcluded},
+		{"build.log", domain.NodeFile, domain.SkipExcluded},
+		{"mnt", domain.NodeDir, domain.SkipMount},
+	} {
+		got := node(want.path)
+		if got.Type != want.typ || got.Skipped != want.skipped {
+			t.Errorf("%s: type %v skipped %q, want %v %q", want.path, got.Type, got.Skipped, want.typ, want.skipped)
+		}
+	}
+	if node("mnt").Scanned || node("node_modules").AccumBytes != 0 {
+		t.Error("skipped entries must be unscanned and empty")
+	}
+	if !node("docs").Scanned || !node("private").Scanned {
+		t.Error("folders listed in the export must be scanned")
+	}
+	if node("private").ReadError == "" {
+		t.Error("private: read error was dropped")
+	}
+	for _, path := range []string{"docs/report.pdf", "backup/report.pdf"} {
+		if got := node(path); !got.Shared || got.Links < 2 {
+			t.Errorf("%s: shared %v with %d links, want a hardlink", path, got.Shared, got.Links)
+		}
+	}
+	if got := node("docs/notes.txt").ModTime.Unix(); got != 1696940000 {
+		t.Errorf("notes.txt mtime %d, want 1696940000", got)
+	}
+	// ncdu leaves out a zero dsize, so the link falls back to its asize.
+	if got, want := tree.Nodes[tree.RootID].AccumBytes, int64(53248+4096+10); got != want {
+		t.Errorf("root holds %d bytes, want %d with the hardlink counted once", got, want)
+	}
+}
+
+func TestNcduRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a", "one"), 300)
+	writeFile(t, filepath.Join(root, "a", "b", "two"), 4000)
+	writeFile(t, filepath.Join(root, "skip", "three"), 50)
+	writeFile(t, filepath.Join(root, "four"), 7)
+	symlink(t, "four", filepath.Join(root, "link"))
+	req := ScanRequest{RootPath: root, SizeMode: domain.SizeApparent, Exclude: []string{"skip"}}
+	want := domain.TreeIndex{Nodes: walkTree(t, req, 1), RootID: root}
+
+	var buffer bytes.Buffer
+	if err := ExportNcdu(&buffer, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadNcdu(&buffer, domain.SizeApparent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.RootID != want.RootID || len(got.Nodes) != len(want.Nodes) {
+		t.Fatalf("read %d nodes below %q, want %d below %q", len(got.Nodes), got.RootID, len(want.Nodes), want.RootID)
+	}
+	for path, wantNode := range want.Nodes {
+		gotNode, ok := got.Nodes[path]
+		if !ok {
+			t.Errorf("%s is missing", path)
+			continue
+		}
+		if gotNode.Type != wantNode.Type || gotNode.Skipped != wantNode.Skipped ||
+			gotNode.AccumBytes != wantNode.AccumBytes || gotNode.FileCount != wantNode.FileCount ||
+			gotNode.ModTime.Unix() != wantNode.ModTime.Unix() || gotNode.Mode.Perm() != wantNode.Mode.Perm() {
+			t.Errorf("%s: read %+v, want %+v", path, *gotNode, *wantNode)
+		}
+	}
+}
+
+func TestReadNcduRejectsMalformedInput(t *testing.T) {
+	for name, input := range map[string]string{
+		"empty":          "",
+		"object":         `{"name":"/"}`,
+		"major version":  `[2,0,{},[{"name":"/"}]]`,
+		"missing meta":   `[1,0]`,
+		"root is a file": `[1,0,{},{"name":"/"}]`,
+		"unnamed entry":  `[1,0,{},[{"name":"/"},{"asize":1}]]`,
+		"number child":   `[1,0,{},[{"name":"/"},5]]`,
+		"key type":       `[1,0,{},[{"name":"/",1:2}]]`,
+		"truncated":      `[1,0,{},[{"name":"/"},[{"name":"a"},{"name":"b"`,
+		"unclosed root":  `[1,0,{},[{"name":"/"}`,
+	} {
+		if _, err := ReadNcdu(strings.NewReader(input), domain.SizeApparent); err == nil {
+			t.Errorf("%s: read without an error", name)
+		}
+	}
+}
+
+func TestImportScannerRereadsOnSizeModeChange(t *testing.T) {
+	scanner, err := NewImportScanner(filepath.Join("testdata", "ncdu-1.15.1.json"), domain.SizeApparent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := func(mode domain.SizeMode) int64 {
+		t.Helper()
+		if _, err := scanner.Scan(context.Background(), ScanRequest{SizeMode: mode}); err != nil {
+			t.Fatal(err)
+		}
+		return scanner.Snapshot().Nodes["/srv/data/docs/notes.txt"].SizeBytes
+	}
+	if got := size(domain.SizeApparent); got != 120 {
+		t.Errorf("apparent size %d, want 120", got)
+	}
+	if got := size(domain.SizeDisk); got != 4096 {
+		t.Errorf("disk size %d, want 4096", got)
+	}
+}
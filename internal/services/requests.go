@@ -1,23 +1,36 @@
 package services
 
+import "sweepfs/internal/domain"
+
 type ScanRequest struct {
-	RootPath   string
-	ShowHidden bool
+	RootPath       string
+	ShowHidden     bool
+	SizeMode       domain.SizeMode
+	OneFileSystem  bool
+	FollowSymlinks bool
+	Exclude        []string
+	MaxDepth       int
+	Concurrency    int
+	SniffTypes     bool
+	IndexArchives  bool
 }
 
 type ActionType string
 
 const (
-	ActionDelete ActionType = "delete"
-	ActionMove   ActionType = "move"
-	ActionCopy   ActionType = "copy"
-	ActionBackup ActionType = "backup"
+	ActionDelete  ActionType = "delete"
+	ActionMove    ActionType = "move"
+	ActionCopy    ActionType = "copy"
+	ActionBackup  ActionType = "backup"
+	ActionDedupe  ActionType = "dedupe"
+	ActionExtract ActionType = "extract"
 )
 
 type ActionRequest struct {
-	Type         ActionType
-	SourcePaths  []string
-	Destination  string
-	SafeMode     bool
-	ConfirmToken string
+	Type          ActionType
+	SourcePaths   []string
+	Destination   string
+	SafeMode      bool
+	AllowDirtyGit bool
+	ConfirmToken  string
 }
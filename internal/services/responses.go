@@ -1,10 +1,23 @@
 package services
 
-import "time"
+import (
+	"time"
+
+	"sweepfs/internal/domain"
+)
 
 type ScanResult struct {
 	RootPath string
 	Duration time.Duration
+	Errors   []ScanError
+}
+
+// ScanError is a path the scan could not read. Sizes above it are
+// incomplete.
+type ScanError struct {
+	Path    string
+	Kind    domain.ErrorKind
+	Message string
 }
 
 type ActionResult struct {
@@ -15,4 +28,8 @@ type ActionResult struct {
 	Message      string
 	Errors       []string
 	Skipped      int
+	// BytesReclaimed is the space a dedupe freed and Replaced the copies it
+	// linked to the kept file.
+	BytesReclaimed int64
+	Replaced       []string
 }
@@ -23,6 +23,8 @@ type ActionPreview struct {
 	TotalBytes  int64
 	Samples     []string
 	Warnings    []string
+	Git         []GitStatus
+	Blocked     bool
 }
 
 type ActionProgress struct {
@@ -53,3 +55,21 @@ type SnapshotProvider interface {
 type Invalidator interface {
 	Invalidate(path string)
 }
+
+// TreeUpdate reports paths that changed in the scanned tree while watching.
+type TreeUpdate struct {
+	Root       string
+	Paths      []string
+	ErrMessage string
+}
+
+type Watcher interface {
+	Watch(ctx context.Context, req ScanRequest) error
+	Updates() <-chan TreeUpdate
+}
+
+// ImportedSource is implemented by scanners that serve a tree loaded from a
+// file. Such trees do not reflect the local filesystem and are read-only.
+type ImportedSource interface {
+	ImportedFrom() string
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"sort"
+
+	"sweepfs/internal/domain"
+)
+
+// applyUsage fills in the per-category and per-owner totals of every
+// directory from the files below it. Files count their AccumBytes so
+// hardlinks are counted once.
+func applyUsage(nodes map[string]*domain.Node) {
+	paths := make([]string, 0, len(nodes))
+	for path := range nodes {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return depth(paths[i]) > depth(paths[j])
+	})
+
+	for _, path := range paths {
+		node := nodes[path]
+		if node.Type != domain.NodeDir {
+			if node.Category == "" {
+				node.Category = domain.CategoryOf(node.Name)
+			}
+			continue
+		}
+		node.Categories = nil
+		node.Owners = nil
+		for _, childID := range node.ChildrenIDs {
+			if child, ok := nodes[childID]; ok {
+				node.Categories = addUsage(node.Categories, categoryTotals(child), 1)
+				node.Owners = addUsage(node.Owners, ownerTotals(child), 1)
+			}
+		}
+	}
+}
+
+// ownerTotals is what node contributes to the per-owner totals of its
+// ancestors.
+func ownerTotals(node *domain.Node) map[uint32]domain.UsageTotal {
+	if node == nil {
+		return nil
+	}
+	if node.Type != domain.NodeDir {
+		return map[uint32]domain.UsageTotal{node.UID: {Bytes: node.AccumBytes, Files: 1}}
+	}
+	return node.Owners
+}
+
+// addUsage adds sign times delta to totals, dropping keys that end up empty,
+// and returns the result. totals may be nil.
+func addUsage[K comparable](totals, delta map[K]domain.UsageTotal, sign int) map[K]domain.UsageTotal {
+	for key, change := range delta {
+		if totals == nil {
+			totals = make(map[K]domain.UsageTotal)
+		}
+		current := totals[key]
+		current.Bytes += int64(sign) * change.Bytes
+		current.Files += sign * change.Files
+		if current.Files <= 0 && current.Bytes <= 0 {
+			delete(totals, key)
+			continue
+		}
+		totals[key] = current
+	}
+	return totals
+}
+
+func cloneUsage[K comparable](totals map[K]domain.UsageTotal) map[K]domain.UsageTotal {
+	if totals == nil {
+		return nil
+	}
+	clone := make(map[K]domain.UsageTotal, len(totals))
+	for key, total := range totals {
+		clone[key] = total
+	}
+	return clone
+}
@@ -0,0 +1,642 @@
+package services
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"sweepfs/internal/domain"
+	"sweepfs/internal/fsinfo"
+)
+
+type visitAction int
+
+const (
+	visitSkip visitAction = iota
+	visitDir
+	visitFile
+)
+
+// scanWalk holds the state shared by the sequential and the parallel walker.
+// Both call visit for every entry, so filtering, placeholders and cache reuse
+// behave the same whichever walker runs.
+type scanWalk struct {
+	ctx           context.Context
+	scanner       *FSScanner
+	req           ScanRequest
+	root          string
+	rootDevice    uint64
+	hasRootDevice bool
+	ignores       *ignoreTree
+	progress      chan<- ScanProgress
+	mu            sync.Mutex
+	nodes         map[string]*domain.Node
+	errors        []ScanError
+	links         []walkLink
+	scanned       int64
+}
+
+// walkLink is a symlink to a folder waiting for followLinks.
+type walkLink struct {
+	path   string
+	target os.FileInfo
+}
+
+func newScanWalk(ctx context.Context, scanner *FSScanner, req ScanRequest, root string, progress chan<- ScanProgress) *scanWalk {
+	rootNode := &domain.Node{
+		ID:       root,
+		Name:     filepath.Base(root),
+		Path:     root,
+		Type:     domain.NodeDir,
+		SizeMode: req.SizeMode,
+		Scanned:  true,
+	}
+	if rootNode.Name == "." || rootNode.Name == string(filepath.Separator) {
+		rootNode.Name = root
+	}
+	rootDevice, hasRootDevice := deviceOf(root)
+	return &scanWalk{
+		ctx:           ctx,
+		scanner:       scanner,
+		req:           req,
+		root:          root,
+		rootDevice:    rootDevice,
+		hasRootDevice: hasRootDevice,
+		ignores:       newIgnoreTree(root, req.Exclude),
+		progress:      progress,
+		nodes:         map[string]*domain.Node{root: rootNode},
+	}
+}
+
+func scanConcurrency(requested int) int {
+	if requested > 0 {
+		return requested
+	}
+	return maxInt(2, runtime.NumCPU())
+}
+
+func (walk *scanWalk) run(workers int) error {
+	var err error
+	// WalkDir does not enter a symlinked root, which is what refreshing a
+	// followed link scans, so that case always takes the parallel walker.
+	info, statErr := os.Lstat(walk.root)
+	linkedRoot := walk.req.FollowSymlinks && statErr == nil && info.Mode()&fs.ModeSymlink != 0
+	if workers <= 1 && !linkedRoot {
+		err = walk.runSequential()
+	} else {
+		err = walk.runParallel(workers)
+	}
+	if err != nil {
+		return err
+	}
+	return walk.followLinks()
+}
+
+func (walk *scanWalk) visit(path string, entry fs.DirEntry) visitAction {
+	if path != walk.root {
+		if !walk.req.ShowHidden && isHidden(entry.Name()) {
+			return visitSkip
+		}
+		if rule, excluded := walk.ignores.match(path, entry.IsDir()); excluded {
+			if entry.IsDir() {
+				node := skippedNode(walk.root, path, entry, walk.req, domain.SkipExcluded)
+				node.ExcludedBy = rule.String()
+				walk.add(node)
+			}
+			return visitSkip
+		}
+	}
+
+	if entry.IsDir() && path != walk.root && walk.req.OneFileSystem && walk.hasRootDevice {
+		if device, ok := deviceOf(path); ok && device != walk.rootDevice {
+			node := skippedNode(walk.root, path, entry, walk.req, domain.SkipMount)
+			node.FSType = fsinfo.FSType(path)
+			walk.add(node)
+			return visitSkip
+		}
+	}
+
+	if entry.IsDir() && path != walk.root && walk.req.MaxDepth > 0 && depthFrom(walk.root, path) >= walk.req.MaxDepth {
+		walk.add(skippedNode(walk.root, path, entry, walk.req, domain.SkipDepth))
+		return visitSkip
+	}
+
+	if entry.Type()&fs.ModeSymlink != 0 && path != walk.root {
+		walk.add(walk.linkNode(path, entry))
+		walk.count(path)
+		return visitSkip
+	}
+
+	if entry.IsDir() {
+		if walk.scanner.canReuseDir(path, walk.req) {
+			walk.scanner.mergeCachedSubtree(path, walk.nodes, &walk.mu)
+			progressNonBlocking(walk.progress, ScanProgress{Path: path, Scanned: atomic.LoadInt64(&walk.scanned), Current: path})
+			return visitSkip
+		}
+		dirNode := &domain.Node{
+			ID:       path,
+			Name:     entry.Name(),
+			Path:     path,
+			Type:     domain.NodeDir,
+			SizeMode: walk.req.SizeMode,
+			ParentID: parentPath(walk.root, path),
+			Scanned:  true,
+		}
+		if info, err := entry.Info(); err == nil {
+			fsinfo.Apply(dirNode, info)
+		}
+		if ignore, err := walk.ignores.load(path); err != nil {
+			walk.fail(filepath.Join(path, ignoreFileName), err, false)
+		} else {
+			stampIgnoreFile(dirNode, ignore)
+		}
+		walk.add(dirNode)
+		walk.count(path)
+		return visitDir
+	}
+
+	walk.add(&domain.Node{
+		ID:       path,
+		Name:     entry.Name(),
+		Path:     path,
+		Type:     domain.NodeFile,
+		SizeMode: walk.req.SizeMode,
+		ParentID: parentPath(walk.root, path),
+		Category: domain.CategoryOf(entry.Name()),
+	})
+	walk.count(path)
+	return visitFile
+}
+
+// linkNode records the symlink at path. Unless FollowSymlinks is set, or when
+// the target is missing, it stays a symlink node sized like the link itself.
+// A followed link to a file takes the size and identity of the file, and a
+// link to a folder is queued for followLinks.
+func (walk *scanWalk) linkNode(path string, entry fs.DirEntry) *domain.Node {
+	node := &domain.Node{
+		ID:       path,
+		Name:     entry.Name(),
+		Path:     path,
+		Type:     domain.NodeSymlink,
+		SizeMode: walk.req.SizeMode,
+		ParentID: parentPath(walk.root, path),
+	}
+	node.LinkTarget, _ = os.Readlink(path)
+	if info, err := entry.Info(); err == nil {
+		node.SizeBytes = fsinfo.Size(info, walk.req.SizeMode)
+		node.AccumBytes = node.SizeBytes
+		fsinfo.Apply(node, info)
+	}
+	target, err := os.Stat(path)
+	if err != nil {
+		node.BrokenLink = true
+		return node
+	}
+	if !walk.req.FollowSymlinks {
+		return node
+	}
+	stat, ok := fsinfo.Of(target)
+	if !ok {
+		return node
+	}
+	switch {
+	case target.Mode().IsRegular():
+		node.Type = domain.NodeFile
+		node.SizeBytes = fsinfo.Size(target, walk.req.SizeMode)
+		node.AccumBytes = node.SizeBytes
+		node.Category = fileCategory(path, entry.Name(), target, walk.req.SniffTypes)
+		fsinfo.Apply(node, target)
+		node.Shared = true
+	case target.IsDir():
+		if walk.req.OneFileSystem && walk.hasRootDevice && stat.Dev != walk.rootDevice {
+			node.Skipped = domain.SkipMount
+			node.FSType = fsinfo.FSType(path)
+			return node
+		}
+		if walk.req.MaxDepth > 0 && depthFrom(walk.root, path) >= walk.req.MaxDepth {
+			return node
+		}
+		walk.mu.Lock()
+		walk.links = append(walk.links, walkLink{path: path, target: target})
+		walk.mu.Unlock()
+	}
+	return node
+}
+
+// followLinks walks the folders behind symlinks once the regular walk is
+// done, so a folder that is also reachable by its real path inside the root
+// is counted there. Every folder is entered once by (device, inode): a link
+// to a folder already walked is marked as a loop when it points at one of
+// its own ancestors and as linked otherwise.
+func (walk *scanWalk) followLinks() error {
+	if len(walk.links) == 0 {
+		return nil
+	}
+	seen := make(map[inodeKey]bool)
+	var rootKey inodeKey
+	if info, err := os.Stat(walk.root); err == nil {
+		if stat, ok := fsinfo.Of(info); ok {
+			rootKey = inodeKey{dev: stat.Dev, ino: stat.Ino}
+			seen[rootKey] = true
+		}
+	}
+	for _, node := range walk.nodes {
+		if node.Type == domain.NodeDir && node.Scanned && node.Inode != 0 {
+			seen[inodeKey{dev: node.Device, ino: node.Inode}] = true
+		}
+	}
+	for len(walk.links) > 0 {
+		links := walk.links
+		walk.links = nil
+		sort.Slice(links, func(i, j int) bool {
+			return links[i].path < links[j].path
+		})
+		for _, link := range links {
+			if walk.ctx.Err() != nil {
+				return walk.ctx.Err()
+			}
+			node := walk.nodes[link.path]
+			stat, _ := fsinfo.Of(link.target)
+			key := inodeKey{dev: stat.Dev, ino: stat.Ino}
+			if seen[key] {
+				node.Skipped = domain.SkipLinked
+				if key == rootKey || walk.hasAncestor(node, key) {
+					node.Skipped = domain.SkipLoop
+				}
+				continue
+			}
+			seen[key] = true
+			node.Type = domain.NodeDir
+			node.SizeBytes = 0
+			node.AccumBytes = 0
+			node.Scanned = true
+			fsinfo.Apply(node, link.target)
+			if err := walk.followDir(link.path, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// stampIgnoreFile records the mtime and size of the ignore file read in a
+// folder, so a cached copy of the folder is not reused once it is edited.
+func stampIgnoreFile(node *domain.Node, info os.FileInfo) {
+	if info == nil {
+		return
+	}
+	node.IgnoreModTime = info.ModTime()
+	node.IgnoreSize = info.Size()
+}
+
+// followDir walks the folder behind a followed link, adding every folder it
+// enters to seen. A folder below it that was already walked, such as the scan
+// root behind a link to its parent, is marked as linked and not entered.
+func (walk *scanWalk) followDir(path string, seen map[inodeKey]bool) error {
+	if ignore, err := walk.ignores.load(path); err != nil {
+		walk.fail(filepath.Join(path, ignoreFileName), err, false)
+	} else {
+		stampIgnoreFile(walk.nodes[path], ignore)
+	}
+	stack := []string{path}
+	for len(stack) > 0 {
+		dir := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		err := walk.readDir(walk.ctx, dir, func(child string) {
+			if node, ok := walk.nodes[child]; ok && node.Inode != 0 {
+				key := inodeKey{dev: node.Device, ino: node.Inode}
+				if seen[key] {
+					node.Skipped = domain.SkipLinked
+					node.Scanned = false
+					return
+				}
+				seen[key] = true
+			}
+			stack = append(stack, child)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasAncestor reports whether a folder above node has the identity key.
+func (walk *scanWalk) hasAncestor(node *domain.Node, key inodeKey) bool {
+	for parent, ok := walk.nodes[node.ParentID]; ok; parent, ok = walk.nodes[parent.ParentID] {
+		if parent.Inode != 0 && parent.Device == key.dev && parent.Inode == key.ino {
+			return true
+		}
+	}
+	return false
+}
+
+func (walk *scanWalk) add(node *domain.Node) {
+	walk.mu.Lock()
+	walk.nodes[node.ID] = node
+	walk.mu.Unlock()
+}
+
+func (walk *scanWalk) applyFile(path string, info os.FileInfo, err error) {
+	if err != nil {
+		walk.fail(path, err, true)
+		return
+	}
+	if info == nil {
+		return
+	}
+	size := fsinfo.Size(info, walk.req.SizeMode)
+	category := fileCategory(path, filepath.Base(path), info, walk.req.SniffTypes)
+	walk.mu.Lock()
+	defer walk.mu.Unlock()
+	node, ok := walk.nodes[path]
+	if !ok {
+		return
+	}
+	node.SizeBytes = size
+	node.AccumBytes = size
+	node.Category = category
+	fsinfo.Apply(node, info)
+}
+
+func (walk *scanWalk) count(path string) {
+	scanned := atomic.AddInt64(&walk.scanned, 1)
+	if scanned%50 == 0 {
+		progressNonBlocking(walk.progress, ScanProgress{Path: path, Scanned: scanned, Current: path})
+	}
+}
+
+func (walk *scanWalk) warn(path string, err error) {
+	progressNonBlocking(walk.progress, ScanProgress{Path: path, Scanned: atomic.LoadInt64(&walk.scanned), ErrMessage: err.Error()})
+}
+
+// fail records an error for path and keeps scanning. When flag is set the
+// node at path is marked unreadable.
+func (walk *scanWalk) fail(path string, err error, flag bool) {
+	walk.warn(path, err)
+	scanErr := ScanError{Path: path, Kind: errorKind(err), Message: err.Error()}
+	walk.mu.Lock()
+	defer walk.mu.Unlock()
+	walk.errors = append(walk.errors, scanErr)
+	if node, ok := walk.nodes[path]; ok && flag {
+		node.ReadError = scanErr.Message
+		node.ErrorKind = scanErr.Kind
+	}
+}
+
+// scanErrors returns the recorded errors without those inside a directory
+// that could not be read itself, such as its .sweepfsignore file.
+func (walk *scanWalk) scanErrors() []ScanError {
+	walk.mu.Lock()
+	defer walk.mu.Unlock()
+	unreadable := make(map[string]bool, len(walk.errors))
+	for _, scanErr := range walk.errors {
+		unreadable[scanErr.Path] = true
+	}
+	list := make([]ScanError, 0, len(walk.errors))
+	for _, scanErr := range walk.errors {
+		if !unreadable[filepath.Dir(scanErr.Path)] {
+			list = append(list, scanErr)
+		}
+	}
+	return list
+}
+
+// runSequential walks with filepath.WalkDir and fans the file Lstat calls out
+// to a worker pool.
+func (walk *scanWalk) runSequential() error {
+	workerCount := maxInt(2, runtime.NumCPU())
+	jobs := make(chan fileJob, workerCount*8)
+	results := make(chan fileResult, workerCount*8)
+	var wg sync.WaitGroup
+	for i := 0; i < workerCount; i++ {
+		wg.Add(1)
+		go worker(walk.ctx, jobs, results, &wg)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	resultsDone := make(chan struct{})
+	go func() {
+		defer close(resultsDone)
+		for result := range results {
+			walk.applyFile(result.path, result.info, result.err)
+		}
+	}()
+
+	walkErr := filepath.WalkDir(walk.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == walk.root && entry == nil {
+				return err
+			}
+			walk.fail(path, err, true)
+			return nil
+		}
+		if walk.ctx.Err() != nil {
+			return walk.ctx.Err()
+		}
+		switch walk.visit(path, entry) {
+		case visitSkip:
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+		case visitFile:
+			select {
+			case jobs <- fileJob{path: path}:
+			case <-walk.ctx.Done():
+				return walk.ctx.Err()
+			}
+		}
+		return nil
+	})
+	close(jobs)
+	<-resultsDone
+	return walkErr
+}
+
+// runParallel reads directories on several goroutines. Each goroutine keeps
+// its own deque of pending directories and steals from the others when it
+// runs dry.
+func (walk *scanWalk) runParallel(workers int) error {
+	rootInfo, err := os.Lstat(walk.root)
+	if err != nil {
+		return err
+	}
+	linkTarget := ""
+	if walk.req.FollowSymlinks && rootInfo.Mode()&fs.ModeSymlink != 0 {
+		if rootInfo, err = os.Stat(walk.root); err != nil {
+			return err
+		}
+		linkTarget, _ = os.Readlink(walk.root)
+	}
+	switch walk.visit(walk.root, fs.FileInfoToDirEntry(rootInfo)) {
+	case visitSkip:
+		return nil
+	case visitFile:
+		walk.applyFile(walk.root, rootInfo, nil)
+		return nil
+	}
+	walk.nodes[walk.root].LinkTarget = linkTarget
+
+	ctx, cancel := context.WithCancel(walk.ctx)
+	defer cancel()
+	pool := newWalkPool(workers)
+	pool.push(0, walk.root)
+
+	var failOnce sync.Once
+	var failure error
+	var wg sync.WaitGroup
+	for id := 0; id < workers; id++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			err := pool.run(ctx, id, func(dir string) error {
+				return walk.readDir(ctx, dir, func(child string) {
+					pool.push(id, child)
+				})
+			})
+			if err != nil {
+				failOnce.Do(func() {
+					failure = err
+					cancel()
+				})
+			}
+		}(id)
+	}
+	wg.Wait()
+	if walk.ctx.Err() != nil {
+		return walk.ctx.Err()
+	}
+	return failure
+}
+
+func (walk *scanWalk) readDir(ctx context.Context, dir string, push func(string)) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		walk.fail(dir, err, true)
+	}
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		path := filepath.Join(dir, entry.Name())
+		switch walk.visit(path, entry) {
+		case visitDir:
+			push(path)
+		case visitFile:
+			info, err := os.Lstat(path)
+			walk.applyFile(path, info, err)
+		}
+	}
+	return nil
+}
+
+type dirDeque struct {
+	mu    sync.Mutex
+	items []string
+}
+
+func (deque *dirDeque) pushBack(dir string) {
+	deque.mu.Lock()
+	deque.items = append(deque.items, dir)
+	deque.mu.Unlock()
+}
+
+func (deque *dirDeque) popBack() (string, bool) {
+	deque.mu.Lock()
+	defer deque.mu.Unlock()
+	if len(deque.items) == 0 {
+		return "", false
+	}
+	last := len(deque.items) - 1
+	dir := deque.items[last]
+	deque.items = deque.items[:last]
+	return dir, true
+}
+
+func (deque *dirDeque) popFront() (string, bool) {
+	deque.mu.Lock()
+	defer deque.mu.Unlock()
+	if len(deque.items) == 0 {
+		return "", false
+	}
+	dir := deque.items[0]
+	deque.items = deque.items[1:]
+	return dir, true
+}
+
+type walkPool struct {
+	deques  []*dirDeque
+	pending int64
+	wake    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+func newWalkPool(workers int) *walkPool {
+	deques := make([]*dirDeque, workers)
+	for index := range deques {
+		deques[index] = &dirDeque{}
+	}
+	return &walkPool{
+		deques: deques,
+		wake:   make(chan struct{}, workers),
+		done:   make(chan struct{}),
+	}
+}
+
+func (pool *walkPool) push(owner int, dir string) {
+	atomic.AddInt64(&pool.pending, 1)
+	pool.deques[owner].pushBack(dir)
+	select {
+	case pool.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next pops from the owner's deque (newest first, keeping the walk depth
+// first) and otherwise steals the oldest entry of another deque, which tends
+// to be the largest remaining subtree.
+func (pool *walkPool) next(owner int) (string, bool) {
+	if dir, ok := pool.deques[owner].popBack(); ok {
+		return dir, true
+	}
+	for offset := 1; offset < len(pool.deques); offset++ {
+		victim := pool.deques[(owner+offset)%len(pool.deques)]
+		if dir, ok := victim.popFront(); ok {
+			return dir, true
+		}
+	}
+	return "", false
+}
+
+func (pool *walkPool) run(ctx context.Context, owner int, process func(dir string) error) error {
+	for {
+		dir, ok := pool.next(owner)
+		if !ok {
+			select {
+			case <-pool.done:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-pool.wake:
+				continue
+			}
+		}
+		err := process(dir)
+		if atomic.AddInt64(&pool.pending, -1) == 0 {
+			pool.once.Do(func() {
+				close(pool.done)
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
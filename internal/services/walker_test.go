@@ -0,0 +1,245 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"sweepfs/internal/domain"
+)
+
+func BenchmarkScanSequential(b *testing.B) {
+	benchmarkWalk(b, 1)
+}
+
+func BenchmarkScanParallel(b *testing.B) {
+	benchmarkWalk(b, scanConcurrency(0))
+}
+
+func benchmarkWalk(b *testing.B, workers int) {
+	root := b.TempDir()
+	writeBenchTree(b, root, 3, 8, 10)
+	scanner := &FSScanner{
+		cache:       make(map[string]*domain.Node),
+		scannedDirs: make(map[string]bool),
+	}
+	progress := make(chan ScanProgress, 64)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		walk := newScanWalk(context.Background(), scanner, ScanRequest{RootPath: root, ShowHidden: true}, root, progress)
+		if err := walk.run(workers); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func writeBenchTree(tb testing.TB, dir string, levels, dirs, files int) {
+	for index := 0; index < files; index++ {
+		name := filepath.Join(dir, fmt.Sprintf("file-%d.dat", index))
+		if err := os.WriteFile(name, make([]byte, index*64), 0o644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if levels == 0 {
+		return
+	}
+	for index := 0; index < dirs; index++ {
+		child := filepath.Join(dir, fmt.Sprintf("dir-%d", index))
+		if err := os.Mkdir(child, 0o755); err != nil {
+			tb.Fatal(err)
+		}
+		writeBenchTree(tb, child, levels-1, dirs, files)
+	}
+}
+
+func walkTree(t *testing.T, req ScanRequest, workers int) map[string]*domain.Node {
+	t.Helper()
+	return buildTree(t, newTestWalk(context.Background(), req, nil), workers)
+}
+
+func newTestWalk(ctx context.Context, req ScanRequest, progress chan<- ScanProgress) *scanWalk {
+	scanner := &FSScanner{
+		cache:       make(map[string]*domain.Node),
+		scannedDirs: make(map[string]bool),
+	}
+	return newScanWalk(ctx, scanner, req, req.RootPath, progress)
+}
+
+func buildTree(t *testing.T, walk *scanWalk, workers int) map[string]*domain.Node {
+	t.Helper()
+	if err := walk.run(workers); err != nil {
+		t.Fatal(err)
+	}
+	nodes := walk.nodes
+	applyHierarchy(nodes)
+	applyHardlinks(nodes)
+	applyAccumulation(nodes)
+	applyFileCounts(nodes)
+	applyDirCounts(nodes)
+	return nodes
+}
+
+func writeFile(t *testing.T, path string, size int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func symlink(t *testing.T, target, path string) {
+	t.Helper()
+	if err := os.Symlink(target, path); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+}
+
+func TestFollowSymlinksWalksEachFolderOnce(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(t *testing.T, root string) string
+		marked string
+		bytes  int64
+	}{
+		{
+			name: "link to ancestor",
+			setup: func(t *testing.T, root string) string {
+				writeFile(t, filepath.Join(root, "a", "f"), 1000)
+				writeFile(t, filepath.Join(root, "g"), 7)
+				symlink(t, "..", filepath.Join(root, "up"))
+				return filepath.Join(root, "up", filepath.Base(root))
+			},
+			bytes: 1007,
+		},
+		{
+			name: "link to sibling",
+			setup: func(t *testing.T, root string) string {
+				writeFile(t, filepath.Join(root, "a", "f"), 500)
+				if err := os.Mkdir(filepath.Join(root, "b"), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				symlink(t, "../a", filepath.Join(root, "b", "l"))
+				return filepath.Join(root, "b", "l")
+			},
+			bytes: 500,
+		},
+	}
+	for _, test := range tests {
+		for _, workers := range []int{1, 4} {
+			t.Run(fmt.Sprintf("%s/workers=%d", test.name, workers), func(t *testing.T) {
+				root := filepath.Join(t.TempDir(), "root")
+				if err := os.Mkdir(root, 0o755); err != nil {
+					t.Fatal(err)
+				}
+				marked := test.setup(t, root)
+				nodes := walkTree(t, ScanRequest{RootPath: root, FollowSymlinks: true}, workers)
+
+				node, ok := nodes[marked]
+				if !ok || node.Skipped != domain.SkipLinked {
+					t.Fatalf("%s: want a %q placeholder", marked, domain.SkipLinked)
+				}
+				for path := range nodes {
+					if path != marked && isWithin(marked, path) {
+						t.Errorf("%s was walked again below %s", path, marked)
+					}
+				}
+				var links int64
+				for _, node := range nodes {
+					if node.Type == domain.NodeSymlink {
+						links += node.SizeBytes
+					}
+				}
+				if got := nodes[root].AccumBytes - links; got != test.bytes {
+					t.Errorf("root holds %d bytes besides links, want %d", got, test.bytes)
+				}
+			})
+		}
+	}
+}
+
+func TestWalkersBuildTheSameTree(t *testing.T) {
+	tests := []struct {
+		name  string
+		req   ScanRequest
+		setup func(t *testing.T, root string)
+		walk  func(walk *scanWalk)
+	}{
+		{name: "hidden files left out"},
+		{name: "hidden files shown", req: ScanRequest{ShowHidden: true}},
+		{name: "exclusions", req: ScanRequest{ShowHidden: true, Exclude: []string{"node_modules", "*.log", "/src/b"}}},
+		{
+			name: "sweepfsignore",
+			setup: func(t *testing.T, root string) {
+				writeText(t, filepath.Join(root, "src", ignoreFileName), "cache/\n*.log\n!keep.log\n")
+				writeFile(t, filepath.Join(root, "src", "cache", "blob"), 900)
+				writeFile(t, filepath.Join(root, "src", "keep.log"), 30)
+			},
+		},
+		{name: "max depth", req: ScanRequest{ShowHidden: true, MaxDepth: 2}},
+		{
+			name: "one filesystem",
+			req:  ScanRequest{OneFileSystem: true},
+			walk: func(walk *scanWalk) {
+				walk.rootDevice++
+				walk.hasRootDevice = true
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFile(t, filepath.Join(root, "top.txt"), 10)
+			writeFile(t, filepath.Join(root, ".hidden"), 20)
+			writeFile(t, filepath.Join(root, ".config", "settings"), 40)
+			writeFile(t, filepath.Join(root, "src", "a", "main.go"), 300)
+			writeFile(t, filepath.Join(root, "src", "a", "deep", "deeper", "x.bin"), 5000)
+			writeFile(t, filepath.Join(root, "src", "b", "build.log"), 700)
+			writeFile(t, filepath.Join(root, "node_modules", "pkg", "index.js"), 80)
+			if test.setup != nil {
+				test.setup(t, root)
+			}
+			req := test.req
+			req.RootPath = root
+			trees := make([]map[string]*domain.Node, 0, 2)
+			for _, workers := range []int{1, 4} {
+				walk := newTestWalk(context.Background(), req, nil)
+				if test.walk != nil {
+					test.walk(walk)
+				}
+				trees = append(trees, buildTree(t, walk, workers))
+			}
+			sequential, parallel := trees[0], trees[1]
+			if len(sequential) != len(parallel) {
+				t.Errorf("sequential walk found %d nodes, parallel %d", len(sequential), len(parallel))
+			}
+			for path, want := range sequential {
+				got, ok := parallel[path]
+				if !ok {
+					t.Errorf("%s: missing from the parallel walk", path)
+					continue
+				}
+				if !reflect.DeepEqual(comparableNode(got), comparableNode(want)) {
+					t.Errorf("%s: parallel %+v, sequential %+v", path, comparableNode(got), comparableNode(want))
+				}
+			}
+		})
+	}
+}
+
+// comparableNode drops what differs between two walks of the same tree:
+// access times, which reading a folder may update, and child order.
+func comparableNode(node *domain.Node) domain.Node {
+	clone := *node
+	clone.AccessTime = time.Time{}
+	clone.NewestAccess = time.Time{}
+	clone.ChildrenIDs = append([]string{}, node.ChildrenIDs...)
+	sort.Strings(clone.ChildrenIDs)
+	return clone
+}
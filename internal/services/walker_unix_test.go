@@ -0,0 +1,53 @@
+//go:build linux || darwin
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// The ignore file of gate is a FIFO, so each walker blocks reading it until
+// the test has cancelled the walk. Nothing after gate may be walked.
+func TestWalkersStopWhenCancelled(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			root := t.TempDir()
+			writeBenchTree(t, root, 1, 4, 10)
+			writeFile(t, filepath.Join(root, "gate", "inside"), 10)
+			writeFile(t, filepath.Join(root, "zz-after"), 10)
+			fifo := filepath.Join(root, "gate", ignoreFileName)
+			if err := syscall.Mkfifo(fifo, 0o600); err != nil {
+				t.Skipf("fifos unavailable: %v", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			walk := newTestWalk(ctx, ScanRequest{RootPath: root}, nil)
+			result := make(chan error, 1)
+			go func() {
+				result <- walk.run(workers)
+			}()
+			writer, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cancel()
+			writer.Close()
+
+			if err := <-result; !errors.Is(err, context.Canceled) {
+				t.Fatalf("walk returned %v, want %v", err, context.Canceled)
+			}
+			for _, path := range []string{filepath.Join(root, "gate", "inside"), filepath.Join(root, "zz-after")} {
+				if _, ok := walk.nodes[path]; ok {
+					t.Errorf("%s was walked after the walk was cancelled", path)
+				}
+			}
+		})
+	}
+}
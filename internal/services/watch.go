@@ -0,0 +1,315 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"sweepfs/internal/domain"
+	"sweepfs/internal/fsinfo"
+)
+
+var ErrWatchUnsupported = errors.New("watch mode is not supported on this platform")
+
+type watchEvent struct {
+	path    string
+	removed bool
+}
+
+// watchState carries what a watch needs to apply events the same way the
+// scan that built the tree would have.
+type watchState struct {
+	root          string
+	req           ScanRequest
+	ignores       *ignoreTree
+	rootDevice    uint64
+	hasRootDevice bool
+}
+
+func newWatchState(req ScanRequest) *watchState {
+	root := cleanPath(req.RootPath)
+	req.RootPath = root
+	req.SizeMode = normalizeSizeMode(req.SizeMode)
+	rootDevice, hasRootDevice := deviceOf(root)
+	return &watchState{
+		root:          root,
+		req:           req,
+		ignores:       newIgnoreTree(root, req.Exclude),
+		rootDevice:    rootDevice,
+		hasRootDevice: hasRootDevice,
+	}
+}
+
+func (scanner *FSScanner) Updates() <-chan TreeUpdate {
+	return scanner.updates
+}
+
+// watchedDirs lists the scanned directories below root, shallow ones first so
+// that running out of watches drops the deepest directories.
+func (scanner *FSScanner) watchedDirs(root string) []string {
+	scanner.mu.RLock()
+	dirs := []string{}
+	for path, node := range scanner.cache {
+		if node.Type == domain.NodeDir && node.Scanned && isWithin(root, path) {
+			dirs = append(dirs, path)
+		}
+	}
+	scanner.mu.RUnlock()
+	sort.Slice(dirs, func(i, j int) bool {
+		if depth(dirs[i]) != depth(dirs[j]) {
+			return depth(dirs[i]) < depth(dirs[j])
+		}
+		return dirs[i] < dirs[j]
+	})
+	return dirs
+}
+
+func (scanner *FSScanner) publish(update TreeUpdate) {
+	select {
+	case scanner.updates <- update:
+	default:
+	}
+}
+
+// applyWatchEvents updates the cached tree for a batch of events and returns
+// the paths that changed and any directories that were scanned and now need
+// watches of their own.
+func (scanner *FSScanner) applyWatchEvents(ctx context.Context, watch *watchState, events []watchEvent) ([]string, []string) {
+	latest := make(map[string]bool, len(events))
+	order := []string{}
+	for _, event := range events {
+		if _, seen := latest[event.path]; !seen {
+			order = append(order, event.path)
+		}
+		latest[event.path] = event.removed
+	}
+
+	changed := []string{}
+	newDirs := []string{}
+	for _, path := range order {
+		if ctx.Err() != nil {
+			break
+		}
+		info, err := os.Lstat(path)
+		if latest[path] || errors.Is(err, fs.ErrNotExist) {
+			scanner.mu.Lock()
+			if scanner.removeLocked(path) {
+				changed = append(changed, path)
+			}
+			scanner.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		dirs, ok := scanner.applyWatchedPath(ctx, watch, path, info)
+		if ok {
+			changed = append(changed, path)
+			newDirs = append(newDirs, dirs...)
+		}
+	}
+	return changed, newDirs
+}
+
+func (scanner *FSScanner) applyWatchedPath(ctx context.Context, watch *watchState, path string, info fs.FileInfo) ([]string, bool) {
+	parent := filepath.Dir(path)
+	scanner.mu.RLock()
+	parentNode, hasParent := scanner.cache[parent]
+	existing, hasExisting := scanner.cache[path]
+	scanner.mu.RUnlock()
+	if !hasParent || !parentNode.Scanned || !isWithin(watch.root, path) || path == watch.root {
+		return nil, false
+	}
+	if !watch.req.ShowHidden && isHidden(info.Name()) {
+		return nil, false
+	}
+
+	isLink := info.Mode()&fs.ModeSymlink != 0
+	if hasExisting && (existing.Type == domain.NodeDir) == info.IsDir() && existing.LinkTarget == "" && !isLink {
+		scanner.mu.Lock()
+		defer scanner.mu.Unlock()
+		node, ok := scanner.cache[path]
+		if !ok {
+			return nil, false
+		}
+		previous := *node
+		fsinfo.Apply(node, info)
+		if node.Type == domain.NodeFile {
+			detachArchive(scanner.cache, node)
+			node.SizeBytes = fsinfo.Size(info, watch.req.SizeMode)
+			if !(previous.Shared && previous.AccumBytes == 0) {
+				node.AccumBytes = node.SizeBytes
+			}
+			node.SharedBytes = 0
+			if node.Shared {
+				node.SharedBytes = node.AccumBytes
+			}
+			scanner.propagateLocked(node.ParentID, node, &previous)
+		}
+		scanner.stale[parent] = true
+		return nil, true
+	}
+	if hasExisting {
+		scanner.mu.Lock()
+		scanner.removeLocked(path)
+		scanner.mu.Unlock()
+	}
+
+	entry := fs.FileInfoToDirEntry(info)
+	nodes := map[string]*domain.Node{}
+	scannedDirs := []string{}
+	if rule, excluded := watch.ignores.match(path, info.IsDir()); excluded {
+		if !info.IsDir() {
+			return nil, hasExisting
+		}
+		node := skippedNode(watch.root, path, entry, watch.req, domain.SkipExcluded)
+		node.ExcludedBy = rule.String()
+		nodes[path] = node
+	} else if info.IsDir() {
+		nodes, scannedDirs = scanner.scanWatchedDir(ctx, watch, path, entry)
+	} else {
+		node := &domain.Node{
+			ID:        path,
+			Name:      info.Name(),
+			Path:      path,
+			Type:      domain.NodeFile,
+			SizeMode:  watch.req.SizeMode,
+			ParentID:  parent,
+			SizeBytes: fsinfo.Size(info, watch.req.SizeMode),
+			FileCount: 1,
+			Category:  fileCategory(path, info.Name(), info, watch.req.SniffTypes),
+		}
+		node.AccumBytes = node.SizeBytes
+		fsinfo.Apply(node, info)
+		if node.Shared {
+			node.SharedBytes = node.AccumBytes
+		}
+		if isLink {
+			node.Type = domain.NodeSymlink
+			node.Category = ""
+			node.LinkTarget, _ = os.Readlink(path)
+			_, statErr := os.Stat(path)
+			node.BrokenLink = statErr != nil
+		}
+		nodes[path] = node
+	}
+	if len(nodes) == 0 {
+		return nil, hasExisting
+	}
+
+	scanner.mu.Lock()
+	defer scanner.mu.Unlock()
+	parentNode, ok := scanner.cache[parent]
+	if !ok {
+		return nil, false
+	}
+	for key, node := range nodes {
+		scanner.cache[key] = node
+		if node.Type == domain.NodeDir && node.Scanned {
+			scanner.scannedDirs[key] = true
+		}
+	}
+	root := nodes[path]
+	root.ParentID = parent
+	if !containsID(parentNode.ChildrenIDs, path) {
+		parentNode.ChildrenIDs = append(parentNode.ChildrenIDs, path)
+		if root.Type == domain.NodeDir {
+			parentNode.ChildCount++
+		}
+	}
+	scanner.propagateLocked(parent, root, nil)
+	scanner.stale[parent] = true
+	return scannedDirs, true
+}
+
+// scanWatchedDir scans a directory that appeared while watching, applying the
+// same mount, depth and exclusion rules as the original scan.
+func (scanner *FSScanner) scanWatchedDir(ctx context.Context, watch *watchState, path string, entry fs.DirEntry) (map[string]*domain.Node, []string) {
+	if watch.req.OneFileSystem && watch.hasRootDevice {
+		if device, ok := deviceOf(path); ok && device != watch.rootDevice {
+			node := skippedNode(watch.root, path, entry, watch.req, domain.SkipMount)
+			node.FSType = fsinfo.FSType(path)
+			return map[string]*domain.Node{path: node}, nil
+		}
+	}
+	req := watch.req
+	if req.MaxDepth > 0 {
+		remaining := req.MaxDepth - depthFrom(watch.root, path)
+		if remaining <= 0 {
+			return map[string]*domain.Node{path: skippedNode(watch.root, path, entry, watch.req, domain.SkipDepth)}, nil
+		}
+		req.MaxDepth = remaining
+	}
+	req.RootPath = path
+
+	walk := newScanWalk(ctx, scanner, req, path, nil)
+	walk.ignores = watch.ignores
+	walk.rootDevice = watch.rootDevice
+	walk.hasRootDevice = watch.hasRootDevice
+	if err := walk.run(scanConcurrency(req.Concurrency)); err != nil {
+		return nil, nil
+	}
+	nodes := walk.nodes
+	root := nodes[path]
+	root.Name = entry.Name()
+	if info, err := entry.Info(); err == nil {
+		fsinfo.Apply(root, info)
+	}
+	applyHierarchy(nodes)
+	applyHardlinks(nodes)
+	applyAccumulation(nodes)
+	applyFileCounts(nodes)
+	applyDirCounts(nodes)
+	applyUsage(nodes)
+	applyAges(nodes, time.Now())
+	applyIncomplete(nodes)
+	scanner.setErrors(path, walk.scanErrors())
+
+	dirs := []string{}
+	for key, node := range nodes {
+		if node.Type == domain.NodeDir && node.Scanned {
+			dirs = append(dirs, key)
+		}
+	}
+	return nodes, dirs
+}
+
+// removeLocked drops path and everything below it from the cached tree and
+// subtracts its totals from the ancestors.
+func (scanner *FSScanner) removeLocked(path string) bool {
+	node, ok := scanner.cache[path]
+	if !ok || path == scanner.root {
+		return false
+	}
+	removed := *node
+	for key := range scanner.cache {
+		if isWithin(path, key) {
+			delete(scanner.cache, key)
+			delete(scanner.scannedDirs, key)
+		}
+	}
+	for key := range scanner.scanErrors {
+		if isWithin(path, key) {
+			delete(scanner.scanErrors, key)
+		}
+	}
+	if parent, ok := scanner.cache[removed.ParentID]; ok {
+		children := parent.ChildrenIDs[:0]
+		for _, id := range parent.ChildrenIDs {
+			if id != path {
+				children = append(children, id)
+			}
+		}
+		parent.ChildrenIDs = children
+		if removed.Type == domain.NodeDir {
+			parent.ChildCount--
+		}
+	}
+	scanner.propagateLocked(removed.ParentID, nil, &removed)
+	scanner.stale[filepath.Dir(path)] = true
+	return true
+}
@@ -0,0 +1,161 @@
+//go:build linux
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const watchMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MODIFY | unix.IN_CLOSE_WRITE |
+	unix.IN_ATTRIB | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE_SELF |
+	unix.IN_ONLYDIR | unix.IN_DONT_FOLLOW | unix.IN_EXCL_UNLINK
+
+const (
+	watchQuiet    = 150 * time.Millisecond
+	watchMaxDelay = time.Second
+)
+
+type inotifyWatch struct {
+	fd       int
+	paths    map[int]string
+	limitHit bool
+	overflow bool
+}
+
+// Watch registers inotify watches on every scanned directory below the scan
+// root and applies changes to the cached tree until ctx is cancelled. Each
+// applied batch is announced on Updates.
+func (scanner *FSScanner) Watch(ctx context.Context, req ScanRequest) error {
+	state := newWatchState(req)
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return err
+	}
+	watch := &inotifyWatch{fd: fd, paths: make(map[int]string)}
+	for _, dir := range scanner.watchedDirs(state.root) {
+		_, _ = state.ignores.load(dir)
+		if err := watch.add(dir); errors.Is(err, unix.ENOSPC) {
+			break
+		}
+	}
+	if len(watch.paths) == 0 {
+		unix.Close(fd)
+		return fmt.Errorf("no directories to watch under %s", state.root)
+	}
+	if watch.limitHit {
+		scanner.publish(TreeUpdate{Root: state.root, ErrMessage: fmt.Sprintf("watch limit reached; watching %d directories", len(watch.paths))})
+	}
+	go scanner.watchLoop(ctx, state, watch)
+	return nil
+}
+
+func (watch *inotifyWatch) add(dir string) error {
+	wd, err := unix.InotifyAddWatch(watch.fd, dir, watchMask)
+	if err != nil {
+		if errors.Is(err, unix.ENOSPC) {
+			watch.limitHit = true
+		}
+		return err
+	}
+	watch.paths[wd] = dir
+	return nil
+}
+
+func (scanner *FSScanner) watchLoop(ctx context.Context, state *watchState, watch *inotifyWatch) {
+	defer unix.Close(watch.fd)
+	buffer := make([]byte, 64*1024)
+	pollFds := []unix.PollFd{{Fd: int32(watch.fd), Events: unix.POLLIN}}
+	var pending []watchEvent
+	var first time.Time
+	for {
+		ready, err := unix.Poll(pollFds, int(watchQuiet/time.Millisecond))
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil && !errors.Is(err, unix.EINTR) {
+			scanner.publish(TreeUpdate{Root: state.root, ErrMessage: fmt.Sprintf("watch stopped: %v", err)})
+			return
+		}
+		if ready > 0 {
+			events, err := watch.read(buffer)
+			if err != nil {
+				scanner.publish(TreeUpdate{Root: state.root, ErrMessage: fmt.Sprintf("watch stopped: %v", err)})
+				return
+			}
+			if len(pending) == 0 && len(events) > 0 {
+				first = time.Now()
+			}
+			pending = append(pending, events...)
+		}
+		if watch.overflow {
+			watch.overflow = false
+			pending = nil
+			scanner.publish(TreeUpdate{Root: state.root, ErrMessage: "watch queue overflowed - press r to refresh"})
+			continue
+		}
+		if len(pending) == 0 || (ready > 0 && time.Since(first) < watchMaxDelay) {
+			continue
+		}
+		changed, newDirs := scanner.applyWatchEvents(ctx, state, pending)
+		pending = nil
+		for _, dir := range newDirs {
+			_, _ = state.ignores.load(dir)
+			if !watch.limitHit {
+				_ = watch.add(dir)
+			}
+		}
+		if len(changed) > 0 {
+			scanner.publish(TreeUpdate{Root: state.root, Paths: changed})
+		}
+	}
+}
+
+func (watch *inotifyWatch) read(buffer []byte) ([]watchEvent, error) {
+	events := []watchEvent{}
+	for {
+		count, err := unix.Read(watch.fd, buffer)
+		if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+			return events, nil
+		}
+		if err != nil {
+			return events, err
+		}
+		if count <= 0 {
+			return events, nil
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= count; {
+			raw := (*unix.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			nameEnd := nameStart + int(raw.Len)
+			offset = nameEnd
+			if nameEnd > count {
+				break
+			}
+			if raw.Mask&unix.IN_Q_OVERFLOW != 0 {
+				watch.overflow = true
+				continue
+			}
+			dir, ok := watch.paths[int(raw.Wd)]
+			if raw.Mask&unix.IN_IGNORED != 0 {
+				delete(watch.paths, int(raw.Wd))
+				continue
+			}
+			name := string(bytes.TrimRight(buffer[nameStart:nameEnd], "\x00"))
+			if !ok || name == "" {
+				continue
+			}
+			events = append(events, watchEvent{
+				path:    filepath.Join(dir, name),
+				removed: raw.Mask&(unix.IN_DELETE|unix.IN_MOVED_FROM) != 0,
+			})
+		}
+	}
+}
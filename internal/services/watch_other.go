@@ -0,0 +1,9 @@
+//go:build !linux
+
+package services
+
+import "context"
+
+func (scanner *FSScanner) Watch(ctx context.Context, req ScanRequest) error {
+	return ErrWatchUnsupported
+}
@@ -1,6 +1,8 @@
 package state
 
 import (
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
@@ -9,15 +11,36 @@ import (
 
 	"sweepfs/internal/config"
 	"sweepfs/internal/domain"
+	"sweepfs/internal/fsinfo"
 )
 
 type Preferences struct {
-	ShowHidden bool
-	SafeMode   bool
-	SortMode   domain.SortMode
-	Theme      string
+	ShowHidden     bool
+	SafeMode       bool
+	SortMode       domain.SortMode
+	SizeMode       domain.SizeMode
+	OneFileSystem  bool
+	FollowSymlinks bool
+	MaxDepth       int
+	Concurrency    int
+	Watch          bool
+	SniffTypes     bool
+	IndexArchives  bool
+	Theme          string
 }
 
+// FlatMode picks what the flat view lists instead of the tree.
+type FlatMode string
+
+const (
+	FlatOff   FlatMode = ""
+	FlatFiles FlatMode = "files"
+	FlatDirs  FlatMode = "dirs"
+)
+
+// FlatLimit caps how many of the largest nodes the flat view lists.
+const FlatLimit = 500
+
 type State struct {
 	Path            string
 	Current         string
@@ -30,7 +53,37 @@ type State struct {
 	KeyBindings     map[string]string
 	SearchQuery     string
 	FilterExt       string
+	FilterType      domain.FileCategory
+	MinAgeDays      int
+	FilterOwner     *uint32
 	MinSizeBytes    int64
+	Exclusions      []string
+	CleanupRules    []domain.CleanupRule
+	Growth          *domain.TreeDiff
+	ImportedFrom    string
+	Flat            FlatMode
+	treeCursor      int
+	flat            *flatList
+}
+
+// flatList remembers the last flat listing and the settings it was built
+// with, since the whole tree has to be ranked to build it.
+type flatList struct {
+	key   flatKey
+	nodes []VisibleNode
+}
+
+type flatKey struct {
+	mode       FlatMode
+	showHidden bool
+	search     string
+	ext        string
+	category   domain.FileCategory
+	minAge     int
+	minSize    int64
+	ownerSet   bool
+	owner      uint32
+	byCount    bool
 }
 
 func NewState(cfg config.Config) *State {
@@ -41,10 +94,18 @@ func NewState(cfg config.Config) *State {
 		Selected: make(map[string]bool),
 		Expanded: make(map[string]bool),
 		Prefs: Preferences{
-			ShowHidden: cfg.ShowHidden,
-			SafeMode:   cfg.SafeMode,
-			SortMode:   cfg.SortMode,
-			Theme:      cfg.Theme,
+			ShowHidden:     cfg.ShowHidden,
+			SafeMode:       cfg.SafeMode,
+			SortMode:       cfg.SortMode,
+			SizeMode:       cfg.SizeMode,
+			OneFileSystem:  cfg.OneFileSystem,
+			FollowSymlinks: cfg.FollowSymlinks,
+			MaxDepth:       cfg.MaxDepth,
+			Concurrency:    cfg.Concurrency,
+			Watch:          cfg.Watch,
+			SniffTypes:     cfg.SniffTypes,
+			IndexArchives:  cfg.IndexArchives,
+			Theme:          cfg.Theme,
 		},
 		Tree: domain.TreeIndex{
 			Nodes: make(map[string]*domain.Node),
@@ -54,6 +115,8 @@ func NewState(cfg config.Config) *State {
 		SearchQuery:     "",
 		FilterExt:       "",
 		MinSizeBytes:    0,
+		Exclusions:      append([]string{}, cfg.Exclusions...),
+		CleanupRules:    cfg.CleanupRules,
 	}
 }
 
@@ -66,6 +129,7 @@ func ensureBindings(bindings map[string]string) map[string]string {
 
 func (appState *State) SetTree(tree domain.TreeIndex) {
 	appState.Tree = tree
+	appState.flat = nil
 	if appState.Current == "" {
 		appState.Current = tree.RootID
 	}
@@ -106,13 +170,38 @@ func (appState *State) SetCurrent(id string) bool {
 	return true
 }
 
+// Reveal opens the folder holding id and moves the cursor onto it, leaving
+// the flat view.
+func (appState *State) Reveal(id string) bool {
+	node, ok := appState.Tree.Nodes[id]
+	if !ok {
+		return false
+	}
+	appState.Flat = FlatOff
+	if node.ParentID == "" || !appState.SetCurrent(node.ParentID) {
+		return appState.SetCurrent(id)
+	}
+	for index, item := range appState.VisibleNodes() {
+		if item.Node.ID == id {
+			appState.Cursor = index
+			break
+		}
+	}
+	return true
+}
+
 func (appState *State) LoadListing(path string) error {
+	if appState.ImportedFrom != "" {
+		return appState.openImported(path)
+	}
 	appState.Path = path
 	appState.Current = ""
 	appState.Cursor = 0
 	appState.Selected = make(map[string]bool)
 	appState.Expanded = make(map[string]bool)
 	appState.Tree = domain.TreeIndex{Nodes: make(map[string]*domain.Node)}
+	appState.flat = nil
+	appState.Flat = FlatOff
 
 	if path == "" {
 		return nil
@@ -124,11 +213,12 @@ func (appState *State) LoadListing(path string) error {
 	}
 
 	root := &domain.Node{
-		ID:      path,
-		Name:    filepath.Base(path),
-		Path:    path,
-		Type:    domain.NodeDir,
-		Scanned: true,
+		ID:       path,
+		Name:     filepath.Base(path),
+		Path:     path,
+		Type:     domain.NodeDir,
+		SizeMode: appState.Prefs.SizeMode,
+		Scanned:  true,
 	}
 	if root.Name == "." || root.Name == string(filepath.Separator) {
 		root.Name = path
@@ -149,6 +239,7 @@ func (appState *State) LoadListing(path string) error {
 			Name:     name,
 			Path:     filepath.Join(path, name),
 			ParentID: root.ID,
+			SizeMode: appState.Prefs.SizeMode,
 			ModTime:  time.Time{},
 		}
 		if infoErr != nil {
@@ -164,11 +255,23 @@ func (appState *State) LoadListing(path string) error {
 			child.DirCount = 0
 		} else {
 			child.Type = domain.NodeFile
-			child.SizeBytes = info.Size()
-			child.AccumBytes = info.Size()
+			child.SizeBytes = fsinfo.Size(info, appState.Prefs.SizeMode)
+			child.AccumBytes = child.SizeBytes
 			child.ModTime = info.ModTime()
 			child.FileCount = 1
 		}
+		if infoErr == nil && info.Mode()&fs.ModeSymlink != 0 {
+			child.Type = domain.NodeSymlink
+			child.LinkTarget, _ = os.Readlink(child.Path)
+			_, statErr := os.Stat(child.Path)
+			child.BrokenLink = statErr != nil
+		}
+		if infoErr == nil {
+			fsinfo.Apply(child, info)
+		}
+		if child.Type == domain.NodeFile {
+			child.Category = domain.CategoryOf(name)
+		}
 		root.ChildrenIDs = append(root.ChildrenIDs, child.ID)
 		if child.Type == domain.NodeDir {
 			root.ChildCount++
@@ -182,12 +285,24 @@ func (appState *State) LoadListing(path string) error {
 	return nil
 }
 
+// openImported moves within an imported tree, which cannot be listed from
+// the local filesystem.
+func (appState *State) openImported(path string) error {
+	if !appState.SetCurrent(path) {
+		return fmt.Errorf("%s is outside the imported tree", path)
+	}
+	return nil
+}
+
 type VisibleNode struct {
 	Node  *domain.Node
 	Depth int
 }
 
 func (appState *State) VisibleNodes() []VisibleNode {
+	if appState.Flat != FlatOff {
+		return appState.flatNodes()
+	}
 	rootID := appState.Current
 	if rootID == "" {
 		rootID = appState.Tree.RootID
@@ -201,6 +316,95 @@ func (appState *State) VisibleNodes() []VisibleNode {
 	return visible
 }
 
+// ToggleFlat cycles between the tree, the largest files and the largest
+// folders. The tree cursor is kept while the flat view is open.
+func (appState *State) ToggleFlat() FlatMode {
+	switch appState.Flat {
+	case FlatOff:
+		appState.treeCursor = appState.Cursor
+		appState.Flat = FlatFiles
+	case FlatFiles:
+		appState.Flat = FlatDirs
+	default:
+		appState.Flat = FlatOff
+		appState.Cursor = appState.treeCursor
+		return appState.Flat
+	}
+	appState.Cursor = 0
+	return appState.Flat
+}
+
+func (appState *State) ExitFlat() {
+	if appState.Flat == FlatOff {
+		return
+	}
+	appState.Flat = FlatOff
+	appState.Cursor = appState.treeCursor
+}
+
+// flatNodes lists the largest files or folders of the whole tree that pass
+// the filters, largest first.
+func (appState *State) flatNodes() []VisibleNode {
+	key := flatKey{
+		mode:       appState.Flat,
+		showHidden: appState.Prefs.ShowHidden,
+		search:     appState.SearchQuery,
+		ext:        appState.FilterExt,
+		category:   appState.FilterType,
+		minAge:     appState.MinAgeDays,
+		minSize:    appState.MinSizeBytes,
+		byCount:    appState.Prefs.SortMode == domain.SortByCount,
+	}
+	if appState.FilterOwner != nil {
+		key.ownerSet = true
+		key.owner = *appState.FilterOwner
+	}
+	if appState.flat != nil && appState.flat.key == key {
+		return appState.flat.nodes
+	}
+	wantType := domain.NodeFile
+	if appState.Flat == FlatDirs {
+		wantType = domain.NodeDir
+	}
+	matches := make([]*domain.Node, 0)
+	for id, node := range appState.Tree.Nodes {
+		if id == appState.Tree.RootID || node.Type != wantType || node.Archive != "" || !appState.nodeMatches(node) {
+			continue
+		}
+		if !appState.Prefs.ShowHidden && appState.hiddenBelowRoot(node) {
+			continue
+		}
+		matches = append(matches, node)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if key.byCount && EntryCount(matches[i]) != EntryCount(matches[j]) {
+			return EntryCount(matches[i]) > EntryCount(matches[j])
+		}
+		if sizeFor(matches[i]) != sizeFor(matches[j]) {
+			return sizeFor(matches[i]) > sizeFor(matches[j])
+		}
+		return matches[i].Path < matches[j].Path
+	})
+	if len(matches) > FlatLimit {
+		matches = matches[:FlatLimit]
+	}
+	nodes := make([]VisibleNode, 0, len(matches))
+	for _, node := range matches {
+		nodes = append(nodes, VisibleNode{Node: node})
+	}
+	appState.flat = &flatList{key: key, nodes: nodes}
+	return nodes
+}
+
+func (appState *State) hiddenBelowRoot(node *domain.Node) bool {
+	for current := node; current != nil && current.ID != appState.Tree.RootID; current = appState.Tree.Nodes[current.ParentID] {
+		if isHiddenName(current.Name) {
+			return true
+		}
+	}
+	return false
+}
+
 func (appState *State) CurrentNode() *domain.Node {
 	visible := appState.VisibleNodes()
 	if len(visible) == 0 || appState.Cursor < 0 || appState.Cursor >= len(visible) {
@@ -209,8 +413,14 @@ func (appState *State) CurrentNode() *domain.Node {
 	return visible[appState.Cursor].Node
 }
 
+// CurrentPath is the folder on disk being browsed. Inside an archive it is
+// the folder holding the archive.
 func (appState *State) CurrentPath() string {
-	if node, ok := appState.Tree.Nodes[appState.Current]; ok {
+	node, ok := appState.Tree.Nodes[appState.Current]
+	for ok && (node.Type != domain.NodeDir || node.Archive != "") {
+		node, ok = appState.Tree.Nodes[node.ParentID]
+	}
+	if ok {
 		return node.Path
 	}
 	return appState.Path
@@ -218,7 +428,7 @@ func (appState *State) CurrentPath() string {
 
 func (appState *State) EnterDir(id string) bool {
 	node, ok := appState.Tree.Nodes[id]
-	if !ok || node.Type != domain.NodeDir || !node.Scanned {
+	if !ok || !Browsable(node) || (node.Type == domain.NodeDir && !node.Scanned) {
 		return false
 	}
 	appState.Current = id
@@ -269,19 +479,70 @@ func (appState *State) ToggleSortMode() domain.SortMode {
 		appState.Prefs.SortMode = domain.SortByName
 	case domain.SortByName:
 		appState.Prefs.SortMode = domain.SortByMod
+	case domain.SortByMod:
+		appState.Prefs.SortMode = domain.SortByCount
+	case domain.SortByCount:
+		appState.Prefs.SortMode = domain.SortBySize
+		if appState.Growth != nil {
+			appState.Prefs.SortMode = domain.SortByGrowth
+		}
 	default:
 		appState.Prefs.SortMode = domain.SortBySize
 	}
 	return appState.Prefs.SortMode
 }
 
+// CycleTypeFilter steps the type filter through the categories found in the
+// current folder, largest first, and then turns it off.
+func (appState *State) CycleTypeFilter() domain.FileCategory {
+	var ranked []domain.FileCategory
+	if node, ok := appState.Tree.Nodes[appState.Current]; ok {
+		ranked = domain.RankCategories(node.Categories)
+	}
+	next := domain.FileCategory("")
+	if appState.FilterType == "" && len(ranked) > 0 {
+		next = ranked[0]
+	}
+	for index, category := range ranked {
+		if category == appState.FilterType && index+1 < len(ranked) {
+			next = ranked[index+1]
+		}
+	}
+	appState.FilterType = next
+	return next
+}
+
+func (appState *State) ToggleSizeMode() domain.SizeMode {
+	if appState.Prefs.SizeMode == domain.SizeDisk {
+		appState.Prefs.SizeMode = domain.SizeApparent
+	} else {
+		appState.Prefs.SizeMode = domain.SizeDisk
+	}
+	return appState.Prefs.SizeMode
+}
+
+// SetBaseline sets the diff used by the growth sort, or clears it.
+func (appState *State) SetBaseline(diff *domain.TreeDiff) {
+	appState.Growth = diff
+	if diff != nil {
+		appState.Prefs.SortMode = domain.SortByGrowth
+	} else if appState.Prefs.SortMode == domain.SortByGrowth {
+		appState.Prefs.SortMode = domain.SortBySize
+	}
+}
+
+func (appState *State) ToggleWatch() bool {
+	appState.Prefs.Watch = !appState.Prefs.Watch
+	return appState.Prefs.Watch
+}
+
 func (appState *State) ToggleShowHidden() bool {
 	appState.Prefs.ShowHidden = !appState.Prefs.ShowHidden
 	return appState.Prefs.ShowHidden
 }
 
 func (appState *State) EnsureShallowCounts(node *domain.Node) {
-	if node == nil || node.Type != domain.NodeDir || node.Scanned {
+	if node == nil || node.Type != domain.NodeDir || node.Scanned || appState.ImportedFrom != "" {
 		return
 	}
 	if node.ChildCount > 0 || node.FileCount > 0 {
@@ -315,10 +576,10 @@ func (appState *State) appendNode(visible *[]VisibleNode, node *domain.Node, dep
 	if !appState.Prefs.ShowHidden && isHiddenName(node.Name) && node.ID != appState.Tree.RootID {
 		return
 	}
-	filtering := appState.SearchQuery != "" || appState.FilterExt != "" || appState.MinSizeBytes > 0
+	filtering := appState.SearchQuery != "" || appState.FilterExt != "" || appState.FilterType != "" || appState.MinAgeDays > 0 || appState.FilterOwner != nil || appState.MinSizeBytes > 0
 	if !filtering {
 		*visible = append(*visible, VisibleNode{Node: node, Depth: depth})
-		if node.Type != domain.NodeDir || !appState.IsExpanded(node.ID) {
+		if !Browsable(node) || !appState.IsExpanded(node.ID) {
 			return
 		}
 		children := appState.sortedChildren(node)
@@ -374,6 +635,20 @@ func (appState *State) sortedChildren(node *domain.Node) []*domain.Node {
 			return children[i].Name < children[j].Name
 		case domain.SortByMod:
 			return children[i].ModTime.After(children[j].ModTime)
+		case domain.SortByCount:
+			if EntryCount(children[i]) != EntryCount(children[j]) {
+				return EntryCount(children[i]) > EntryCount(children[j])
+			}
+			return sizeFor(children[i]) > sizeFor(children[j])
+		case domain.SortByGrowth:
+			if appState.Growth != nil {
+				left := appState.Growth.Change(children[i].Path).Delta()
+				right := appState.Growth.Change(children[j].Path).Delta()
+				if left != right {
+					return left > right
+				}
+			}
+			return sizeFor(children[i]) > sizeFor(children[j])
 		default:
 			return sizeFor(children[i]) > sizeFor(children[j])
 		}
@@ -410,18 +685,63 @@ func (appState *State) nodeMatches(node *domain.Node) bool {
 			return false
 		}
 	}
+	if appState.FilterType != "" {
+		if node.Type != domain.NodeFile || node.Category != appState.FilterType {
+			return false
+		}
+	}
 	if appState.MinSizeBytes > 0 {
 		if sizeFor(node) < appState.MinSizeBytes {
 			return false
 		}
 	}
+	if appState.FilterOwner != nil {
+		if node.Type != domain.NodeFile || node.UID != *appState.FilterOwner {
+			return false
+		}
+	}
+	if appState.MinAgeDays > 0 {
+		modTime := NewestMod(node)
+		if modTime.IsZero() || modTime.After(time.Now().AddDate(0, 0, -appState.MinAgeDays)) {
+			return false
+		}
+	}
 	return true
 }
 
+// Browsable reports whether a node has children to list: a folder, or an
+// archive whose members were indexed.
+func Browsable(node *domain.Node) bool {
+	return node.Type == domain.NodeDir || len(node.ChildrenIDs) > 0
+}
+
+// EntryCount is the number of files and folders below a folder, the inodes
+// it holds, or 1 for a file.
+func EntryCount(node *domain.Node) int {
+	if node.Type == domain.NodeDir {
+		return node.FileCount + node.DirCount
+	}
+	return 1
+}
+
+// NewestMod is the mtime of a file or the newest mtime below a folder.
+func NewestMod(node *domain.Node) time.Time {
+	if node.Type == domain.NodeDir && !node.NewestMod.IsZero() {
+		return node.NewestMod
+	}
+	return node.ModTime
+}
+
 func (appState *State) dirHasMatch(node *domain.Node) bool {
 	if node == nil || node.Type != domain.NodeDir {
 		return false
 	}
+	if appState.FilterType != "" && node.Scanned && node.Categories[appState.FilterType].Files == 0 {
+		return false
+	}
+	if appState.FilterOwner != nil && node.Scanned && node.Owners[*appState.FilterOwner].Files == 0 {
+		return false
+	}
 	children := appState.sortedChildren(node)
 	for _, child := range children {
 		if appState.nodeMatches(child) {
@@ -437,6 +757,9 @@ func (appState *State) dirHasMatch(node *domain.Node) bool {
 func (appState *State) ClearFilters() {
 	appState.SearchQuery = ""
 	appState.FilterExt = ""
+	appState.FilterType = ""
+	appState.MinAgeDays = 0
+	appState.FilterOwner = nil
 	appState.MinSizeBytes = 0
 }
 
@@ -450,6 +773,37 @@ func (appState *State) ToggleSelection(id string) {
 	}
 }
 
+// SelectVisible selects every visible node below the current folder, or in
+// the flat view, that matches the filters. Nodes inside a folder that ends
+// up selected are left out so the same bytes are not acted on twice. It
+// returns how many nodes were added.
+func (appState *State) SelectVisible() int {
+	added := 0
+	for _, item := range appState.VisibleNodes() {
+		node := item.Node
+		if (appState.Flat == FlatOff && item.Depth == 0) || appState.Selected[node.ID] || !appState.nodeMatches(node) || appState.ancestorSelected(node) {
+			continue
+		}
+		appState.Selected[node.ID] = true
+		added++
+	}
+	return added
+}
+
+func (appState *State) ancestorSelected(node *domain.Node) bool {
+	for id := node.ParentID; id != ""; {
+		if appState.Selected[id] {
+			return true
+		}
+		parent, ok := appState.Tree.Nodes[id]
+		if !ok {
+			return false
+		}
+		id = parent.ParentID
+	}
+	return false
+}
+
 func (appState *State) SelectedPaths() []string {
 	paths := make([]string, 0, len(appState.Selected))
 	for id := range appState.Selected {
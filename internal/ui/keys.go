@@ -3,30 +3,50 @@ package ui
 import "github.com/charmbracelet/bubbles/key"
 
 type KeyMap struct {
-	Up      key.Binding
-	Down    key.Binding
-	Enter   key.Binding
-	Right   key.Binding
-	Back    key.Binding
-	Left    key.Binding
-	Select  key.Binding
-	Delete  key.Binding
-	Move    key.Binding
-	Copy    key.Binding
-	Backup  key.Binding
-	Refresh key.Binding
-	Scan    key.Binding
-	Sort    key.Binding
-	Hidden  key.Binding
-	Paste   key.Binding
-	Search  key.Binding
-	ExtFilter key.Binding
-	SizeFilter key.Binding
+	Up          key.Binding
+	Down        key.Binding
+	Enter       key.Binding
+	Right       key.Binding
+	Back        key.Binding
+	Left        key.Binding
+	Select      key.Binding
+	Delete      key.Binding
+	Move        key.Binding
+	Copy        key.Binding
+	Backup      key.Binding
+	Refresh     key.Binding
+	Scan        key.Binding
+	Sort        key.Binding
+	Hidden      key.Binding
+	SizeMode    key.Binding
+	Exclusions  key.Binding
+	DepthLimit  key.Binding
+	Watch       key.Binding
+	Growth      key.Binding
+	Export      key.Binding
+	Errors      key.Binding
+	Duplicates  key.Binding
+	KeepOne     key.Binding
+	Dedupe      key.Binding
+	Paste       key.Binding
+	Search      key.Binding
+	ExtFilter   key.Binding
+	TypeFilter  key.Binding
+	AgeFilter   key.Binding
+	SelectAll   key.Binding
+	Flat        key.Binding
+	Owners      key.Binding
+	Cleanup     key.Binding
+	Mounts      key.Binding
+	Archive     key.Binding
+	OwnerFilter key.Binding
+	SizeFilter  key.Binding
 	ClearFilter key.Binding
-	Confirm key.Binding
-	Cancel  key.Binding
-	Help    key.Binding
-	Quit    key.Binding
+	Confirm     key.Binding
+	Override    key.Binding
+	Cancel      key.Binding
+	Help        key.Binding
+	Quit        key.Binding
 }
 
 func DefaultKeyMap() KeyMap {
@@ -91,6 +111,46 @@ func DefaultKeyMap() KeyMap {
 			key.WithKeys("h"),
 			key.WithHelp("h", "hidden"),
 		),
+		SizeMode: key.NewBinding(
+			key.WithKeys("u"),
+			key.WithHelp("u", "size mode"),
+		),
+		Exclusions: key.NewBinding(
+			key.WithKeys("i"),
+			key.WithHelp("i", "exclusions"),
+		),
+		DepthLimit: key.NewBinding(
+			key.WithKeys("L"),
+			key.WithHelp("L", "depth limit"),
+		),
+		Watch: key.NewBinding(
+			key.WithKeys("w"),
+			key.WithHelp("w", "watch changes"),
+		),
+		Growth: key.NewBinding(
+			key.WithKeys("g"),
+			key.WithHelp("g", "growth baseline"),
+		),
+		Export: key.NewBinding(
+			key.WithKeys("X"),
+			key.WithHelp("X", "export ncdu json"),
+		),
+		Errors: key.NewBinding(
+			key.WithKeys("E"),
+			key.WithHelp("E", "scan errors"),
+		),
+		Duplicates: key.NewBinding(
+			key.WithKeys("D"),
+			key.WithHelp("D", "find duplicates"),
+		),
+		KeepOne: key.NewBinding(
+			key.WithKeys("K"),
+			key.WithHelp("K", "keep one, select the rest"),
+		),
+		Dedupe: key.NewBinding(
+			key.WithKeys("H"),
+			key.WithHelp("H", "link copies to the kept file"),
+		),
 		Paste: key.NewBinding(
 			key.WithKeys("p"),
 			key.WithHelp("p", "paste"),
@@ -103,6 +163,42 @@ func DefaultKeyMap() KeyMap {
 			key.WithKeys("e"),
 			key.WithHelp("e", "ext"),
 		),
+		TypeFilter: key.NewBinding(
+			key.WithKeys("t"),
+			key.WithHelp("t", "cycle type filter"),
+		),
+		AgeFilter: key.NewBinding(
+			key.WithKeys("a"),
+			key.WithHelp("a", "not modified in N days"),
+		),
+		SelectAll: key.NewBinding(
+			key.WithKeys("*"),
+			key.WithHelp("*", "select visible matches"),
+		),
+		Flat: key.NewBinding(
+			key.WithKeys("F"),
+			key.WithHelp("F", "largest files/folders"),
+		),
+		Owners: key.NewBinding(
+			key.WithKeys("O"),
+			key.WithHelp("O", "usage by owner"),
+		),
+		Cleanup: key.NewBinding(
+			key.WithKeys("C"),
+			key.WithHelp("C", "cleanup candidates"),
+		),
+		Mounts: key.NewBinding(
+			key.WithKeys("M"),
+			key.WithHelp("M", "filesystems"),
+		),
+		Archive: key.NewBinding(
+			key.WithKeys("v"),
+			key.WithHelp("v", "browse archive"),
+		),
+		OwnerFilter: key.NewBinding(
+			key.WithKeys("U"),
+			key.WithHelp("U", "owner filter"),
+		),
 		SizeFilter: key.NewBinding(
 			key.WithKeys("z"),
 			key.WithHelp("z", "min size"),
@@ -115,6 +211,10 @@ func DefaultKeyMap() KeyMap {
 			key.WithKeys("y"),
 			key.WithHelp("y", "confirm"),
 		),
+		Override: key.NewBinding(
+			key.WithKeys("!"),
+			key.WithHelp("!", "override git safety"),
+		),
 		Cancel: key.NewBinding(
 			key.WithKeys("n", "esc"),
 			key.WithHelp("n/esc", "cancel"),
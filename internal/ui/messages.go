@@ -1,6 +1,12 @@
 package ui
 
-import "sweepfs/internal/services"
+import (
+	"context"
+
+	"sweepfs/internal/domain"
+	"sweepfs/internal/fsinfo"
+	"sweepfs/internal/services"
+)
 
 type scanResultMsg struct {
 	result services.ScanResult
@@ -11,6 +17,38 @@ type scanProgressMsg struct {
 	progress services.ScanProgress
 }
 
+type watchStartedMsg struct {
+	ctx context.Context
+	err error
+}
+
+type treeUpdateMsg struct {
+	ctx    context.Context
+	update services.TreeUpdate
+}
+
+type baselineMsg struct {
+	index int
+	total int
+	diff  *domain.TreeDiff
+	err   error
+}
+
+type duplicatesMsg struct {
+	ctx    context.Context
+	groups []services.DuplicateGroup
+	err    error
+}
+
+type duplicateProgressMsg struct {
+	progress services.DuplicateProgress
+}
+
+type exportResultMsg struct {
+	path string
+	err  error
+}
+
 type actionResultMsg struct {
 	result services.ActionResult
 	err    error
@@ -21,6 +59,34 @@ type actionPreviewMsg struct {
 	err     error
 }
 
+type archiveIndexedMsg struct {
+	path  string
+	count int
+	err   error
+}
+
+type gitStatusMsg struct {
+	path   string
+	status services.GitStatus
+	err    error
+}
+
+type mountsMsg struct {
+	mounts []fsinfo.Mount
+	err    error
+}
+
+type diskUsageMsg struct {
+	path  string
+	usage fsinfo.DiskUsage
+	known bool
+}
+
+type cleanupMsg struct {
+	report services.CleanupReport
+	rules  int
+}
+
 type actionProgressMsg struct {
 	progress services.ActionProgress
 }
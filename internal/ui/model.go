@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -15,40 +16,66 @@ import (
 
 	"sweepfs/internal/config"
 	"sweepfs/internal/domain"
+	"sweepfs/internal/fsinfo"
 	"sweepfs/internal/services"
 	"sweepfs/internal/state"
 )
 
 type Model struct {
-	state                *state.State
-	scanner              services.Scanner
-	actions              services.Actions
-	progress             services.ProgressProvider
-	snapshot             services.SnapshotProvider
-	invalid              services.Invalidator
-	previewer            services.ActionPreviewer
-	actionProgress       services.ActionProgressProvider
-	keys                 KeyMap
-	showHelp             bool
-	status               string
-	scanning             bool
-	request              string
-	pending              string
-	scanCtx              context.Context
-	cancel               context.CancelFunc
-	width                int
-	height               int
-	viewTop              int
-	progressCount        int64
-	confirming           bool
-	confirmStep          int
-	pendingAction        services.ActionType
-	pendingPreview       services.ActionPreview
-	pendingDestination   string
-	pendingFocus         string
-	awaitingDestination  bool
-	capturingDestination bool
-	destinationInput     string
+	state                 *state.State
+	scanner               services.Scanner
+	actions               services.Actions
+	progress              services.ProgressProvider
+	snapshot              services.SnapshotProvider
+	invalid               services.Invalidator
+	watcher               services.Watcher
+	history               services.HistoryProvider
+	dupes                 services.DuplicateFinder
+	archives              services.ArchiveIndexer
+	previewer             services.ActionPreviewer
+	actionProgress        services.ActionProgressProvider
+	keys                  KeyMap
+	showHelp              bool
+	listView              string
+	listCursor            int
+	scanErrors            []services.ScanError
+	dupeCancel            context.CancelFunc
+	dupeGroups            []services.DuplicateGroup
+	dupeRows              []dupeRow
+	ownerRows             []ownerRow
+	cleanup               services.CleanupReport
+	mounts                []fsinfo.Mount
+	mountsOnStart         bool
+	mountRoot             string
+	disk                  fsinfo.DiskUsage
+	diskKnown             bool
+	gitStatus             map[string]services.GitStatus
+	gitPending            string
+	status                string
+	scanning              bool
+	request               string
+	pending               string
+	scanCtx               context.Context
+	cancel                context.CancelFunc
+	watchCancel           context.CancelFunc
+	scanStarted           time.Time
+	treeScanned           time.Time
+	baselineIndex         int
+	width                 int
+	height                int
+	viewTop               int
+	progressCount         int64
+	confirming            bool
+	confirmStep           int
+	gitOverride           bool
+	pendingAction         services.ActionType
+	pendingPreview        services.ActionPreview
+	pendingDestination    string
+	pendingPaths          []string
+	pendingFocus          string
+	awaitingDestination   bool
+	capturingDestination  bool
+	destinationInput      string
 	completionSuggestions []string
 	backupBaseDestination string
 	awaitingBackupName    bool
@@ -56,8 +83,8 @@ type Model struct {
 	awaitingCompression   bool
 	filterInputMode       string
 	filterInputValue      string
-	actionRunning        bool
-	actionProgressCount  int
+	actionRunning         bool
+	actionProgressCount   int
 }
 
 type ConfigProvider interface {
@@ -66,16 +93,21 @@ type ConfigProvider interface {
 
 func NewModel(appState *state.State, scanner services.Scanner, actions services.Actions) Model {
 	ctx, cancel := context.WithCancel(context.Background())
-	return Model{
+	model := Model{
 		state:          appState,
 		scanner:        scanner,
 		actions:        actions,
 		progress:       progressProvider(scanner),
 		snapshot:       snapshotProvider(scanner),
 		invalid:        invalidator(scanner),
+		watcher:        watcherProvider(scanner),
+		history:        historyProvider(scanner),
+		dupes:          duplicateFinder(scanner),
+		archives:       archiveIndexer(scanner),
 		previewer:      actionPreviewer(actions),
 		actionProgress: actionProgressProvider(actions),
 		keys:           DefaultKeyMap(),
+		gitStatus:      make(map[string]services.GitStatus),
 		status:         "Ready - press s to scan",
 		scanning:       false,
 		request:        appState.Path,
@@ -84,6 +116,15 @@ func NewModel(appState *state.State, scanner services.Scanner, actions services.
 		width:          100,
 		height:         30,
 	}
+	return model
+}
+
+// WithMountOverview opens the list of mounted filesystems, the start screen
+// when no path was given.
+func (model Model) WithMountOverview() Model {
+	model.mountsOnStart = true
+	model.status = "Reading mounted filesystems..."
+	return model
 }
 
 func (model Model) WithStatus(message string) Model {
@@ -99,6 +140,16 @@ func (model Model) ConfigSnapshot() config.Config {
 		ShowHidden:      model.state.Prefs.ShowHidden,
 		SafeMode:        model.state.Prefs.SafeMode,
 		SortMode:        model.state.Prefs.SortMode,
+		SizeMode:        model.state.Prefs.SizeMode,
+		OneFileSystem:   model.state.Prefs.OneFileSystem,
+		FollowSymlinks:  model.state.Prefs.FollowSymlinks,
+		Exclusions:      model.state.Exclusions,
+		CleanupRules:    model.state.CleanupRules,
+		MaxDepth:        model.state.Prefs.MaxDepth,
+		Concurrency:     model.state.Prefs.Concurrency,
+		Watch:           model.state.Prefs.Watch,
+		SniffTypes:      model.state.Prefs.SniffTypes,
+		IndexArchives:   model.state.Prefs.IndexArchives,
 		Theme:           model.state.Prefs.Theme,
 		KeyBindings:     model.state.KeyBindings,
 		LastDestination: model.state.LastDestination,
@@ -106,13 +157,57 @@ func (model Model) ConfigSnapshot() config.Config {
 }
 
 func (model Model) Init() tea.Cmd {
-	return nil
+	if model.state.ImportedFrom != "" {
+		return model.scanCmd(model.scanCtx, model.state.Path)
+	}
+	var mountsCmd tea.Cmd
+	if model.mountsOnStart {
+		_, mountsCmd = model.openMounts()
+	}
+	return tea.Batch(model.refreshDisk(), mountsCmd)
 }
 
 func (model Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch typed := msg.(type) {
 	case tea.KeyMsg:
-		return model.handleKey(typed)
+		next, cmd := model.handleKey(typed)
+		if updated, ok := next.(Model); ok {
+			var gitCmd tea.Cmd
+			updated, gitCmd = updated.inspectGit()
+			return updated, tea.Batch(cmd, gitCmd)
+		}
+		return next, cmd
+	case mountsMsg:
+		return model.showMounts(typed.mounts, typed.err)
+	case diskUsageMsg:
+		if typed.path == model.state.Path {
+			model.disk, model.diskKnown = typed.usage, typed.known
+		}
+		return model, nil
+	case cleanupMsg:
+		return model.showCleanup(typed.report, typed.rules)
+	case gitStatusMsg:
+		if typed.path == model.gitPending {
+			model.gitPending = ""
+		}
+		if typed.err != nil {
+			typed.status.Error = typed.err.Error()
+		}
+		model.gitStatus[typed.path] = typed.status
+		return model, nil
+	case archiveIndexedMsg:
+		if typed.err != nil {
+			model.status = fmt.Sprintf("Archive error: %v", typed.err)
+			return model, nil
+		}
+		if model.snapshot != nil && !model.scanning {
+			model.state.SetTree(model.snapshot.Snapshot())
+			model.state.Expanded[typed.path] = true
+		}
+		model.status = fmt.Sprintf("%d archive members - enter expands, c extracts selected members", typed.count)
+		model.ensureCursorVisible()
+		model.ensureDetailCounts()
+		return model, nil
 	case tea.WindowSizeMsg:
 		model.width = typed.Width
 		model.height = typed.Height
@@ -134,6 +229,12 @@ func (model Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if model.snapshot != nil {
 			model.state.SetTree(model.snapshot.Snapshot())
 		}
+		model.treeScanned = model.scanStarted
+		model.gitStatus = make(map[string]services.GitStatus)
+		diskCmd := model.refreshDisk()
+		model.scanErrors = mergeScanErrors(model.scanErrors, typed.result)
+		model.baselineIndex = 0
+		model.state.SetBaseline(nil)
 		if model.pendingFocus != "" {
 			model.state.SetCurrent(model.pendingFocus)
 			model.pendingFocus = ""
@@ -143,9 +244,39 @@ func (model Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			model.pending = ""
 		}
 		model.status = fmt.Sprintf("Scan complete (%s)", typed.result.Duration)
+		if len(typed.result.Errors) > 0 {
+			model.status = fmt.Sprintf("Scan complete (%s) - %d paths unreadable, press E", typed.result.Duration, len(typed.result.Errors))
+		}
 		model.ensureCursorVisible()
 		model.ensureDetailCounts()
-		return model, nil
+		var watchCmd tea.Cmd
+		model, watchCmd = model.startWatch()
+		return model, tea.Batch(watchCmd, diskCmd)
+	case watchStartedMsg:
+		if typed.ctx.Err() != nil {
+			return model, nil
+		}
+		if typed.err != nil {
+			model = model.stopWatch()
+			model.status = fmt.Sprintf("Watch error: %v", typed.err)
+			return model, nil
+		}
+		return model, model.treeUpdateCmd(typed.ctx)
+	case treeUpdateMsg:
+		if typed.ctx.Err() != nil {
+			return model, nil
+		}
+		if typed.update.ErrMessage != "" {
+			model.status = fmt.Sprintf("Watch warning: %s", typed.update.ErrMessage)
+			return model, model.treeUpdateCmd(typed.ctx)
+		}
+		if model.snapshot != nil && !model.scanning {
+			model.state.SetTree(model.snapshot.Snapshot())
+			model.ensureCursorVisible()
+			model.ensureDetailCounts()
+		}
+		model.status = fmt.Sprintf("Updated %d changed paths", len(typed.update.Paths))
+		return model, model.treeUpdateCmd(typed.ctx)
 	case scanProgressMsg:
 		if typed.progress.ErrMessage != "" {
 			model.status = fmt.Sprintf("Scan warning: %s", typed.progress.ErrMessage)
@@ -164,15 +295,88 @@ func (model Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			model.status = fmt.Sprintf("Scanning... %d items", typed.progress.Scanned)
 		}
 		return model, model.progressCmd()
-	case actionResultMsg:
+	case duplicatesMsg:
+		if typed.ctx.Err() != nil {
+			return model, nil
+		}
+		model.dupeCancel = nil
 		if typed.err != nil {
-			model.status = fmt.Sprintf("Action error: %v", typed.err)
+			model.status = fmt.Sprintf("Duplicate search error: %v", typed.err)
+			return model, nil
+		}
+		model.dupeGroups = typed.groups
+		model.dupeRows = buildDupeRows(typed.groups)
+		if len(typed.groups) == 0 {
+			model.status = "No duplicates found"
+			return model, nil
+		}
+		var reclaimable int64
+		for _, group := range typed.groups {
+			reclaimable += group.Reclaimable()
+		}
+		model.listView = "dupes"
+		model.listCursor = 0
+		model.status = fmt.Sprintf("%d duplicate groups, %s reclaimable - K keeps one, esc returns", len(typed.groups), formatSize(reclaimable))
+		return model, nil
+	case duplicateProgressMsg:
+		if model.dupeCancel == nil {
+			return model, nil
+		}
+		if typed.progress.ErrMessage != "" {
+			model.status = fmt.Sprintf("Duplicate warning: %s", typed.progress.ErrMessage)
+			return model, model.dupeProgressCmd()
+		}
+		if typed.progress.Completed {
+			return model, model.dupeProgressCmd()
+		}
+		if typed.progress.Total > 0 {
+			model.status = fmt.Sprintf("Hashing (%s) %d/%d %s", typed.progress.Phase, typed.progress.Done, typed.progress.Total, typed.progress.Current)
+		}
+		return model, model.dupeProgressCmd()
+	case baselineMsg:
+		if typed.err != nil {
+			model.status = fmt.Sprintf("History error: %v", typed.err)
+			return model, nil
+		}
+		model.state.SetBaseline(typed.diff)
+		model.ensureCursorVisible()
+		if typed.diff == nil {
+			if model.baselineIndex == 0 {
+				model.status = "No earlier scans of this folder with the current options"
+			} else {
+				model.status = "Growth view off"
+			}
+			model.baselineIndex = 0
+			return model, nil
+		}
+		model.baselineIndex = typed.index
+		diff := typed.diff
+		model.status = fmt.Sprintf("Baseline %d/%d from %s: %d added, %d removed, %d grown, %d shrunk", typed.index, typed.total, diff.Baseline.Format("Jan 02 15:04"), diff.Added, diff.Removed, diff.Grown, diff.Shrunk)
+		return model, nil
+	case exportResultMsg:
+		if typed.err != nil {
+			model.status = fmt.Sprintf("Export error: %v", typed.err)
 			return model, nil
 		}
+		model.status = fmt.Sprintf("Exported to %s", typed.path)
+		return model, nil
+	case actionResultMsg:
 		model.actionRunning = false
 		model.actionProgressCount = 0
+		diskCmd := model.refreshDisk()
+		if typed.err != nil {
+			model.status = fmt.Sprintf("Action error: %v", typed.err)
+			return model, diskCmd
+		}
+		model.gitStatus = make(map[string]services.GitStatus)
 		model.status = fmt.Sprintf("%s (%d ok, %d failed)", typed.result.Message, typed.result.SuccessCount, typed.result.FailureCount)
-		return model, nil
+		if typed.result.Type == services.ActionDedupe {
+			for _, path := range typed.result.Replaced {
+				delete(model.state.Selected, path)
+			}
+			model.status = fmt.Sprintf("Dedupe: %d linked, %d failed, %d already linked - %s reclaimed", typed.result.SuccessCount, typed.result.FailureCount, typed.result.Skipped, formatSize(typed.result.BytesReclaimed))
+		}
+		return model, diskCmd
 	case actionPreviewMsg:
 		if typed.err != nil {
 			model.status = fmt.Sprintf("Preview error: %v", typed.err)
@@ -183,7 +387,11 @@ func (model Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		model.pendingPreview = typed.preview
 		model.confirming = true
 		model.confirmStep = 1
+		model.gitOverride = false
 		model.status = previewPrompt(typed.preview, 1)
+		if typed.preview.Blocked {
+			model.status = blockedPrompt(typed.preview)
+		}
 		return model, nil
 	case actionProgressMsg:
 		if typed.progress.ErrMessage != "" {
@@ -207,15 +415,24 @@ func (model Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch {
 	case key.Matches(msg, model.keys.Quit):
 		model = model.cancelScan("")
+		model = model.stopWatch()
+		if model.dupeCancel != nil {
+			model.dupeCancel()
+		}
 		return model, tea.Quit
 	case key.Matches(msg, model.keys.Help):
 		model.showHelp = !model.showHelp
 		return model, nil
 	case model.confirming && key.Matches(msg, model.keys.Confirm):
 		return model.confirmAction()
+	case model.confirming && model.pendingPreview.Blocked && key.Matches(msg, model.keys.Override):
+		model.gitOverride = true
+		model.status = "Git safety overridden - " + previewPrompt(model.pendingPreview, model.confirmStep)
+		return model, nil
 	case model.confirming && key.Matches(msg, model.keys.Cancel):
 		model.confirming = false
 		model.confirmStep = 0
+		model.gitOverride = false
 		model.status = "Action cancelled"
 		return model, nil
 	case model.awaitingCompression:
@@ -224,6 +441,8 @@ func (model Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return model.handleBackupNameInput(msg)
 	case model.filterInputMode != "":
 		return model.handleFilterInput(msg)
+	case model.listView != "":
+		return model.handleListView(msg)
 	case model.awaitingDestination && key.Matches(msg, model.keys.Paste):
 		model.awaitingDestination = false
 		model.pendingDestination = model.state.CurrentPath()
@@ -276,12 +495,37 @@ func (model Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return model.beginAction(services.ActionCopy)
 	case key.Matches(msg, model.keys.Backup):
 		return model.beginAction(services.ActionBackup)
+	case model.state.Flat != state.FlatOff && (key.Matches(msg, model.keys.Enter) || key.Matches(msg, model.keys.Right)):
+		if node := model.state.CurrentNode(); node != nil && model.state.Reveal(node.ID) {
+			model.ensureCursorVisible()
+			model.ensureDetailCounts()
+		}
+		return model, nil
+	case model.state.Flat != state.FlatOff && (key.Matches(msg, model.keys.Left) || key.Matches(msg, model.keys.Back)):
+		model.state.ExitFlat()
+		model.ensureCursorVisible()
+		return model, nil
+	case key.Matches(msg, model.keys.Flat):
+		switch model.state.ToggleFlat() {
+		case state.FlatFiles:
+			model.status = fmt.Sprintf("Largest files (top %d) - enter reveals, F folders", state.FlatLimit)
+		case state.FlatDirs:
+			model.status = fmt.Sprintf("Largest folders (top %d) - enter reveals, F tree", state.FlatLimit)
+		default:
+			model.status = "Tree view"
+		}
+		model.ensureCursorVisible()
+		model.ensureDetailCounts()
+		return model, nil
 	case key.Matches(msg, model.keys.Enter):
 		node := model.state.CurrentNode()
-		if node == nil || node.Type != domain.NodeDir {
+		if node == nil || !state.Browsable(node) {
 			return model, nil
 		}
-		if !node.Scanned {
+		if node.Skipped == domain.SkipDepth {
+			return model.deepenScan(node)
+		}
+		if node.Type == domain.NodeDir && !node.Scanned {
 			model.status = "Not scanned - press s to scan"
 			return model, nil
 		}
@@ -291,10 +535,13 @@ func (model Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return model, nil
 	case key.Matches(msg, model.keys.Right):
 		node := model.state.CurrentNode()
-		if node == nil || node.Type != domain.NodeDir {
+		if node == nil || !state.Browsable(node) {
 			return model, nil
 		}
-		if !node.Scanned {
+		if node.Skipped == domain.SkipDepth {
+			return model.deepenScan(node)
+		}
+		if node.Type == domain.NodeDir && !node.Scanned {
 			if err := model.state.LoadListing(node.Path); err != nil {
 				model.status = fmt.Sprintf("List error: %v", err)
 				return model, nil
@@ -346,12 +593,76 @@ func (model Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return model, nil
 	case key.Matches(msg, model.keys.Refresh):
 		if model.invalid != nil {
-			if node := model.state.CurrentNode(); node != nil {
+			if node := model.state.CurrentNode(); node != nil && node.Archive == "" {
 				model.invalid.Invalidate(node.Path)
 				return model.beginScan(node.Path, node.ID, node.ID)
 			}
 		}
 		return model, nil
+	case key.Matches(msg, model.keys.Watch):
+		if model.watcher == nil {
+			model.status = "Watch mode is not available"
+			return model, nil
+		}
+		if !model.state.ToggleWatch() {
+			model = model.stopWatch()
+			model.status = "Watch: off"
+			return model, nil
+		}
+		model.status = "Watch: on - changes apply after the next scan"
+		if root, ok := model.state.Tree.Nodes[model.state.Tree.RootID]; ok && root.AccumBytes > 0 && !model.scanning {
+			model.status = "Watch: on"
+			return model.startWatch()
+		}
+		return model, nil
+	case key.Matches(msg, model.keys.Growth):
+		return model.nextBaseline()
+	case key.Matches(msg, model.keys.Duplicates):
+		return model.findDuplicates()
+	case key.Matches(msg, model.keys.Errors):
+		if len(model.scanErrors) == 0 {
+			model.status = "No scan errors"
+			return model, nil
+		}
+		model.listView = "errors"
+		model.listCursor = 0
+		model.status = fmt.Sprintf("%d scan errors - enter to reveal, esc to close", len(model.scanErrors))
+		return model, nil
+	case key.Matches(msg, model.keys.Owners):
+		node, ok := model.state.Tree.Nodes[model.state.Current]
+		if !ok || len(node.Owners) == 0 {
+			model.status = "No owner totals - scan first"
+			return model, nil
+		}
+		model.ownerRows = buildOwnerRows(node.Owners)
+		model.listView = "owners"
+		model.listCursor = 0
+		model.status = fmt.Sprintf("%d owners in %s - enter filters the tree, esc closes", len(model.ownerRows), node.Path)
+		return model, nil
+	case key.Matches(msg, model.keys.Cleanup):
+		return model.findCleanupCandidates()
+	case key.Matches(msg, model.keys.Mounts):
+		return model.openMounts()
+	case key.Matches(msg, model.keys.Archive):
+		return model.indexArchive()
+	case key.Matches(msg, model.keys.OwnerFilter):
+		model.filterInputMode = "owner"
+		model.filterInputValue = ""
+		if model.state.FilterOwner != nil {
+			model.filterInputValue = fsinfo.UserName(*model.state.FilterOwner)
+		}
+		model.status = fmt.Sprintf("Owner: %s", model.filterInputValue)
+		return model, nil
+	case key.Matches(msg, model.keys.Export):
+		root, ok := model.state.Tree.Nodes[model.state.Tree.RootID]
+		if !ok || model.scanning || (model.treeScanned.IsZero() && model.state.ImportedFrom == "") {
+			model.status = "Scan first to export the tree"
+			return model, nil
+		}
+		model.filterInputMode = "export"
+		model.filterInputValue = fmt.Sprintf("sweepfs-%s.json", root.Name)
+		model.status = fmt.Sprintf("Export to: %s", model.filterInputValue)
+		return model, nil
 	case key.Matches(msg, model.keys.Sort):
 		model.state.ToggleSortMode()
 		model.ensureCursorVisible()
@@ -375,6 +686,23 @@ func (model Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		model.ensureCursorVisible()
 		model.ensureDetailCounts()
 		return model, nil
+	case key.Matches(msg, model.keys.SizeMode):
+		mode := model.state.ToggleSizeMode()
+		path := model.state.CurrentPath()
+		if model.invalid != nil {
+			model.invalid.Invalidate(path)
+		}
+		if root, ok := model.state.Tree.Nodes[model.state.Tree.RootID]; ok && root.SizeMode != mode && root.AccumBytes > 0 {
+			return model.beginScan(path, "", path)
+		}
+		if err := model.state.LoadListing(path); err != nil {
+			model.status = fmt.Sprintf("List error: %v", err)
+			return model, nil
+		}
+		model.status = fmt.Sprintf("Size mode: %s - press s to scan", mode)
+		model.ensureCursorVisible()
+		model.ensureDetailCounts()
+		return model, nil
 	case key.Matches(msg, model.keys.Search):
 		model.filterInputMode = "search"
 		model.filterInputValue = model.state.SearchQuery
@@ -385,11 +713,45 @@ func (model Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		model.filterInputValue = model.state.FilterExt
 		model.status = fmt.Sprintf("Extension: %s", model.filterInputValue)
 		return model, nil
+	case key.Matches(msg, model.keys.TypeFilter):
+		if category := model.state.CycleTypeFilter(); category != "" {
+			model.status = fmt.Sprintf("Type filter: %s", category)
+		} else {
+			model.status = "Type filter off"
+		}
+		model.ensureCursorVisible()
+		return model, nil
+	case key.Matches(msg, model.keys.AgeFilter):
+		model.filterInputMode = "age"
+		model.filterInputValue = ""
+		if model.state.MinAgeDays > 0 {
+			model.filterInputValue = strconv.Itoa(model.state.MinAgeDays)
+		}
+		model.status = fmt.Sprintf("Not modified in (days): %s", model.filterInputValue)
+		return model, nil
+	case key.Matches(msg, model.keys.SelectAll):
+		added := model.state.SelectVisible()
+		count, size := model.state.SelectionSummary()
+		model.status = fmt.Sprintf("Selected %d more (%d items, %s)", added, count, formatSize(size))
+		return model, nil
 	case key.Matches(msg, model.keys.SizeFilter):
 		model.filterInputMode = "size"
 		model.filterInputValue = formatSizeLabel(model.state.MinSizeBytes)
 		model.status = fmt.Sprintf("Min size: %s", model.filterInputValue)
 		return model, nil
+	case key.Matches(msg, model.keys.Exclusions):
+		model.filterInputMode = "exclude"
+		model.filterInputValue = strings.Join(model.state.Exclusions, ",")
+		model.status = fmt.Sprintf("Exclude: %s", model.filterInputValue)
+		return model, nil
+	case key.Matches(msg, model.keys.DepthLimit):
+		model.filterInputMode = "depth"
+		model.filterInputValue = ""
+		if model.state.Prefs.MaxDepth > 0 {
+			model.filterInputValue = strconv.Itoa(model.state.Prefs.MaxDepth)
+		}
+		model.status = fmt.Sprintf("Max depth: %s", model.filterInputValue)
+		return model, nil
 	case key.Matches(msg, model.keys.ClearFilter):
 		model.state.ClearFilters()
 		model.status = "Filters cleared"
@@ -405,7 +767,18 @@ func (model Model) beginAction(actionType services.ActionType) (tea.Model, tea.C
 		model.status = "Action already running"
 		return model, nil
 	}
-	if actionType == services.ActionMove || actionType == services.ActionCopy || actionType == services.ActionBackup {
+	if model.state.ImportedFrom != "" {
+		model.status = fmt.Sprintf("Read-only: tree imported from %s", model.state.ImportedFrom)
+		return model, nil
+	}
+	if members, total := model.selectedMembers(); members > 0 {
+		if actionType != services.ActionCopy || members < total {
+			model.status = "Archive members can only be extracted - select only members and press c"
+			return model, nil
+		}
+		actionType = services.ActionExtract
+	}
+	if actionType == services.ActionMove || actionType == services.ActionCopy || actionType == services.ActionBackup || actionType == services.ActionExtract {
 		model.awaitingDestination = true
 		model.capturingDestination = false
 		model.pendingAction = actionType
@@ -432,7 +805,11 @@ func (model Model) requestPreview(actionType services.ActionType, destination st
 		model.status = "Preview unavailable"
 		return model, nil
 	}
-	paths := model.state.SelectedPaths()
+	return model.previewPaths(actionType, destination, model.state.SelectedPaths())
+}
+
+// previewPaths previews an action on paths, which confirmAction then runs.
+func (model Model) previewPaths(actionType services.ActionType, destination string, paths []string) (tea.Model, tea.Cmd) {
 	request := services.ActionRequest{
 		Type:        actionType,
 		SourcePaths: paths,
@@ -441,6 +818,7 @@ func (model Model) requestPreview(actionType services.ActionType, destination st
 	}
 	model.pendingAction = actionType
 	model.pendingDestination = destination
+	model.pendingPaths = paths
 	return model, func() tea.Msg {
 		preview, err := model.previewer.Preview(context.Background(), request)
 		return actionPreviewMsg{preview: preview, err: err}
@@ -449,6 +827,10 @@ func (model Model) requestPreview(actionType services.ActionType, destination st
 
 func (model Model) confirmAction() (tea.Model, tea.Cmd) {
 	preview := model.pendingPreview
+	if preview.Blocked && !model.gitOverride {
+		model.status = blockedPrompt(preview)
+		return model, nil
+	}
 	confirmToken := "confirm"
 	if preview.Type == services.ActionDelete && preview.TotalDirs > 0 {
 		if model.confirmStep == 1 {
@@ -463,14 +845,15 @@ func (model Model) confirmAction() (tea.Model, tea.Cmd) {
 	model.actionRunning = true
 	model.actionProgressCount = 0
 	model.status = fmt.Sprintf("%s in progress", strings.ToUpper(string(preview.Type)))
-	paths := model.state.SelectedPaths()
 	request := services.ActionRequest{
-		Type:         preview.Type,
-		SourcePaths:  paths,
-		Destination:  model.pendingDestination,
-		SafeMode:     model.state.Prefs.SafeMode,
-		ConfirmToken: confirmToken,
-	}
+		Type:          preview.Type,
+		SourcePaths:   model.pendingPaths,
+		Destination:   model.pendingDestination,
+		SafeMode:      model.state.Prefs.SafeMode,
+		AllowDirtyGit: model.gitOverride,
+		ConfirmToken:  confirmToken,
+	}
+	model.gitOverride = false
 	return model, tea.Batch(model.actionExecuteCmd(request), model.actionProgressCmd())
 }
 
@@ -616,6 +999,49 @@ func (model Model) handleFilterInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			model.state.FilterExt = value
 		case "size":
 			model.state.MinSizeBytes = parseSizeInput(value)
+		case "owner":
+			model.state.FilterOwner = nil
+			if value != "" {
+				uid, ok := fsinfo.LookupUID(value)
+				if !ok {
+					model.status = fmt.Sprintf("Unknown user %q", value)
+					return model, nil
+				}
+				model.state.FilterOwner = &uid
+			}
+		case "age":
+			days, err := strconv.Atoi(value)
+			if value != "" && (err != nil || days < 0) {
+				model.status = "Age must be a number of days (0 = off)"
+				return model, nil
+			}
+			model.state.MinAgeDays = days
+		case "exclude":
+			model.state.Exclusions = parsePatternList(value)
+			if model.invalid != nil {
+				model.invalid.Invalidate(model.state.CurrentPath())
+			}
+			model.status = fmt.Sprintf("Exclusions: %d rules - press s to rescan", len(model.state.Exclusions))
+			return model, nil
+		case "export":
+			if value == "" {
+				model.status = "Export cancelled"
+				return model, nil
+			}
+			model.status = fmt.Sprintf("Exporting to %s...", value)
+			return model, exportCmd(value, model.state.Tree)
+		case "depth":
+			depth, err := strconv.Atoi(value)
+			if value != "" && (err != nil || depth < 0) {
+				model.status = "Max depth must be a number (0 = unlimited)"
+				return model, nil
+			}
+			model.state.Prefs.MaxDepth = depth
+			if model.invalid != nil {
+				model.invalid.Invalidate(model.state.CurrentPath())
+			}
+			model.status = fmt.Sprintf("Max depth: %s - press s to rescan", depthLabel(depth))
+			return model, nil
 		}
 		model.ensureCursorVisible()
 		model.status = "Filter applied"
@@ -672,6 +1098,24 @@ func parseSizeInput(input string) int64 {
 	return int64(parsed * float64(multiplier))
 }
 
+func depthLabel(depth int) string {
+	if depth <= 0 {
+		return "unlimited"
+	}
+	return strconv.Itoa(depth)
+}
+
+func parsePatternList(input string) []string {
+	patterns := []string{}
+	for _, part := range strings.Split(input, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			patterns = append(patterns, part)
+		}
+	}
+	return patterns
+}
+
 func filterLabel(mode string) string {
 	switch mode {
 	case "search":
@@ -680,6 +1124,16 @@ func filterLabel(mode string) string {
 		return "Extension"
 	case "size":
 		return "Min size"
+	case "exclude":
+		return "Exclude"
+	case "depth":
+		return "Max depth"
+	case "age":
+		return "Not modified in (days)"
+	case "owner":
+		return "Owner"
+	case "export":
+		return "Export to"
 	default:
 		return "Filter"
 	}
@@ -703,13 +1157,427 @@ func formatSizeLabel(size int64) string {
 	return fmt.Sprintf("%.1f%s", value, units[exp])
 }
 
+// handleListView drives the list that replaces the tree panel, such as the
+// scan error list. enter reveals the highlighted path in the tree.
+func (model Model) handleListView(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	count := model.listLength()
+	switch {
+	case key.Matches(msg, model.keys.Up):
+		model.listCursor = clamp(model.listCursor-1, 0, maxInt(count-1, 0))
+	case key.Matches(msg, model.keys.Down):
+		model.listCursor = clamp(model.listCursor+1, 0, maxInt(count-1, 0))
+	case model.listView == "owners" && (key.Matches(msg, model.keys.Enter) || key.Matches(msg, model.keys.Right)):
+		model.listView = ""
+		if model.listCursor >= len(model.ownerRows) {
+			return model, nil
+		}
+		uid := model.ownerRows[model.listCursor].uid
+		model.state.FilterOwner = &uid
+		model.status = fmt.Sprintf("Owner filter: %s", fsinfo.UserName(uid))
+		model.ensureCursorVisible()
+	case model.listView == "mounts" && (key.Matches(msg, model.keys.Enter) || key.Matches(msg, model.keys.Right)):
+		return model.scanMount()
+	case key.Matches(msg, model.keys.Enter), key.Matches(msg, model.keys.Right):
+		path := model.listPath()
+		model.listView = ""
+		if path == "" {
+			return model, nil
+		}
+		if !model.state.Reveal(path) && !model.state.Reveal(parentDirPath(path)) {
+			model.status = fmt.Sprintf("%s is not in the tree", path)
+			return model, nil
+		}
+		model.status = path
+		model.ensureCursorVisible()
+	case key.Matches(msg, model.keys.Select) && model.listView == "cleanup":
+		model.state.ToggleSelection(model.listPath())
+	case key.Matches(msg, model.keys.SelectAll) && model.listView == "cleanup":
+		for _, candidate := range model.cleanup.Candidates {
+			if _, ok := model.state.Tree.Nodes[candidate.Path]; ok {
+				model.state.Selected[candidate.Path] = true
+			}
+		}
+		count, size := model.state.SelectionSummary()
+		model.status = fmt.Sprintf("Selected %d items (%s) - d deletes them", count, formatSize(size))
+	case key.Matches(msg, model.keys.Delete) && model.listView == "cleanup":
+		return model.beginAction(services.ActionDelete)
+	case key.Matches(msg, model.keys.Select) && model.listView == "dupes":
+		if path := model.listPath(); path != "" && model.dupeRows[model.listCursor].member {
+			model.state.ToggleSelection(path)
+		}
+	case key.Matches(msg, model.keys.KeepOne) && model.listView == "dupes":
+		return model.keepOneDuplicate()
+	case key.Matches(msg, model.keys.Dedupe) && model.listView == "dupes":
+		return model.dedupeGroup()
+	case key.Matches(msg, model.keys.Cancel), key.Matches(msg, model.keys.Errors), key.Matches(msg, model.keys.Duplicates), key.Matches(msg, model.keys.Owners), key.Matches(msg, model.keys.Cleanup), key.Matches(msg, model.keys.Mounts):
+		model.listView = ""
+		model.status = "Ready"
+	}
+	return model, nil
+}
+
+// findDuplicates searches the folder shown in the tree for duplicate files.
+// Pressing D again while it runs cancels the search.
+func (model Model) findDuplicates() (Model, tea.Cmd) {
+	if model.dupeCancel != nil {
+		model.dupeCancel()
+		model.dupeCancel = nil
+		model.status = "Duplicate search cancelled"
+		return model, nil
+	}
+	if model.dupes == nil {
+		model.status = "Duplicate search is not available"
+		return model, nil
+	}
+	if model.treeScanned.IsZero() || model.scanning {
+		model.status = "Scan first to find duplicates"
+		return model, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	model.dupeCancel = cancel
+	request := services.DuplicateRequest{
+		Tree:        model.state.Tree,
+		RootPath:    model.state.Current,
+		Concurrency: model.state.Prefs.Concurrency,
+	}
+	finder := model.dupes
+	model.status = fmt.Sprintf("Finding duplicates in %s...", request.RootPath)
+	return model, tea.Batch(func() tea.Msg {
+		groups, err := finder.FindDuplicates(ctx, request)
+		return duplicatesMsg{ctx: ctx, groups: groups, err: err}
+	}, model.dupeProgressCmd())
+}
+
+func (model Model) dupeProgressCmd() tea.Cmd {
+	if model.dupes == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		for {
+			channel := model.dupes.DuplicateProgress()
+			if channel == nil {
+				time.Sleep(50 * time.Millisecond)
+				continue
+			}
+			progress, ok := <-channel
+			if !ok {
+				return duplicateProgressMsg{progress: services.DuplicateProgress{Completed: true}}
+			}
+			return duplicateProgressMsg{progress: progress}
+		}
+	}
+}
+
+// keepOneDuplicate selects every copy in the highlighted group except one:
+// the highlighted file, or the oldest copy when the group row is highlighted.
+func (model Model) keepOneDuplicate() (tea.Model, tea.Cmd) {
+	if model.listCursor >= len(model.dupeRows) {
+		return model, nil
+	}
+	row := model.dupeRows[model.listCursor]
+	group := model.dupeGroups[row.group]
+	keep := row.path
+	if !row.member {
+		keep = oldestPath(model.state.Tree, group.Paths)
+	}
+	for _, path := range group.Paths {
+		if path == keep {
+			delete(model.state.Selected, path)
+		} else if _, ok := model.state.Tree.Nodes[path]; ok {
+			model.state.Selected[path] = true
+		}
+	}
+	model.status = fmt.Sprintf("Keeping %s - %d copies selected (%s)", keep, len(group.Paths)-1, formatSize(group.Reclaimable()))
+	return model, nil
+}
+
+// dedupeGroup replaces the other copies of the highlighted group with links
+// to the kept one, going through the usual preview and confirmation.
+func (model Model) dedupeGroup() (tea.Model, tea.Cmd) {
+	if model.listCursor >= len(model.dupeRows) {
+		return model, nil
+	}
+	if model.actionRunning {
+		model.status = "Action already running"
+		return model, nil
+	}
+	if model.state.ImportedFrom != "" {
+		model.status = fmt.Sprintf("Read-only: tree imported from %s", model.state.ImportedFrom)
+		return model, nil
+	}
+	row := model.dupeRows[model.listCursor]
+	group := model.dupeGroups[row.group]
+	keep := row.path
+	if !row.member {
+		keep = oldestPath(model.state.Tree, group.Paths)
+	}
+	copies := []string{}
+	for _, path := range group.Paths {
+		if _, ok := model.state.Tree.Nodes[path]; ok && path != keep {
+			copies = append(copies, path)
+		}
+	}
+	if len(copies) == 0 {
+		model.status = "No copies left to link"
+		return model, nil
+	}
+	return model.previewPaths(services.ActionDedupe, keep, copies)
+}
+
+// findCleanupCandidates runs the cleanup rules over the folder shown in the
+// tree in the background, as excluded folders they match are sized on disk.
+func (model Model) findCleanupCandidates() (Model, tea.Cmd) {
+	if (model.treeScanned.IsZero() && model.state.ImportedFrom == "") || model.scanning {
+		model.status = "Scan first to find cleanup candidates"
+		return model, nil
+	}
+	rules := domain.MergeCleanupRules(model.state.CleanupRules)
+	tree, root, showHidden := model.state.Tree, model.state.Current, model.state.Prefs.ShowHidden
+	model.status = fmt.Sprintf("Finding cleanup candidates in %s...", root)
+	return model, func() tea.Msg {
+		return cleanupMsg{report: services.FindCleanupCandidates(tree, root, rules, showHidden, time.Now()), rules: len(rules)}
+	}
+}
+
+// showCleanup opens the candidate list, or says why there is none.
+func (model Model) showCleanup(report services.CleanupReport, rules int) (Model, tea.Cmd) {
+	model.cleanup = report
+	unevaluated := ""
+	if len(report.Unevaluated) > 0 {
+		unevaluated = fmt.Sprintf(", %d skipped with hidden files off", len(report.Unevaluated))
+	}
+	if len(report.Candidates) == 0 {
+		model.status = fmt.Sprintf("No cleanup candidates in %s (%d rules%s)", report.Root, rules, unevaluated)
+		return model, nil
+	}
+	model.listView = "cleanup"
+	model.listCursor = 0
+	model.status = fmt.Sprintf("%d candidates, %s reclaimable - space/* select, d delete, esc returns", len(report.Candidates), formatSize(report.TotalBytes))
+	return model, nil
+}
+
+// openMounts reads the mounted filesystems in the background, as sizing each
+// one can stall on an unresponsive network mount.
+func (model Model) openMounts() (Model, tea.Cmd) {
+	model.status = "Reading mounted filesystems..."
+	return model, func() tea.Msg {
+		mounts, err := fsinfo.Mounts()
+		return mountsMsg{mounts: mounts, err: err}
+	}
+}
+
+// showMounts opens the list of mounted filesystems with the one holding the
+// scan root highlighted.
+func (model Model) showMounts(mounts []fsinfo.Mount, err error) (Model, tea.Cmd) {
+	if err != nil {
+		model.status = fmt.Sprintf("Mounts: %v", err)
+		return model, nil
+	}
+	if len(mounts) == 0 {
+		model.status = "No mounted filesystems found"
+		return model, nil
+	}
+	model.mounts = mounts
+	model.listView = "mounts"
+	model.listCursor = 0
+	for index, mount := range mounts {
+		if isWithinPath(mount.Path, model.state.Path) && len(mount.Path) >= len(mounts[model.listCursor].Path) {
+			model.listCursor = index
+		}
+	}
+	model.status = fmt.Sprintf("%d filesystems - enter scans one, esc closes", len(mounts))
+	return model, nil
+}
+
+// indexArchive reads the members of the archive under the cursor in the
+// background and lists them below it.
+func (model Model) indexArchive() (tea.Model, tea.Cmd) {
+	node := model.state.CurrentNode()
+	if model.archives == nil || model.state.ImportedFrom != "" {
+		model.status = "Archive browsing is not available"
+		return model, nil
+	}
+	if node == nil || node.Type != domain.NodeFile || node.Archive != "" || !services.IsArchive(node.Name) {
+		model.status = "Not an archive (.zip, .tar, .tar.gz, .tgz)"
+		return model, nil
+	}
+	if model.treeScanned.IsZero() || model.scanning {
+		model.status = "Scan first to browse archives"
+		return model, nil
+	}
+	path := node.Path
+	model.status = fmt.Sprintf("Reading %s...", node.Name)
+	return model, func() tea.Msg {
+		count, err := model.archives.IndexArchive(context.Background(), path)
+		return archiveIndexedMsg{path: path, count: count, err: err}
+	}
+}
+
+// selectedMembers counts the archive members among the paths an action would
+// apply to, and those paths.
+func (model Model) selectedMembers() (int, int) {
+	paths := model.state.SelectedPaths()
+	members := 0
+	for _, path := range paths {
+		if node, ok := model.state.Tree.Nodes[path]; ok && node.Archive != "" {
+			members++
+		}
+	}
+	return members, len(paths)
+}
+
+// refreshDisk reads the free space of the filesystem holding the scan root
+// for the tree header in the background. Imported trees do not describe a
+// local filesystem.
+func (model *Model) refreshDisk() tea.Cmd {
+	if model.state.ImportedFrom != "" || model.state.Path == "" {
+		model.diskKnown = false
+		return nil
+	}
+	path := model.state.Path
+	return func() tea.Msg {
+		usage, known := fsinfo.Usage(path)
+		return diskUsageMsg{path: path, usage: usage, known: known}
+	}
+}
+
+// scanMount scans the highlighted filesystem without crossing into other
+// mounts below it. Rescans and deeper scans below it keep that limit.
+func (model Model) scanMount() (Model, tea.Cmd) {
+	model.listView = ""
+	if model.listCursor >= len(model.mounts) {
+		return model, nil
+	}
+	if model.state.ImportedFrom != "" {
+		model.status = fmt.Sprintf("Read-only: tree imported from %s", model.state.ImportedFrom)
+		return model, nil
+	}
+	path := model.mounts[model.listCursor].Path
+	if err := model.state.LoadListing(path); err != nil {
+		model.status = fmt.Sprintf("List error: %v", err)
+		return model, nil
+	}
+	model.mountRoot = path
+	return model.beginScan(path, "", path)
+}
+
+type ownerRow struct {
+	uid   uint32
+	total domain.UsageTotal
+}
+
+// buildOwnerRows lists owners by the bytes they hold, largest first.
+func buildOwnerRows(owners map[uint32]domain.UsageTotal) []ownerRow {
+	rows := make([]ownerRow, 0, len(owners))
+	for uid, total := range owners {
+		rows = append(rows, ownerRow{uid: uid, total: total})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].total.Bytes != rows[j].total.Bytes {
+			return rows[i].total.Bytes > rows[j].total.Bytes
+		}
+		return rows[i].uid < rows[j].uid
+	})
+	return rows
+}
+
+type dupeRow struct {
+	group  int
+	path   string
+	member bool
+}
+
+func buildDupeRows(groups []services.DuplicateGroup) []dupeRow {
+	rows := []dupeRow{}
+	for index, group := range groups {
+		rows = append(rows, dupeRow{group: index, path: group.Paths[0]})
+		for _, path := range group.Paths {
+			rows = append(rows, dupeRow{group: index, path: path, member: true})
+		}
+	}
+	return rows
+}
+
+func oldestPath(tree domain.TreeIndex, paths []string) string {
+	oldest := paths[0]
+	for _, path := range paths[1:] {
+		node, ok := tree.Nodes[path]
+		current, hasCurrent := tree.Nodes[oldest]
+		if ok && hasCurrent && node.ModTime.Before(current.ModTime) {
+			oldest = path
+		}
+	}
+	return oldest
+}
+
+func (model Model) listLength() int {
+	switch model.listView {
+	case "errors":
+		return len(model.scanErrors)
+	case "dupes":
+		return len(model.dupeRows)
+	case "owners":
+		return len(model.ownerRows)
+	case "cleanup":
+		return len(model.cleanup.Candidates)
+	case "mounts":
+		return len(model.mounts)
+	default:
+		return 0
+	}
+}
+
+func (model Model) listPath() string {
+	switch model.listView {
+	case "errors":
+		if model.listCursor < len(model.scanErrors) {
+			return model.scanErrors[model.listCursor].Path
+		}
+	case "dupes":
+		if model.listCursor < len(model.dupeRows) {
+			return model.dupeRows[model.listCursor].path
+		}
+	case "cleanup":
+		if model.listCursor < len(model.cleanup.Candidates) {
+			return model.cleanup.Candidates[model.listCursor].Path
+		}
+	}
+	return ""
+}
+
+// mergeScanErrors replaces the errors below the scanned root with the ones
+// the scan reported, keeping errors recorded elsewhere in the tree.
+func mergeScanErrors(current []services.ScanError, result services.ScanResult) []services.ScanError {
+	merged := make([]services.ScanError, 0, len(current)+len(result.Errors))
+	for _, scanErr := range current {
+		if !isWithinPath(result.RootPath, scanErr.Path) {
+			merged = append(merged, scanErr)
+		}
+	}
+	merged = append(merged, result.Errors...)
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Path < merged[j].Path
+	})
+	return merged
+}
+
+func isWithinPath(root, path string) bool {
+	if root == path {
+		return true
+	}
+	return strings.HasPrefix(path, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator))
+}
+
 func (model Model) beginScan(path string, pendingID string, focusID string) (Model, tea.Cmd) {
 	model = model.cancelScan("Scan cancelled")
+	model = model.stopWatch()
+	model.scanStarted = time.Now()
 	model.state.Path = path
+	diskCmd := model.refreshDisk()
 	if model.state.Tree.RootID == "" {
 		if err := model.state.LoadListing(path); err != nil {
 			model.status = fmt.Sprintf("List error: %v", err)
-			return model, nil
+			return model, diskCmd
 		}
 	}
 	if focusID != "" {
@@ -728,21 +1596,55 @@ func (model Model) beginScan(path string, pendingID string, focusID string) (Mod
 	model.pendingFocus = focusID
 	model.progressCount = 0
 	model.status = fmt.Sprintf("Scanning... %s", path)
-	return model, tea.Batch(model.scanCmd(ctx, path), model.progressCmd())
+	return model, tea.Batch(model.scanCmd(ctx, path), model.progressCmd(), diskCmd)
 }
 
-func (model Model) scanCmd(ctx context.Context, path string) tea.Cmd {
-	request := services.ScanRequest{
-		RootPath:   path,
-		ShowHidden: model.state.Prefs.ShowHidden,
+// deepenScan scans the subtree below a depth-limited folder. The scanner
+// merges it into the loaded tree, so the scan root stays unchanged.
+func (model Model) deepenScan(node *domain.Node) (Model, tea.Cmd) {
+	rootPath := model.state.Path
+	model, cmd := model.beginScan(node.Path, "", node.ID)
+	model.state.Path = rootPath
+	return model, cmd
+}
+
+func (model Model) scanRequest(path string) services.ScanRequest {
+	return services.ScanRequest{
+		RootPath:       path,
+		ShowHidden:     model.state.Prefs.ShowHidden,
+		SizeMode:       model.state.Prefs.SizeMode,
+		OneFileSystem:  model.state.Prefs.OneFileSystem || (model.mountRoot != "" && isWithinPath(model.mountRoot, path)),
+		FollowSymlinks: model.state.Prefs.FollowSymlinks,
+		Exclude:        model.state.Exclusions,
+		MaxDepth:       model.state.Prefs.MaxDepth,
+		Concurrency:    model.state.Prefs.Concurrency,
+		SniffTypes:     model.state.Prefs.SniffTypes,
+		IndexArchives:  model.state.Prefs.IndexArchives,
 	}
+}
 
+func (model Model) scanCmd(ctx context.Context, path string) tea.Cmd {
+	request := model.scanRequest(path)
 	return func() tea.Msg {
 		result, err := model.scanner.Scan(ctx, request)
 		return scanResultMsg{result: result, err: err}
 	}
 }
 
+func exportCmd(path string, tree domain.TreeIndex) tea.Cmd {
+	return func() tea.Msg {
+		file, err := os.Create(path)
+		if err != nil {
+			return exportResultMsg{path: path, err: err}
+		}
+		if err := services.ExportNcdu(file, tree); err != nil {
+			file.Close()
+			return exportResultMsg{path: path, err: err}
+		}
+		return exportResultMsg{path: path, err: file.Close()}
+	}
+}
+
 func (model Model) progressCmd() tea.Cmd {
 	if model.progress == nil {
 		return nil
@@ -763,6 +1665,83 @@ func (model Model) progressCmd() tea.Cmd {
 	}
 }
 
+// nextBaseline compares the tree with the next older saved scan of the same
+// root. Stepping past the oldest scan turns the growth view off.
+func (model Model) nextBaseline() (Model, tea.Cmd) {
+	if model.history == nil {
+		model.status = "Scan history is not available"
+		return model, nil
+	}
+	if model.treeScanned.IsZero() || model.scanning {
+		model.status = "Scan first to compare with earlier scans"
+		return model, nil
+	}
+	index := model.baselineIndex + 1
+	request := model.scanRequest(model.state.Tree.RootID)
+	history := model.history
+	current := model.state.Tree
+	scanned := model.treeScanned
+	model.status = "Loading scan history..."
+	return model, func() tea.Msg {
+		snapshots, err := history.Snapshots(request)
+		if err != nil {
+			return baselineMsg{err: err}
+		}
+		earlier := make([]services.SnapshotInfo, 0, len(snapshots))
+		for _, snapshot := range snapshots {
+			if snapshot.Created.Before(scanned) {
+				earlier = append(earlier, snapshot)
+			}
+		}
+		if index > len(earlier) {
+			return baselineMsg{total: len(earlier)}
+		}
+		baseline, err := history.LoadSnapshot(earlier[index-1])
+		if err != nil {
+			return baselineMsg{err: err}
+		}
+		diff := domain.DiffTrees(baseline, current)
+		diff.Baseline = earlier[index-1].Created
+		return baselineMsg{index: index, total: len(earlier), diff: &diff}
+	}
+}
+
+// startWatch watches the scanned tree when watch mode is on. Watches are
+// dropped whenever a new scan starts and registered again once it completes.
+func (model Model) startWatch() (Model, tea.Cmd) {
+	model = model.stopWatch()
+	if model.watcher == nil || !model.state.Prefs.Watch || model.state.Tree.RootID == "" {
+		return model, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	model.watchCancel = cancel
+	request := model.scanRequest(model.state.Tree.RootID)
+	watcher := model.watcher
+	return model, func() tea.Msg {
+		return watchStartedMsg{ctx: ctx, err: watcher.Watch(ctx, request)}
+	}
+}
+
+func (model Model) stopWatch() Model {
+	if model.watchCancel != nil {
+		model.watchCancel()
+		model.watchCancel = nil
+	}
+	return model
+}
+
+func (model Model) treeUpdateCmd(ctx context.Context) tea.Cmd {
+	updates := model.watcher.Updates()
+	return func() tea.Msg {
+		select {
+		case update := <-updates:
+			return treeUpdateMsg{ctx: ctx, update: update}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
 func (model Model) cancelScan(message string) Model {
 	if model.cancel != nil {
 		model.cancel()
@@ -791,6 +1770,26 @@ func invalidator(scanner services.Scanner) services.Invalidator {
 	return provider
 }
 
+func historyProvider(scanner services.Scanner) services.HistoryProvider {
+	provider, _ := scanner.(services.HistoryProvider)
+	return provider
+}
+
+func archiveIndexer(scanner services.Scanner) services.ArchiveIndexer {
+	indexer, _ := scanner.(services.ArchiveIndexer)
+	return indexer
+}
+
+func duplicateFinder(scanner services.Scanner) services.DuplicateFinder {
+	finder, _ := scanner.(services.DuplicateFinder)
+	return finder
+}
+
+func watcherProvider(scanner services.Scanner) services.Watcher {
+	provider, _ := scanner.(services.Watcher)
+	return provider
+}
+
 func actionPreviewer(actions services.Actions) services.ActionPreviewer {
 	previewer, _ := actions.(services.ActionPreviewer)
 	return previewer
@@ -809,6 +1808,31 @@ func previewPrompt(preview services.ActionPreview, step int) string {
 	return summary + " - confirm (y/n)"
 }
 
+func blockedPrompt(preview services.ActionPreview) string {
+	return fmt.Sprintf("%s blocked: %d git repositories have uncommitted or unpushed work - ! to override, n to cancel", strings.ToUpper(string(preview.Type)), len(preview.Git))
+}
+
+// inspectGit reads the git state of the highlighted folder in the background
+// when it is a work tree, for the detail panel.
+func (model Model) inspectGit() (Model, tea.Cmd) {
+	node := model.state.CurrentNode()
+	if node == nil || node.Type != domain.NodeDir || model.state.ImportedFrom != "" || model.gitPending != "" {
+		return model, nil
+	}
+	if _, ok := model.gitStatus[node.Path]; ok {
+		return model, nil
+	}
+	if _, err := os.Lstat(filepath.Join(node.Path, ".git")); err != nil {
+		return model, nil
+	}
+	path := node.Path
+	model.gitPending = path
+	return model, func() tea.Msg {
+		status, err := services.InspectGitRepo(context.Background(), path)
+		return gitStatusMsg{path: path, status: status, err: err}
+	}
+}
+
 func (model *Model) ensureCursorVisible() {
 	visible := model.state.VisibleNodes()
 	if len(visible) == 0 {
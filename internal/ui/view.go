@@ -3,6 +3,7 @@ package ui
 import (
 	"fmt"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -10,6 +11,8 @@ import (
 	"github.com/charmbracelet/lipgloss"
 
 	"sweepfs/internal/domain"
+	"sweepfs/internal/fsinfo"
+	"sweepfs/internal/services"
 	"sweepfs/internal/state"
 )
 
@@ -66,11 +69,17 @@ func renderBody(model Model, styles uiStyles) string {
 
 	leftWidth, rightWidth, showRight := splitPanels(model.width)
 	left := renderTreePanel(model, styles, visible, bodyHeight, leftWidth)
+	if model.listView != "" {
+		left = renderListPanel(model, styles, bodyHeight, leftWidth)
+	}
 	if !showRight {
 		return left
 	}
 	sep := lipgloss.NewStyle().Foreground(lipgloss.Color("238")).Render("│")
 	right := renderDetailPanel(model, styles, rightWidth, bodyHeight)
+	if model.listView != "" && !model.confirming {
+		right = renderListDetailPanel(model, styles, rightWidth, bodyHeight)
+	}
 	return lipgloss.JoinHorizontal(lipgloss.Top, left, sep, right)
 }
 
@@ -91,15 +100,22 @@ func renderFooter(model Model, styles uiStyles) string {
 	selectedCount, selectedSize := model.state.SelectionSummary()
 	selectionInfo := fmt.Sprintf("Selected: %d (%s)", selectedCount, formatSize(selectedSize))
 	sortInfo := fmt.Sprintf("Sort: %s", strings.ToUpper(string(model.state.Prefs.SortMode)))
+	sizeInfo := fmt.Sprintf("Size: %s", strings.ToUpper(string(model.state.Prefs.SizeMode)))
 	hiddenInfo := "Hidden: off"
 	if model.state.Prefs.ShowHidden {
 		hiddenInfo = "Hidden: on"
 	}
 	filterInfo := filterSummary(model)
-	left := fmt.Sprintf("%s  %s  %s%s", selectionInfo, sortInfo, hiddenInfo, filterInfo)
-	keys := "↑/↓ move  → enter  ← up  enter expand  s scan  / search  e ext  z min  x clear  o sort  h hidden  p paste  r refresh  ? help  q quit"
+	if len(model.scanErrors) > 0 {
+		filterInfo += fmt.Sprintf("  Errors: %d", len(model.scanErrors))
+	}
+	left := fmt.Sprintf("%s  %s  %s  %s%s", selectionInfo, sortInfo, sizeInfo, hiddenInfo, filterInfo)
+	keys := "↑/↓ move  → enter  ← up  enter expand  s scan  / search  e ext  z min  x clear  o sort  g growth  D dupes  X export  u size  h hidden  i exclude  w watch  p paste  r refresh  ? help  q quit"
 	if model.confirming {
 		keys = "y confirm  n cancel"
+		if model.pendingPreview.Blocked && !model.gitOverride {
+			keys = "! override git safety  n cancel"
+		}
 	}
 	if model.awaitingDestination {
 		keys = "navigate + p paste  or type path  tab complete"
@@ -113,6 +129,21 @@ func renderFooter(model Model, styles uiStyles) string {
 	if model.awaitingCompression {
 		keys = "compress? y/n"
 	}
+	if model.listView != "" {
+		keys = "↑/↓ move  enter reveal in tree  esc close"
+	}
+	if model.listView == "cleanup" {
+		keys = "↑/↓ move  space select  * select all  d delete  enter reveal  esc close"
+	}
+	if model.listView == "owners" {
+		keys = "↑/↓ move  enter filter by owner  esc close"
+	}
+	if model.listView == "mounts" {
+		keys = "↑/↓ move  enter scan filesystem  esc close"
+	}
+	if model.listView == "dupes" {
+		keys = "↑/↓ move  space select  K keep one  H link copies  enter reveal  esc close"
+	}
 	footerLine := padLine(left, keys, model.width)
 	return strings.Join([]string{statusLine, styles.mutedStyle.Render(footerLine)}, "\n")
 }
@@ -127,8 +158,28 @@ func renderTreePanel(model Model, styles uiStyles, visible []state.VisibleNode,
 	status := "IDLE"
 	if model.scanning {
 		status = "SCANNING"
+	} else if model.dupeCancel != nil {
+		status = "HASHING"
+	} else if model.watchCancel != nil {
+		status = "WATCHING"
+	} else if model.state.ImportedFrom != "" {
+		status = "IMPORTED"
+	}
+	switch model.state.Flat {
+	case state.FlatFiles:
+		crumbs = "Largest files in " + model.state.Tree.RootID
+	case state.FlatDirs:
+		crumbs = "Largest folders in " + model.state.Tree.RootID
+	}
+	right := styles.statusStyle.Render(status)
+	if free := freeSpaceLabel(model); free != "" {
+		style := styles.mutedStyle
+		if model.disk.UsedShare() >= 0.9 {
+			style = styles.warnStyle
+		}
+		right = style.Render(free) + "  " + right
 	}
-	headerLine := padLine(styles.headerStyle.Render("SweepFS")+"  "+crumbs, styles.statusStyle.Render(status), contentWidth)
+	headerLine := padLine(styles.headerStyle.Render("SweepFS")+"  "+crumbs, right, contentWidth)
 	listHeight := height - 1
 	if listHeight < 1 {
 		listHeight = 1
@@ -163,10 +214,31 @@ func renderTreePanel(model Model, styles uiStyles, visible []state.VisibleNode,
 			marker = styles.selectedStyle.Render("[x]")
 		}
 		name := node.Name
+		if model.state.Flat != state.FlatOff {
+			name = relativePath(model.state.Tree.RootID, node.Path)
+		}
 		if node.Type == domain.NodeDir {
 			name += "/"
 		}
+		if node.LinkTarget != "" {
+			name += " " + styles.mutedStyle.Render("→ "+node.LinkTarget)
+		}
+		if node.BrokenLink {
+			name += " " + styles.warnStyle.Render("[broken link]")
+		}
+		if tag := nodeTag(node); tag != "" {
+			name += " " + styles.mutedStyle.Render(tag)
+		}
+		if tag := growthTag(model.state.Growth, node); tag != "" {
+			name += " " + styles.warnStyle.Render(tag)
+		}
+		if tag := errorTag(node); tag != "" {
+			name += " " + styles.warnStyle.Render(tag)
+		}
 		lineSize := fmt.Sprintf("%*s", sizeWidth, sizeLabel(node))
+		if model.state.Prefs.SortMode == domain.SortByCount {
+			lineSize = countLabel(model, node)
+		}
 		line := fmt.Sprintf("%s %s %s%s %s", lineSize, marker, indent, icon, name)
 		if index == model.state.Cursor {
 			line = styles.cursorStyle.Render(line)
@@ -203,7 +275,7 @@ func renderDetailPanel(model Model, styles uiStyles, width, height int) string {
 		styles.headerStyle.Render("Path"),
 		node.Path,
 		"",
-		styles.headerStyle.Render("Size"),
+		styles.headerStyle.Render(sizeHeader(node)),
 		fmt.Sprintf("Direct: %s", formatSize(node.SizeBytes)),
 		fmt.Sprintf("Total : %s", formatSize(sizeFor(node))),
 	}
@@ -218,8 +290,28 @@ func renderDetailPanel(model Model, styles uiStyles, width, height int) string {
 		}
 		lines = append(lines, fmt.Sprintf("Folders: %d", folders))
 		lines = append(lines, fmt.Sprintf("Files : %d", files))
+		if node.Scanned && node.SharedBytes > 0 {
+			lines = append(lines, fmt.Sprintf("Unique: %s", formatSize(node.AccumBytes-node.SharedBytes)))
+			lines = append(lines, fmt.Sprintf("Shared: %s (hardlinks)", formatSize(node.SharedBytes)))
+		}
+	} else if node.Shared {
+		lines = append(lines, fmt.Sprintf("Links : %d (shared)", node.Links))
+		if node.AccumBytes == 0 {
+			lines = append(lines, "Counted under another link")
+		}
 	}
+	if note := skipNote(node); note != "" {
+		lines = append(lines, "", styles.headerStyle.Render("Not scanned"), note)
+	}
+	lines = append(lines, categoryLines(model, node, styles)...)
+	lines = append(lines, ageLines(node, styles)...)
+	lines = append(lines, archiveLines(node, styles)...)
+	lines = append(lines, linkLines(node, styles)...)
+	lines = append(lines, gitLines(model, node, styles)...)
+	lines = append(lines, errorLines(model, node, styles)...)
+	lines = append(lines, growthLines(model.state.Growth, node, styles)...)
 	lines = append(lines, "", styles.headerStyle.Render("Modified"), mod)
+	lines = append(lines, metadataLines(node, styles)...)
 
 	content := strings.Join(lines, "\n")
 	content = lipgloss.NewStyle().Width(contentWidth).Height(height).Render(content)
@@ -287,6 +379,16 @@ func renderPreviewPanel(model Model, styles uiStyles, width, height int) string
 			lines = append(lines, warn)
 		}
 	}
+	for _, status := range preview.Git {
+		lines = append(lines, status.Samples...)
+	}
+	if preview.Blocked {
+		if model.gitOverride {
+			lines = append(lines, "", styles.warnStyle.Render("Git safety overridden"))
+		} else {
+			lines = append(lines, "", styles.warnStyle.Render("Blocked in safe mode - press ! to override"))
+		}
+	}
 	contentWidth := maxInt(width-2, 10)
 	content := strings.Join(lines, "\n")
 	content = lipgloss.NewStyle().Width(contentWidth).Height(height).Render(content)
@@ -310,12 +412,32 @@ func renderHelpView(model Model, styles uiStyles) string {
 		model.keys.Scan,
 		model.keys.Sort,
 		model.keys.Hidden,
+		model.keys.SizeMode,
+		model.keys.Exclusions,
+		model.keys.DepthLimit,
+		model.keys.Watch,
+		model.keys.Growth,
+		model.keys.Export,
+		model.keys.Errors,
+		model.keys.Duplicates,
+		model.keys.KeepOne,
+		model.keys.Dedupe,
 		model.keys.Paste,
 		model.keys.Search,
 		model.keys.ExtFilter,
+		model.keys.TypeFilter,
+		model.keys.AgeFilter,
+		model.keys.SelectAll,
+		model.keys.Flat,
+		model.keys.Owners,
+		model.keys.Cleanup,
+		model.keys.Mounts,
+		model.keys.Archive,
+		model.keys.OwnerFilter,
 		model.keys.SizeFilter,
 		model.keys.ClearFilter,
 		model.keys.Confirm,
+		model.keys.Override,
 		model.keys.Cancel,
 		model.keys.Help,
 		model.keys.Quit,
@@ -327,11 +449,11 @@ func renderHelpView(model Model, styles uiStyles) string {
 	lines = append(lines, "", styles.headerStyle.Render("Selection"))
 	lines = append(lines, "space toggle select", "selection counted in footer")
 	lines = append(lines, "", styles.headerStyle.Render("Actions"))
-	lines = append(lines, "s scan", "r refresh", "o sort", "h hidden", "/ search", "e ext filter", "z size filter", "x clear")
+	lines = append(lines, "s scan", "r refresh", "o sort", "u apparent/disk size", "h hidden", "i exclusion rules", "L depth limit", "w watch for changes", "g growth since an earlier scan", "X export as ncdu json", "E list unreadable paths", "D find duplicate files", "F largest files/folders", "O usage by owner", "C cleanup candidates", "M filesystems and free space", "v browse zip/tar archive", "/ search", "e ext filter", "t type filter", "a age filter", "U owner filter", "* select matches", "z size filter", "x clear")
 	lines = append(lines, "", styles.headerStyle.Render("Operations"))
-	lines = append(lines, "d delete", "m move", "c copy", "b backup (name + compress)", "p paste dest")
+	lines = append(lines, "d delete", "m move", "c copy (extracts archive members)", "b backup (name + compress)", "p paste dest")
 	lines = append(lines, "", styles.headerStyle.Render("Safety"))
-	lines = append(lines, "confirm with y", "cancel with n or esc", "blocked: /, $HOME, /etc, /usr, /var")
+	lines = append(lines, "confirm with y", "cancel with n or esc", "blocked: /, $HOME, /etc, /usr, /var", "blocked: git repos with uncommitted or unpushed work (! overrides)")
 	lines = append(lines, "", styles.headerStyle.Render("Keys"))
 	for _, binding := range bindings {
 		keysLabel := strings.Join(binding.Keys(), ", ")
@@ -350,6 +472,36 @@ func currentPath(model Model) string {
 	return model.state.CurrentPath()
 }
 
+func rankedRules(ruleBytes map[string]int64) []string {
+	rules := make([]string, 0, len(ruleBytes))
+	for rule := range ruleBytes {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if ruleBytes[rules[i]] != ruleBytes[rules[j]] {
+			return ruleBytes[rules[i]] > ruleBytes[rules[j]]
+		}
+		return rules[i] < rules[j]
+	})
+	return rules
+}
+
+func relativePath(root, path string) string {
+	if rel, err := filepath.Rel(root, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// freeSpaceLabel summarizes the filesystem holding the scan root for the
+// tree header.
+func freeSpaceLabel(model Model) string {
+	if !model.diskKnown || model.disk.Total == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s %s free", shareBar(model.disk.UsedShare(), 6), formatSize(model.disk.Free))
+}
+
 func breadcrumbs(path string) string {
 	path = filepath.Clean(path)
 	if path == "." {
@@ -391,7 +543,56 @@ func splitPanels(width int) (int, int, bool) {
 	return left, right, true
 }
 
+// archiveLines describes an archive and its members once indexed, or a
+// member with the archive it was read from.
+func archiveLines(node *domain.Node, styles uiStyles) []string {
+	switch {
+	case node.Archive != "":
+		lines := []string{"", styles.headerStyle.Render("In archive"), node.Archive}
+		if node.Type == domain.NodeFile && node.PackedBytes > 0 {
+			lines = append(lines, fmt.Sprintf("Packed: %s (%s)", formatSize(node.PackedBytes), ratioLabel(node.SizeBytes, node.PackedBytes)))
+		}
+		return lines
+	case node.Type == domain.NodeFile && len(node.ChildrenIDs) > 0:
+		lines := []string{"", styles.headerStyle.Render("Archive")}
+		lines = append(lines, fmt.Sprintf("Unpacked: %s (%s)", formatSize(node.UnpackedBytes), ratioLabel(node.UnpackedBytes, node.SizeBytes)))
+		return lines
+	case node.Type == domain.NodeFile && services.IsArchive(node.Name):
+		return []string{"", styles.headerStyle.Render("Archive"), "Press v to list its members"}
+	default:
+		return nil
+	}
+}
+
+// linkLines shows where a symlink points and whether it was followed.
+func linkLines(node *domain.Node, styles uiStyles) []string {
+	if node.Type != domain.NodeSymlink && node.LinkTarget == "" {
+		return nil
+	}
+	lines := []string{"", styles.headerStyle.Render("Symlink"), "→ " + node.LinkTarget}
+	switch {
+	case node.BrokenLink:
+		lines = append(lines, styles.warnStyle.Render("Broken - the target does not exist"))
+	case node.Type != domain.NodeSymlink:
+		lines = append(lines, "Followed - sizes are those of the target")
+	case node.Skipped == domain.SkipNone:
+		lines = append(lines, "Not followed - scan with -L to count the target")
+	}
+	return lines
+}
+
+// ratioLabel is the compression ratio of an archive or member.
+func ratioLabel(unpacked, packed int64) string {
+	if packed <= 0 {
+		return "ratio unknown"
+	}
+	return fmt.Sprintf("%.1fx", float64(unpacked)/float64(packed))
+}
+
 func fileIcon(model Model, node *domain.Node) string {
+	if node.Type == domain.NodeSymlink {
+		return "🔗"
+	}
 	if node.Type == domain.NodeDir {
 		if !node.Scanned {
 			return "📁"
@@ -401,6 +602,9 @@ func fileIcon(model Model, node *domain.Node) string {
 		}
 		return "📁"
 	}
+	if len(node.ChildrenIDs) > 0 || (node.Archive == "" && services.IsArchive(node.Name)) {
+		return "📦"
+	}
 	return "📄"
 }
 
@@ -426,6 +630,38 @@ func sizeLabel(node *domain.Node) string {
 	return formatSize(sizeFor(node))
 }
 
+// countLabel replaces the size column in count mode: the entries below a
+// node and their share of its parent's entries, or of the root's in the flat
+// view.
+func countLabel(model Model, node *domain.Node) string {
+	if node.Type == domain.NodeDir && !node.Scanned {
+		return fmt.Sprintf("%9s %4s", "--", "")
+	}
+	count := state.EntryCount(node)
+	parentID := node.ParentID
+	if model.state.Flat != state.FlatOff {
+		parentID = model.state.Tree.RootID
+	}
+	share := ""
+	if parent, ok := model.state.Tree.Nodes[parentID]; ok && parent.ID != node.ID {
+		if total := state.EntryCount(parent); total > 0 {
+			share = fmt.Sprintf("%3.0f%%", float64(count)*100/float64(total))
+		}
+	}
+	return fmt.Sprintf("%9s %4s", formatCount(count), share)
+}
+
+func formatCount(count int) string {
+	switch {
+	case count >= 1000000:
+		return fmt.Sprintf("%.1fM", float64(count)/1000000)
+	case count >= 10000:
+		return fmt.Sprintf("%.1fk", float64(count)/1000)
+	default:
+		return fmt.Sprintf("%d", count)
+	}
+}
+
 func sizeFor(node *domain.Node) int64 {
 	if node.Type == domain.NodeDir {
 		return node.AccumBytes
@@ -433,6 +669,285 @@ func sizeFor(node *domain.Node) int64 {
 	return node.SizeBytes
 }
 
+func metadataLines(node *domain.Node, styles uiStyles) []string {
+	lines := []string{}
+	if !node.AccessTime.IsZero() {
+		lines = append(lines, "", styles.headerStyle.Render("Accessed"), node.AccessTime.Format(time.RFC822))
+	}
+	if (node.Mode == 0 && node.Inode == 0) || node.Archive != "" {
+		return lines
+	}
+	lines = append(lines, "", styles.headerStyle.Render("Metadata"))
+	lines = append(lines, fmt.Sprintf("Mode  : %s", node.Mode))
+	lines = append(lines, fmt.Sprintf("Owner : %s (%d:%d)", fsinfo.UserName(node.UID), node.UID, node.GID))
+	if node.Inode != 0 {
+		lines = append(lines, fmt.Sprintf("Inode : %d", node.Inode))
+	}
+	return lines
+}
+
+func errorTag(node *domain.Node) string {
+	switch {
+	case node.ReadError != "":
+		return "[unreadable]"
+	case node.Incomplete:
+		return "[incomplete]"
+	default:
+		return ""
+	}
+}
+
+func errorLines(model Model, node *domain.Node, styles uiStyles) []string {
+	if node.ReadError != "" {
+		return []string{"", styles.warnStyle.Render("Unreadable (" + string(node.ErrorKind) + ")"), node.ReadError}
+	}
+	if !node.Incomplete {
+		return nil
+	}
+	count := 0
+	for _, scanErr := range model.scanErrors {
+		if isWithinPath(node.Path, scanErr.Path) {
+			count++
+		}
+	}
+	return []string{"", styles.warnStyle.Render("Sizes incomplete"), fmt.Sprintf("%d unreadable paths below - press E", count)}
+}
+
+func renderListPanel(model Model, styles uiStyles, height, width int) string {
+	contentWidth := maxInt(width-2, 10)
+	title := ""
+	rows := []string{}
+	switch model.listView {
+	case "errors":
+		title = fmt.Sprintf("Scan errors (%d)", len(model.scanErrors))
+		for _, scanErr := range model.scanErrors {
+			rows = append(rows, fmt.Sprintf("%-10s %s", scanErr.Kind, scanErr.Path))
+		}
+	case "dupes":
+		title = fmt.Sprintf("Duplicate groups (%d)", len(model.dupeGroups))
+		for _, row := range model.dupeRows {
+			group := model.dupeGroups[row.group]
+			if !row.member {
+				rows = append(rows, styles.headerStyle.Render(fmt.Sprintf("%d × %s  reclaim %s", len(group.Paths), formatSize(group.Size), formatSize(group.Reclaimable()))))
+				continue
+			}
+			marker := "[ ]"
+			if model.state.Selected[row.path] {
+				marker = styles.selectedStyle.Render("[x]")
+			}
+			if _, ok := model.state.Tree.Nodes[row.path]; !ok {
+				marker = styles.mutedStyle.Render("[-]")
+			}
+			rows = append(rows, fmt.Sprintf("  %s %s", marker, row.path))
+		}
+	case "cleanup":
+		title = fmt.Sprintf("Cleanup candidates (%d, %s reclaimable)", len(model.cleanup.Candidates), formatSize(model.cleanup.TotalBytes))
+		for _, candidate := range model.cleanup.Candidates {
+			marker := "[ ]"
+			if model.state.Selected[candidate.Path] {
+				marker = styles.selectedStyle.Render("[x]")
+			}
+			if _, ok := model.state.Tree.Nodes[candidate.Path]; !ok {
+				marker = styles.mutedStyle.Render("[-]")
+			}
+			name := relativePath(model.cleanup.Root, candidate.Path)
+			if candidate.Type == domain.NodeDir {
+				name += "/"
+			}
+			rows = append(rows, fmt.Sprintf("%9s %s %s", formatSize(candidate.Bytes), marker, name))
+		}
+	case "owners":
+		title = fmt.Sprintf("Owners of %s (%d)", model.state.Current, len(model.ownerRows))
+		var total int64
+		for _, row := range model.ownerRows {
+			total += row.total.Bytes
+		}
+		for _, row := range model.ownerRows {
+			share := 0.0
+			if total > 0 {
+				share = float64(row.total.Bytes) / float64(total)
+			}
+			rows = append(rows, fmt.Sprintf("%-16s %s %9s %3.0f%%", fsinfo.UserName(row.uid), shareBar(share, 10), formatSize(row.total.Bytes), share*100))
+		}
+	case "mounts":
+		title = fmt.Sprintf("Filesystems (%d)", len(model.mounts))
+		for _, mount := range model.mounts {
+			usage := mount.Usage
+			rows = append(rows, fmt.Sprintf("%s %3.0f%% %9s free  %-8s %s", shareBar(usage.UsedShare(), 10), usage.UsedShare()*100, formatSize(usage.Free), mount.FSType, mount.Path))
+		}
+	}
+	listHeight := maxInt(height-1, 1)
+	start := 0
+	if model.listCursor >= listHeight {
+		start = model.listCursor - listHeight + 1
+	}
+	end := minInt(start+listHeight, len(rows))
+	lines := []string{styles.headerStyle.Render(title)}
+	for index := start; index < end; index++ {
+		line := rows[index]
+		if index == model.listCursor {
+			line = styles.cursorStyle.Render(line)
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) < height {
+		lines = append(lines, "")
+	}
+	return styles.panelBorder.Width(contentWidth).Render(strings.Join(lines, "\n"))
+}
+
+func renderListDetailPanel(model Model, styles uiStyles, width, height int) string {
+	contentWidth := maxInt(width-2, 10)
+	lines := []string{}
+	switch model.listView {
+	case "errors":
+		if model.listCursor < len(model.scanErrors) {
+			scanErr := model.scanErrors[model.listCursor]
+			lines = append(lines,
+				styles.headerStyle.Render("Path"), scanErr.Path,
+				"", styles.headerStyle.Render("Kind"), string(scanErr.Kind),
+				"", styles.headerStyle.Render("Error"), scanErr.Message,
+			)
+		}
+	case "dupes":
+		if model.listCursor < len(model.dupeRows) {
+			group := model.dupeGroups[model.dupeRows[model.listCursor].group]
+			selected := 0
+			for _, path := range group.Paths {
+				if model.state.Selected[path] {
+					selected++
+				}
+			}
+			lines = append(lines,
+				styles.headerStyle.Render("Duplicate group"),
+				fmt.Sprintf("Copies : %d", len(group.Paths)),
+				fmt.Sprintf("Size   : %s each", formatSize(group.Size)),
+				fmt.Sprintf("Reclaim: %s", formatSize(group.Reclaimable())),
+				fmt.Sprintf("SHA-256: %x", group.Hash[:8]),
+				"", fmt.Sprintf("Selected: %d (%s)", selected, formatSize(group.Size*int64(selected))),
+			)
+			if selected == len(group.Paths) {
+				lines = append(lines, styles.warnStyle.Render("Every copy is selected"))
+			}
+		}
+	case "cleanup":
+		if model.listCursor < len(model.cleanup.Candidates) {
+			candidate := model.cleanup.Candidates[model.listCursor]
+			lines = append(lines,
+				styles.headerStyle.Render("Path"), candidate.Path,
+				"", styles.headerStyle.Render("Rule"), candidate.Rule,
+				"", fmt.Sprintf("Size: %s", formatSize(candidate.Bytes)),
+			)
+			if !candidate.ModTime.IsZero() {
+				lines = append(lines, fmt.Sprintf("Last change: %s (%dd ago)", candidate.ModTime.Format("2006-01-02"), domain.DaysSince(candidate.ModTime, time.Now())))
+			}
+		}
+		lines = append(lines, "", styles.headerStyle.Render("By rule"))
+		for _, rule := range rankedRules(model.cleanup.RuleBytes) {
+			lines = append(lines, fmt.Sprintf("%9s  %s", formatSize(model.cleanup.RuleBytes[rule]), rule))
+		}
+		if len(model.cleanup.Unevaluated) > 0 {
+			lines = append(lines, "", styles.headerStyle.Render("Skipped (hidden files off)"))
+			for _, rule := range model.cleanup.Unevaluated {
+				lines = append(lines, styles.mutedStyle.Render(rule))
+			}
+		}
+		count, size := model.state.SelectionSummary()
+		lines = append(lines, "", fmt.Sprintf("Selected: %d (%s)", count, formatSize(size)))
+	case "owners":
+		if model.listCursor < len(model.ownerRows) {
+			row := model.ownerRows[model.listCursor]
+			lines = append(lines,
+				styles.headerStyle.Render("Owner"),
+				fmt.Sprintf("User : %s", fsinfo.UserName(row.uid)),
+				fmt.Sprintf("UID  : %d", row.uid),
+				fmt.Sprintf("Size : %s", formatSize(row.total.Bytes)),
+				fmt.Sprintf("Files: %d", row.total.Files),
+				"", "enter shows only this owner's files",
+			)
+		}
+	case "mounts":
+		if model.listCursor < len(model.mounts) {
+			mount := model.mounts[model.listCursor]
+			usage := mount.Usage
+			access := "read-write"
+			if mount.ReadOnly {
+				access = "read-only"
+			}
+			lines = append(lines,
+				styles.headerStyle.Render("Mount point"), mount.Path,
+				"", styles.headerStyle.Render("Filesystem"),
+				fmt.Sprintf("Type  : %s (%s)", mount.FSType, access),
+				fmt.Sprintf("Source: %s", mount.Source),
+				"", styles.headerStyle.Render("Space"),
+				fmt.Sprintf("Total : %s", formatSize(usage.Total)),
+				fmt.Sprintf("Used  : %s (%.0f%%)", formatSize(usage.Used), usage.UsedShare()*100),
+				fmt.Sprintf("Free  : %s", formatSize(usage.Free)),
+			)
+			if usage.Inodes > 0 {
+				lines = append(lines,
+					"", styles.headerStyle.Render("Inodes"),
+					fmt.Sprintf("Total : %d", usage.Inodes),
+					fmt.Sprintf("Used  : %d (%.0f%%)", usage.Inodes-usage.InodesFree, usage.InodeShare()*100),
+					fmt.Sprintf("Free  : %d", usage.InodesFree),
+				)
+			}
+			lines = append(lines, "", "enter scans this filesystem only")
+		}
+	}
+	content := strings.Join(lines, "\n")
+	content = lipgloss.NewStyle().Width(contentWidth).Height(height).Render(content)
+	return styles.panelBorder.Width(contentWidth).Render(content)
+}
+
+func nodeTag(node *domain.Node) string {
+	switch node.Skipped {
+	case domain.SkipMount:
+		return fmt.Sprintf("[mount: %s]", fsTypeLabel(node))
+	case domain.SkipExcluded:
+		return "[excluded]"
+	case domain.SkipDepth:
+		return "[unscanned below]"
+	case domain.SkipLoop:
+		return "[loop]"
+	case domain.SkipLinked:
+		return "[counted elsewhere]"
+	default:
+		return ""
+	}
+}
+
+func skipNote(node *domain.Node) string {
+	switch node.Skipped {
+	case domain.SkipMount:
+		return fmt.Sprintf("Mount point (%s), skipped in one-filesystem mode", fsTypeLabel(node))
+	case domain.SkipExcluded:
+		return fmt.Sprintf("Excluded by %s", node.ExcludedBy)
+	case domain.SkipDepth:
+		return "Depth limit reached - press → to scan this folder"
+	case domain.SkipLoop:
+		return "Link to a folder above it - not followed to avoid a loop"
+	case domain.SkipLinked:
+		return "Target folder is already counted at another path"
+	default:
+		return ""
+	}
+}
+
+func fsTypeLabel(node *domain.Node) string {
+	if node.FSType == "" {
+		return "other fs"
+	}
+	return node.FSType
+}
+
+func sizeHeader(node *domain.Node) string {
+	if node.SizeMode == domain.SizeDisk {
+		return "Size (on disk)"
+	}
+	return "Size (apparent)"
+}
+
 func progressBar(count int64, width int) string {
 	if width <= 0 {
 		return ""
@@ -462,13 +977,164 @@ func filterSummary(model Model) string {
 	if model.state.FilterExt != "" {
 		parts = append(parts, fmt.Sprintf("Ext:%s", model.state.FilterExt))
 	}
+	if model.state.FilterType != "" {
+		parts = append(parts, fmt.Sprintf("Type:%s", model.state.FilterType))
+	}
 	if model.state.MinSizeBytes > 0 {
 		parts = append(parts, fmt.Sprintf("Min:%s", formatSize(model.state.MinSizeBytes)))
 	}
-	if len(parts) == 0 {
+	if model.state.FilterOwner != nil {
+		parts = append(parts, fmt.Sprintf("Owner:%s", fsinfo.UserName(*model.state.FilterOwner)))
+	}
+	if model.state.MinAgeDays > 0 {
+		parts = append(parts, fmt.Sprintf("Age:>%dd", model.state.MinAgeDays))
+	}
+	summary := ""
+	if len(parts) > 0 {
+		summary = "  Filters[" + strings.Join(parts, ", ") + "]"
+	}
+	if model.state.Growth != nil {
+		summary += "  Since: " + model.state.Growth.Baseline.Format("Jan 02 15:04")
+	}
+	return summary
+}
+
+// categoryLines shows how a folder's bytes split across file types. The
+// active type filter is marked.
+func categoryLines(model Model, node *domain.Node, styles uiStyles) []string {
+	if node.Type != domain.NodeDir || len(node.Categories) == 0 {
+		return nil
+	}
+	var total int64
+	for _, totals := range node.Categories {
+		total += totals.Bytes
+	}
+	lines := []string{"", styles.headerStyle.Render("Types")}
+	for _, category := range domain.RankCategories(node.Categories) {
+		totals := node.Categories[category]
+		share := 0.0
+		if total > 0 {
+			share = float64(totals.Bytes) / float64(total)
+		}
+		marker := " "
+		if category == model.state.FilterType {
+			marker = ">"
+		}
+		lines = append(lines, fmt.Sprintf("%s%-10s %s %9s %3.0f%% %d files", marker, category, shareBar(share, 10), formatSize(totals.Bytes), share*100, totals.Files))
+	}
+	return lines
+}
+
+// ageLines shows when anything below a folder last changed or was read and
+// how its bytes spread over modification ages.
+func ageLines(node *domain.Node, styles uiStyles) []string {
+	if node.Type != domain.NodeDir || !node.Scanned || node.NewestMod.IsZero() {
+		return nil
+	}
+	now := time.Now()
+	lines := []string{"", styles.headerStyle.Render("Age")}
+	lines = append(lines, fmt.Sprintf("Newest change: %s (%dd ago)", node.NewestMod.Format("2006-01-02"), domain.DaysSince(node.NewestMod, now)))
+	if !node.NewestAccess.IsZero() {
+		lines = append(lines, fmt.Sprintf("Newest access: %s (%dd ago)", node.NewestAccess.Format("2006-01-02"), domain.DaysSince(node.NewestAccess, now)))
+	}
+	total := node.ModAges.Total()
+	if total == 0 {
+		return lines
+	}
+	for index, bytes := range node.ModAges {
+		share := float64(bytes) / float64(total)
+		lines = append(lines, fmt.Sprintf(" %-9s %s %9s %3.0f%%", domain.AgeBucketLabel(index), shareBar(share, 10), formatSize(bytes), share*100))
+	}
+	return lines
+}
+
+// gitLines shows the state of a git work tree and how its size splits
+// between .git and the checked-out files.
+func gitLines(model Model, node *domain.Node, styles uiStyles) []string {
+	if node.Type != domain.NodeDir {
+		return nil
+	}
+	if model.gitPending == node.Path {
+		return []string{"", styles.headerStyle.Render("Git"), "Reading .git..."}
+	}
+	status, ok := model.gitStatus[node.Path]
+	if !ok {
+		return nil
+	}
+	lines := []string{"", styles.headerStyle.Render("Git")}
+	branch := status.Branch
+	if branch == "" {
+		branch = "detached HEAD"
+	}
+	work := sizeFor(node)
+	if dotGit, ok := model.state.Tree.Nodes[filepath.Join(node.Path, ".git")]; ok {
+		work -= sizeFor(dotGit)
+	}
+	if work < 0 {
+		work = 0
+	}
+	lines = append(lines, fmt.Sprintf("Branch   : %s", branch))
+	lines = append(lines, fmt.Sprintf(".git     : %s", formatSize(status.GitBytes)))
+	lines = append(lines, fmt.Sprintf("Work tree: %s", formatSize(work)))
+	if !status.Dirty() {
+		return append(lines, "Clean, everything pushed")
+	}
+	for _, warning := range status.Warnings() {
+		lines = append(lines, styles.warnStyle.Render(strings.TrimPrefix(warning, "git "+status.WorkTree+": ")))
+	}
+	return append(lines, status.Samples...)
+}
+
+func shareBar(share float64, width int) string {
+	filled := clamp(int(share*float64(width)+0.5), 0, width)
+	if filled == 0 && share > 0 {
+		filled = 1
+	}
+	return strings.Repeat("█", filled) + strings.Repeat("░", width-filled)
+}
+
+func growthTag(diff *domain.TreeDiff, node *domain.Node) string {
+	if diff == nil {
+		return ""
+	}
+	change := diff.Change(node.Path)
+	switch change.Kind {
+	case domain.ChangeAdded:
+		return "(new)"
+	case domain.ChangeGrown, domain.ChangeShrunk:
+		return "(" + formatDelta(change.Delta()) + ")"
+	default:
 		return ""
 	}
-	return "  Filters[" + strings.Join(parts, ", ") + "]"
+}
+
+func growthLines(diff *domain.TreeDiff, node *domain.Node, styles uiStyles) []string {
+	if diff == nil {
+		return nil
+	}
+	lines := []string{"", styles.headerStyle.Render("Since " + diff.Baseline.Format(time.RFC822))}
+	change := diff.Change(node.Path)
+	switch change.Kind {
+	case domain.ChangeAdded:
+		lines = append(lines, fmt.Sprintf("Added (%s)", formatSize(change.After)))
+	case domain.ChangeGrown, domain.ChangeShrunk:
+		lines = append(lines, fmt.Sprintf("Change: %s (was %s)", formatDelta(change.Delta()), formatSize(change.Before)))
+	default:
+		lines = append(lines, "Unchanged")
+	}
+	if node.Type == domain.NodeDir {
+		if count, bytes := diff.RemovedBelow(node.Path); count > 0 {
+			lines = append(lines, fmt.Sprintf("Removed below: %d items (%s)", count, formatSize(bytes)))
+		}
+	}
+	return lines
+}
+
+func formatDelta(delta int64) string {
+	if delta < 0 {
+		return "-" + formatSize(-delta)
+	}
+	return "+" + formatSize(delta)
 }
 
 func clamp(value, min, max int) int {
@@ -487,3 +1153,10 @@ func maxInt(a, b int) int {
 	}
 	return b
 }
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}